@@ -0,0 +1,34 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+/**
+ * Store keeps the large values offloaded from the Data of the requests,
+ * the values are grouped by the requests, so that they are removed along with the request.
+ */
+type Store interface {
+	/**
+	 * Put saves the value of the request under the key, putting an existing key again overwrites it
+	 */
+	Put(ctx context.Context, requestID, key string, value []byte) error
+	/**
+	 * Get returns the value of the request under the key, or a NotFound error
+	 */
+	Get(ctx context.Context, requestID, key string) ([]byte, error)
+	/**
+	 * RemoveRequest removes all of the values of the request and returns the amount removed
+	 */
+	RemoveRequest(ctx context.Context, requestID string) (int, error)
+}
+
+/**
+ * Key returns the content address of the value, the same values of a request share one blob
+ */
+func Key(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
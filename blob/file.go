@@ -0,0 +1,130 @@
+package blob
+
+import (
+	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+var (
+	_ Store = &fileStore{}
+)
+
+const (
+	tmpSuffix = ".tmp"
+	// the prefixes of the encoded names, so that a name is never empty, "." or ".."
+	requestPrefix = "r-"
+	keyPrefix     = "b-"
+)
+
+// fileStore keeps a blob in a file under the directory of its request,
+// the request IDs and keys are encoded to the names of the files, see fileName.
+type fileStore struct {
+	dir string
+}
+
+// NewFileStore creates a blob store under the directory, which is created if not exists
+func NewFileStore(dir string) (Store, error) {
+	if dir == "" {
+		return nil, errors.NotValidf("empty blob dir")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Annotatef(err, "failed to create blob dir %s", dir)
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+// fileName encodes the ID in base64url with the prefix, which is a single path element never escaping the parent
+func fileName(prefix, id string) string {
+	return prefix + base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// requestDir returns the directory of the request, which is checked to be under the blob dir
+func (s *fileStore) requestDir(requestID string) (string, error) {
+	if requestID == "" {
+		return "", errors.NotValidf("empty request id")
+	}
+	dir := filepath.Join(s.dir, fileName(requestPrefix, requestID))
+	if rel, err := filepath.Rel(s.dir, dir); err != nil || rel != filepath.Base(dir) {
+		return "", errors.NotValidf("blob dir of request %s", requestID)
+	}
+	return dir, nil
+}
+
+func (s *fileStore) blobPath(requestID, key string) (string, error) {
+	if key == "" {
+		return "", errors.NotValidf("empty blob key")
+	}
+	dir, err := s.requestDir(requestID)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return filepath.Join(dir, fileName(keyPrefix, key)), nil
+}
+
+// Put writes the value to a temporary file and renames it, so that a blob is never read partially
+func (s *fileStore) Put(ctx context.Context, requestID, key string, value []byte) error {
+	path, err := s.blobPath(requestID, key)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return errors.Annotatef(err, "failed to create blob dir of %s", requestID)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-*"+tmpSuffix)
+	if err != nil {
+		return errors.Annotatef(err, "failed to create blob %s of %s", key, requestID)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return errors.Annotatef(err, "failed to write blob %s of %s", key, requestID)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return errors.Annotatef(err, "failed to sync blob %s of %s", key, requestID)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Annotatef(err, "failed to close blob %s of %s", key, requestID)
+	}
+	return errors.Annotatef(os.Rename(tmp.Name(), path), "failed to rename blob %s of %s", key, requestID)
+}
+
+func (s *fileStore) Get(ctx context.Context, requestID, key string) ([]byte, error) {
+	path, err := s.blobPath(requestID, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, errors.NotFoundf("blob %s of %s", key, requestID)
+	}
+	return b, errors.Annotatef(err, "failed to read blob %s of %s", key, requestID)
+}
+
+func (s *fileStore) RemoveRequest(ctx context.Context, requestID string) (int, error) {
+	dir, err := s.requestDir(requestID)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Annotatef(err, "failed to read blob dir of %s", requestID)
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), tmpSuffix) {
+			removed++
+		}
+	}
+	return removed, errors.Annotatef(os.RemoveAll(dir), "failed to remove blob dir of %s", requestID)
+}
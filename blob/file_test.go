@@ -0,0 +1,97 @@
+package blob
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+
+	value := []byte("large value")
+	key := Key(value)
+	assert.Equal(t, key, Key([]byte("large value")))
+	assert.Nil(t, s.Put(ctx, "req/1", key, value))
+	assert.Nil(t, s.Put(ctx, "req/1", key, value))
+	assert.Nil(t, s.Put(ctx, "req/1", "other", []byte("other")))
+	assert.Nil(t, s.Put(ctx, "req-2", key, value))
+
+	b, err := s.Get(ctx, "req/1", key)
+	assert.Nil(t, err)
+	assert.Equal(t, value, b)
+
+	// reopened
+	s, err = NewFileStore(dir)
+	assert.Nil(t, err)
+	b, err = s.Get(ctx, "req-2", key)
+	assert.Nil(t, err)
+	assert.Equal(t, value, b)
+
+	removed, err := s.RemoveRequest(ctx, "req/1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	_, err = s.Get(ctx, "req/1", key)
+	assert.True(t, errors.IsNotFound(err))
+	removed, err = s.RemoveRequest(ctx, "req/1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, removed)
+
+	// the other requests are kept
+	_, err = s.Get(ctx, "req-2", key)
+	assert.Nil(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.True(t, errors.Is(s.Put(ctx, "req-2", "", value), errors.NotValid))
+	_, err = NewFileStore("")
+	assert.True(t, errors.Is(err, errors.NotValid))
+}
+
+func TestFileStore_RequestID(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "blobs")
+	s, err := NewFileStore(dir)
+	assert.Nil(t, err)
+	outside := filepath.Join(root, "outside")
+	assert.Nil(t, os.WriteFile(outside, []byte("kept"), 0o644))
+	assert.Nil(t, s.Put(ctx, "req-1", "k", []byte("v")))
+
+	for _, requestID := range []string{".", "..", "../req-1", "/", "req/../.."} {
+		assert.Nil(t, s.Put(ctx, requestID, "k", []byte(requestID)), requestID)
+		b, err := s.Get(ctx, requestID, "k")
+		assert.Nil(t, err)
+		assert.Equal(t, requestID, string(b))
+		removed, err := s.RemoveRequest(ctx, requestID)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, removed)
+	}
+	for _, key := range []string{".", ".."} {
+		assert.Nil(t, s.Put(ctx, "req-2", key, []byte(key)))
+		b, err := s.Get(ctx, "req-2", key)
+		assert.Nil(t, err)
+		assert.Equal(t, key, string(b))
+	}
+
+	// the empty one is rejected rather than taken as the blob dir
+	assert.True(t, errors.Is(s.Put(ctx, "", "k", []byte("v")), errors.NotValid))
+	_, err = s.RemoveRequest(ctx, "")
+	assert.True(t, errors.Is(err, errors.NotValid))
+
+	// nothing outside the request dirs is touched
+	b, err := s.Get(ctx, "req-1", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(b))
+	b, err = os.ReadFile(outside)
+	assert.Nil(t, err)
+	assert.Equal(t, "kept", string(b))
+}
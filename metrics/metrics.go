@@ -0,0 +1,323 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRE  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+	// DefaultBuckets are the upper bounds in seconds for the durations of the nodes and the requests
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300, 900}
+)
+
+/**
+ * Registry holds the metric families and serves them in the Prometheus text exposition format,
+ * it implements http.Handler so that it can be mounted on the metrics path directly.
+ */
+type Registry struct {
+	mu       sync.RWMutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+type metricType string
+
+const (
+	counterType   metricType = "counter"
+	gaugeType     metricType = "gauge"
+	histogramType metricType = "histogram"
+)
+
+type family struct {
+	name       string
+	help       string
+	metricType metricType
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// the amounts of the observations in each bucket, not cumulative
+	counts []uint64
+	count  uint64
+}
+
+/**
+ * register panics on an invalid or a registered name,
+ * the metrics are registered on startup so it is a programming error.
+ */
+func (r *Registry) register(f *family) *family {
+	if !metricNameRE.MatchString(f.name) {
+		panic(fmt.Sprintf("invalid metric name: %q", f.name))
+	}
+	for _, name := range f.labelNames {
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") ||
+			(f.metricType == histogramType && name == "le") {
+			panic(fmt.Sprintf("invalid label name of %s: %q", f.name, name))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.families[f.name]; exists {
+		panic(fmt.Sprintf("metric %s is registered already", f.name))
+	}
+	f.series = make(map[string]*series)
+	r.families[f.name] = f
+	return f
+}
+
+/**
+ * with returns the series of the label values, which is created on the first use
+ */
+func (f *family) with(labelValues []string, fn func(s *series)) {
+	if len(labelValues) != len(f.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", f.name, len(f.labelNames), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if f.metricType == histogramType {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a counter, it panics if the name is invalid or registered already
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	return &CounterVec{f: r.register(&family{name: name, help: help, metricType: counterType, labelNames: labelNames})}
+}
+
+// Add increases the counter of the label values, a negative delta is ignored
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.f.with(labelValues, func(s *series) { s.value += delta })
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+type GaugeVec struct {
+	f *family
+}
+
+// NewGaugeVec registers a gauge, it panics if the name is invalid or registered already
+func (r *Registry) NewGaugeVec(name, help string, labelNames ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(&family{name: name, help: help, metricType: gaugeType, labelNames: labelNames})}
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.f.with(labelValues, func(s *series) { s.value = value })
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.f.with(labelValues, func(s *series) { s.value += delta })
+}
+
+type HistogramVec struct {
+	f *family
+}
+
+/**
+ * NewHistogramVec registers a histogram with the upper bounds of the buckets, DefaultBuckets if it is empty.
+ * It panics if the name is invalid or registered already.
+ */
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	bounds := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if !math.IsInf(b, 1) {
+			bounds = append(bounds, b)
+		}
+	}
+	sort.Float64s(bounds)
+	return &HistogramVec{f: r.register(&family{name: name, help: help, metricType: histogramType, labelNames: labelNames, buckets: bounds})}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.f.with(labelValues, func(s *series) {
+		// the observations above the last bound only count in +Inf
+		if i := sort.SearchFloat64s(h.f.buckets, value); i < len(s.counts) {
+			s.counts[i]++
+		}
+		s.count++
+		s.value += value
+	})
+}
+
+/**
+ * WriteTo writes all of the metrics in the Prometheus text exposition format,
+ * the families are sorted by the names and the series by the label values.
+ */
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.RLock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.RUnlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if req.Method == http.MethodHead {
+		return
+	}
+	_, _ = r.WriteTo(w)
+}
+
+func (f *family) write(w *countWriter) {
+	f.mu.Lock()
+	all := make([]series, 0, len(f.series))
+	for _, s := range f.series {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		all = append(all, c)
+	}
+	f.mu.Unlock()
+	sort.Slice(all, func(i, j int) bool {
+		return lessValues(all[i].labelValues, all[j].labelValues)
+	})
+
+	w.printf("# HELP %s %s\n", f.name, escapeHelp(f.help))
+	w.printf("# TYPE %s %s\n", f.name, f.metricType)
+	for _, s := range all {
+		labels := formatLabels(f.labelNames, s.labelValues)
+		if f.metricType != histogramType {
+			w.printf("%s%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			cumulative += s.counts[i]
+			w.printf("%s_bucket%s %d\n", f.name, wrapLabels(joinLabels(labels, `le="`+formatFloat(bound)+`"`)), cumulative)
+		}
+		w.printf("%s_bucket%s %d\n", f.name, wrapLabels(joinLabels(labels, `le="+Inf"`)), s.count)
+		w.printf("%s_sum%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+		w.printf("%s_count%s %d\n", f.name, wrapLabels(labels), s.count)
+	}
+}
+
+func lessValues(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabelValue(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+var (
+	helpReplacer       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpReplacer.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countWriter keeps the first error, so that the lines are written without checking each of them
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, args ...any) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, args...)
+	w.n += int64(n)
+	w.err = err
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	runs := r.NewCounterVec("test_runs_total", "Runs of the vertex.\nsecond line", "dag", "vertex")
+	running := r.NewGaugeVec("test_running", "Running vertices.")
+	duration := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.1}, "dag")
+
+	runs.Inc("b", "n1")
+	runs.Add(2, "a", `quote"back\slash`+"\n")
+	runs.Add(-1, "a", "ignored")
+	running.Add(3)
+	running.Add(-1)
+	duration.Observe(0.05, "a")
+	duration.Observe(0.1, "a")
+	duration.Observe(0.5, "a")
+	duration.Observe(5, "a")
+
+	b := &strings.Builder{}
+	_, err := r.WriteTo(b)
+	assert.Nil(t, err)
+	assert.Equal(t, `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{dag="a",le="0.1"} 2
+test_duration_seconds_bucket{dag="a",le="1"} 3
+test_duration_seconds_bucket{dag="a",le="+Inf"} 4
+test_duration_seconds_sum{dag="a"} 5.65
+test_duration_seconds_count{dag="a"} 4
+# HELP test_running Running vertices.
+# TYPE test_running gauge
+test_running 2
+# HELP test_runs_total Runs of the vertex.\nsecond line
+# TYPE test_runs_total counter
+test_runs_total{dag="a",vertex="quote\"back\\slash\n"} 2
+test_runs_total{dag="b",vertex="n1"} 1
+`, b.String())
+
+	assert.Panics(t, func() { r.NewGaugeVec("test_running", "again") })
+	assert.Panics(t, func() { r.NewGaugeVec("bad-name", "") })
+	assert.Panics(t, func() { r.NewHistogramVec("test_h", "", nil, "le") })
+	assert.Panics(t, func() { runs.Inc("only-dag") })
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Total.", "dag").Inc("a")
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contentType, resp.Header.Get("Content-Type"))
+	b, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	assert.Contains(t, string(b), `test_total{dag="a"} 1`)
+
+	resp, err = http.Post(server.URL, "text/plain", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
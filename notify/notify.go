@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"context"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+var (
+	_ Notifier = &memNotifier{}
+)
+
+// ErrClosed is returned when publishing to or subscribing a closed notifier
+var ErrClosed = errors.New("notifier closed")
+
+/**
+ * Notifier delivers the payloads published to a channel to the subscribers of the channel,
+ * including the ones of the other engines sharing the notifier, e.g. through PostgreSQL LISTEN/NOTIFY.
+ * The delivery is best effort, a payload published while a subscriber is disconnected may be lost.
+ */
+type Notifier interface {
+	/**
+	 * Publish sends the payload to the subscribers of the channel
+	 */
+	Publish(ctx context.Context, channel string, payload []byte) error
+	/**
+	 * Subscribe calls handler with the payloads published to the channel until cancel is called,
+	 * handler is called one at a time in publishing order, so it should not block.
+	 */
+	Subscribe(channel string, handler func(payload []byte)) (cancel func(), err error)
+}
+
+// subscriberQueueSize is the amount of the payloads buffered for a subscriber of the memory notifier
+const subscriberQueueSize = 1024
+
+type memSubscriber struct {
+	queue   chan []byte
+	handler func(payload []byte)
+	exitCh  chan struct{}
+}
+
+/**
+ * memNotifier delivers the payloads within the process,
+ * the engines sharing a memory store can share it as well.
+ */
+type memNotifier struct {
+	mu          sync.Mutex
+	closed      bool
+	nextID      int
+	subscribers map[string]map[int]*memSubscriber
+}
+
+// NewMemNotifier creates a notifier delivering the payloads within the process
+func NewMemNotifier() Notifier {
+	return &memNotifier{subscribers: make(map[string]map[int]*memSubscriber)}
+}
+
+func (n *memNotifier) Publish(ctx context.Context, channel string, payload []byte) error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	subscribers := make([]*memSubscriber, 0, len(n.subscribers[channel]))
+	for _, sub := range n.subscribers[channel] {
+		subscribers = append(subscribers, sub)
+	}
+	n.mu.Unlock()
+
+	for _, sub := range subscribers {
+		select {
+		case sub.queue <- payload:
+		case <-sub.exitCh:
+			// cancelled in the meantime
+		case <-ctx.Done():
+			return errors.Trace(ctx.Err())
+		}
+	}
+	return nil
+}
+
+func (n *memNotifier) Subscribe(channel string, handler func(payload []byte)) (func(), error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &memSubscriber{
+		queue:   make(chan []byte, subscriberQueueSize),
+		handler: handler,
+		exitCh:  make(chan struct{}),
+	}
+	id := n.nextID
+	n.nextID++
+	if n.subscribers[channel] == nil {
+		n.subscribers[channel] = make(map[int]*memSubscriber)
+	}
+	n.subscribers[channel][id] = sub
+
+	go func() {
+		for {
+			select {
+			case <-sub.exitCh:
+				return
+			case payload := <-sub.queue:
+				sub.handler(payload)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			n.mu.Lock()
+			delete(n.subscribers[channel], id)
+			n.mu.Unlock()
+			close(sub.exitCh)
+		})
+	}, nil
+}
+
+// Close stops delivering to all of the subscribers
+func (n *memNotifier) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil
+	}
+	n.closed = true
+	for _, subscribers := range n.subscribers {
+		for _, sub := range subscribers {
+			close(sub.exitCh)
+		}
+	}
+	n.subscribers = nil
+	return nil
+}
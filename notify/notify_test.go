@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type received struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (r *received) handle(payload []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, string(payload))
+}
+
+func (r *received) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.payloads...)
+}
+
+func TestMemNotifier(t *testing.T) {
+	ctx := context.Background()
+	n := NewMemNotifier()
+
+	r1, r2, other := &received{}, &received{}, &received{}
+	cancel1, err := n.Subscribe("ch", r1.handle)
+	assert.Nil(t, err)
+	_, err = n.Subscribe("ch", r2.handle)
+	assert.Nil(t, err)
+	_, err = n.Subscribe("other", other.handle)
+	assert.Nil(t, err)
+
+	assert.Nil(t, n.Publish(ctx, "ch", []byte("1")))
+	assert.Nil(t, n.Publish(ctx, "ch", []byte("2")))
+	assert.Eventually(t, func() bool {
+		return len(r1.get()) == 2 && len(r2.get()) == 2
+	}, time.Second, time.Millisecond)
+	// in publishing order
+	assert.Equal(t, []string{"1", "2"}, r1.get())
+	assert.Empty(t, other.get())
+
+	cancel1()
+	cancel1()
+	assert.Nil(t, n.Publish(ctx, "ch", []byte("3")))
+	assert.Eventually(t, func() bool {
+		return len(r2.get()) == 3
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 2, len(r1.get()))
+
+	assert.Nil(t, n.(*memNotifier).Close())
+	assert.Equal(t, ErrClosed, n.Publish(ctx, "ch", []byte("4")))
+	_, err = n.Subscribe("ch", r1.handle)
+	assert.Equal(t, ErrClosed, err)
+}
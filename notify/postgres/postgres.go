@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/warriorguo/workflow/notify"
+	"github.com/warriorguo/workflow/types"
+)
+
+var (
+	_ notify.Notifier = &pgNotifier{}
+)
+
+const (
+	// MaxPayloadSize is the limit of PostgreSQL on the NOTIFY payloads
+	MaxPayloadSize = 8000
+
+	minReconnectInterval = 100 * time.Millisecond
+	maxReconnectInterval = 10 * time.Second
+)
+
+// pgNotifier implements notify.Notifier with PostgreSQL LISTEN/NOTIFY,
+// it listens on a connection of its own, which is reconnected once lost.
+type pgNotifier struct {
+	db       *sql.DB
+	listener *pq.Listener
+
+	mu          sync.Mutex
+	closed      bool
+	nextID      int
+	subscribers map[string]map[int]func(payload []byte)
+
+	exitCh chan struct{}
+	logger types.Logger
+}
+
+// Option configures the notifier created by NewPostgresNotifier
+type Option func(n *pgNotifier)
+
+// WithLogger sets the logger of the connection events, the logrus standard logger by default,
+// e.g. the same logger as the engine given by types.WithLogger
+func WithLogger(logger types.Logger) Option {
+	return func(n *pgNotifier) {
+		n.logger = logger
+	}
+}
+
+// NewPostgresNotifier creates a notifier on the database of the connection string,
+// e.g. the DSN() of the postgres store config
+func NewPostgresNotifier(dsn string, opts ...Option) (notify.Notifier, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to open postgres connection")
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, errors.Annotatef(err, "failed to ping postgres")
+	}
+
+	n := &pgNotifier{
+		db:          db,
+		subscribers: make(map[string]map[int]func(payload []byte)),
+		exitCh:      make(chan struct{}),
+		logger:      types.NewLogrusLogger(logrus.StandardLogger()),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	n.listener = pq.NewListener(dsn, minReconnectInterval, maxReconnectInterval, n.onEvent)
+	go n.dispatch()
+	return n, nil
+}
+
+func (n *pgNotifier) onEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		n.logger.Warnf("postgres notifier disconnected: %v", err)
+	case pq.ListenerEventReconnected:
+		n.logger.Infof("postgres notifier reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		n.logger.Errorf("postgres notifier failed to connect: %v", err)
+	}
+}
+
+// dispatch calls the handlers with the notifications until the listener closed
+func (n *pgNotifier) dispatch() {
+	defer close(n.exitCh)
+	for notification := range n.listener.Notify {
+		// nil after reconnecting, the notifications in between are lost
+		if notification == nil {
+			continue
+		}
+
+		n.mu.Lock()
+		handlers := make([]func(payload []byte), 0, len(n.subscribers[notification.Channel]))
+		for _, handler := range n.subscribers[notification.Channel] {
+			handlers = append(handlers, handler)
+		}
+		n.mu.Unlock()
+
+		for _, handler := range handlers {
+			handler([]byte(notification.Extra))
+		}
+	}
+}
+
+// Publish sends the payload with pg_notify, it is delivered once the transaction of the statement commits
+func (n *pgNotifier) Publish(ctx context.Context, channel string, payload []byte) error {
+	if len(payload) >= MaxPayloadSize {
+		return errors.NotValidf("payload of %d bytes", len(payload))
+	}
+	n.mu.Lock()
+	closed := n.closed
+	n.mu.Unlock()
+	if closed {
+		return notify.ErrClosed
+	}
+
+	_, err := n.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, string(payload))
+	if err != nil {
+		return errors.Annotatef(err, "failed to notify channel=%s", channel)
+	}
+	return nil
+}
+
+// Subscribe listens on the channel for its first subscriber
+func (n *pgNotifier) Subscribe(channel string, handler func(payload []byte)) (func(), error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return nil, notify.ErrClosed
+	}
+
+	if len(n.subscribers[channel]) == 0 {
+		if err := n.listener.Listen(channel); err != nil && err != pq.ErrChannelAlreadyOpen {
+			return nil, errors.Annotatef(err, "failed to listen channel=%s", channel)
+		}
+		n.subscribers[channel] = make(map[int]func(payload []byte))
+	}
+	id := n.nextID
+	n.nextID++
+	n.subscribers[channel][id] = handler
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			delete(n.subscribers[channel], id)
+			if len(n.subscribers[channel]) > 0 || n.closed {
+				return
+			}
+			delete(n.subscribers, channel)
+			if err := n.listener.Unlisten(channel); err != nil {
+				n.logger.Errorf("failed to unlisten channel=%s: %v", channel, err)
+			}
+		})
+	}, nil
+}
+
+// Close closes the listener and the database connection
+func (n *pgNotifier) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	n.mu.Unlock()
+
+	err := n.listener.Close()
+	<-n.exitCh
+	if cerr := n.db.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Trace(err)
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/notify"
+	"github.com/warriorguo/workflow/types"
+)
+
+// getTestDSN returns the connection string of the test database,
+// the same environment variables as the postgres store tests override the defaults
+func getTestDSN() string {
+	get := func(key, value string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return value
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		get("POSTGRES_HOST", "localhost"), get("POSTGRES_PORT", "5432"), get("POSTGRES_USER", "postgres"),
+		get("POSTGRES_PASSWORD", "postgres"), get("POSTGRES_DB", "workflow"))
+}
+
+// skipIfNoPostgres skips the test if PostgreSQL is not available
+func skipIfNoPostgres(t *testing.T) notify.Notifier {
+	n, err := NewPostgresNotifier(getTestDSN())
+	if err != nil {
+		t.Skipf("PostgreSQL not available: %v", err)
+		return nil
+	}
+	return n
+}
+
+func TestPostgresNotifier(t *testing.T) {
+	n := skipIfNoPostgres(t)
+	if n == nil {
+		return
+	}
+	defer n.(*pgNotifier).Close()
+
+	// another notifier stands for another process
+	other, err := NewPostgresNotifier(getTestDSN())
+	assert.Nil(t, err)
+	defer other.(*pgNotifier).Close()
+
+	payloads := make(chan string, 10)
+	cancel, err := n.Subscribe("workflow_test", func(payload []byte) {
+		payloads <- string(payload)
+	})
+	assert.Nil(t, err)
+	defer cancel()
+
+	ctx := context.Background()
+	assert.Nil(t, other.Publish(ctx, "workflow_test", []byte("hello")))
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, "hello", payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("notification not received")
+	}
+
+	err = other.Publish(ctx, "workflow_test", []byte(strings.Repeat("a", MaxPayloadSize)))
+	assert.True(t, errors.Is(err, errors.NotValid))
+}
+
+// warnLogger keeps the warnings, the other levels are discarded
+type warnLogger struct {
+	types.Logger
+	warnings []string
+}
+
+func (l *warnLogger) Warnf(format string, args ...any) {
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestPostgresNotifier_Logger(t *testing.T) {
+	logger := &warnLogger{Logger: types.NewNopLogger()}
+	n := &pgNotifier{}
+	WithLogger(logger)(n)
+
+	n.onEvent(pq.ListenerEventDisconnected, errors.New("connection reset"))
+	n.onEvent(pq.ListenerEventReconnected, nil)
+	assert.Equal(t, []string{"postgres notifier disconnected: connection reset"}, logger.warnings)
+}
@@ -89,21 +89,36 @@ func (dt *dagExecutePlan) generateRuntime(gl *globalVertex, parentDAGPath, entry
 	 * node1 would be one of the node of this DAG
 	 * So after entrypoint.Next(), the entrypoint comes to `node1`, which can used for address the node
 	 */
-	entrypoint = entrypoint.Next()
-	/**
-	 * dagPath on the other side stands for the path of this DAG
-	 */
-	dagPath := parentDAGPath.AddString(dt.Name)
+	return dt.generateDAGRuntime(gl, parentDAGPath.AddString(dt.Name), entrypoint.Next())
+}
 
+/**
+ * generateDAGRuntime generates the runtime of the DAG located at dagPath,
+ * dagPath consists of the vertex names, so it is the same as the execute path of flowContext.
+ * entrypoint is relative to this DAG, the first one of it is the vertex to start with.
+ */
+func (dt *dagExecutePlan) generateDAGRuntime(gl *globalVertex, dagPath, entrypoint utils.Path) (*dagRuntime, error) {
 	rt := newDAGRuntime(dagPath)
 	rt.name = dt.Name
 
+	entrypointVertex, exists := entrypoint.First()
+	if !exists {
+		entrypointVertex = dt.StartVertex
+	} else if _, exists := dt.Vertex[entrypointVertex]; !exists {
+		return nil, errors.NotFoundf("vertex %s in %v", entrypointVertex, dagPath)
+	}
+
 	var (
 		delayHandlers = make([]delayVisitHandler, 0, len(dt.Vertex))
 		rcMap         = make(map[string]runContext)
 	)
 	for vertex, info := range dt.Vertex {
-		rc, delayVisit, err := dt.generateRunContext(gl, vertex, info, dt.Links[vertex], dagPath, entrypoint)
+		// only the entrypoint vertex goes into the rest of the entrypoint
+		var vertexEntrypoint utils.Path
+		if vertex == entrypointVertex {
+			vertexEntrypoint = entrypoint.Next()
+		}
+		rc, delayVisit, err := dt.generateRunContext(gl, vertex, info, dt.Links[vertex], dagPath, vertexEntrypoint)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
@@ -118,12 +133,6 @@ func (dt *dagExecutePlan) generateRuntime(gl *globalVertex, parentDAGPath, entry
 		}
 	}
 
-	exists := false
-	entrypointVertex := ""
-	if entrypointVertex, exists = entrypoint.First(); !exists {
-		entrypointVertex = dt.StartVertex
-	}
-
 	if rt.runningRC, exists = rcMap[entrypointVertex]; !exists {
 		return nil, errors.NotFoundf("can not find rc:%v", entrypointVertex)
 	}
@@ -188,7 +197,7 @@ func (dt *dagExecutePlan) generateRunContext(gl *globalVertex, vertex string, in
 	}
 
 	if info.Type == vertexDAG {
-		dr, err := info.DAG.generateRuntime(gl, path, entrypointPath)
+		dr, err := info.DAG.generateDAGRuntime(gl, path.AddString(vertex), entrypointPath)
 		if err != nil {
 			return nil, nil, errors.Trace(err)
 		}
@@ -206,5 +215,8 @@ func (dt *dagExecutePlan) generateRunContext(gl *globalVertex, vertex string, in
 		}, nil
 	}
 
+	if len(entrypointPath) > 0 {
+		return nil, nil, errors.NotValidf("entrypoint %v goes beyond the node %s", entrypointPath, vertex)
+	}
 	return dt.generateNodeRunContext(v, vertex, info, nextVertex, path)
 }
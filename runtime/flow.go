@@ -19,7 +19,23 @@ func NewFlowEngine(store store.Store, opts *types.FlowOptions) types.FlowEngine
 type flow struct {
 	flowExecute
 
-	gl *globalVertex
+	opts *types.FlowOptions
+	gl   *globalVertex
+
+	idempotencyMu sync.Mutex
+
+	gcMu       sync.Mutex
+	gcReportMu sync.Mutex
+	gcReport   *types.GCReport
+	gcExitCh   chan struct{}
+
+	instanceID string
+	// nil if there is no notifier
+	control *controlNotifier
+
+	// nil if lease is disabled
+	leases      *leaseKeeper
+	leaseExitCh chan struct{}
 
 	dagMu       sync.Mutex
 	dagEntities map[string]*dagEntity
@@ -27,16 +43,50 @@ type flow struct {
 
 func newFlow(store store.Store, opts *types.FlowOptions) *flow {
 	f := &flow{}
+	f.opts = opts
+	f.observer = f
 	f.ctx, f.cancel = context.WithCancel(opts.Ctx)
 	f.store = store
-	f.running = true
-	f.batchRunner = newBatchRunner(opts.MaxNodeConcurrency, opts.TaskRunAsync)
+	f.codec = opts.DataCodec
+	if f.codec == nil {
+		f.codec = types.NewJSONCodec()
+	}
+	f.redaction = opts.Redaction
+	f.logger = opts.Logger
+	if f.logger == nil {
+		f.logger = defaultLogger()
+	}
+	f.tracer = opts.Tracer
+	f.metrics = newFlowMetrics()
+	listeners := append([]types.EventListenerConfig{}, opts.EventListeners...)
+	f.events = newEventDispatcher(append(listeners, types.EventListenerConfig{Listener: f.metrics.observe}), f.logger)
+	if f.blobs = newBlobOffloader(opts, f.codec); f.blobs != nil {
+		f.codec = blobCodec{DataCodec: f.codec, offloader: f.blobs}
+	}
+	f.running.Store(true)
+	f.batchRunner = newBatchRunner(opts.MaxNodeConcurrency, opts.TaskRunAsync, newFairScheduler(opts), f.metrics)
 	f.concurrency = opts.MaxNodeConcurrency
 	f.gl = newGlobalVertex()
 	f.dagEntities = make(map[string]*dagEntity)
+	f.instanceID = opts.InstanceID
+	if f.instanceID == "" {
+		f.instanceID = defaultInstanceID()
+	}
+	if opts.EnableLease {
+		f.leases = newLeaseKeeper(store, f.instanceID, opts.LeaseTTL)
+	}
+	if err := f.subscribeControl(); err != nil {
+		f.logger.Errorf("failed to subscribe control messages, the controls of the requests run by the others are not routed: %v", err)
+	}
 
 	if opts.AutoStart {
 		f.asyncRun()
+		if opts.GCInterval > 0 && hasRetention(opts) {
+			f.gcLoop()
+		}
+		if f.leases != nil && opts.LeaseRenewInterval > 0 {
+			f.leaseLoop()
+		}
 	}
 	return f
 }
@@ -48,7 +98,7 @@ func (f *flow) asyncRun() {
 		f.exitCh = make(chan struct{})
 		close(readyCh)
 
-		for f.running {
+		for f.running.Load() {
 			f.runOnce()
 			time.Sleep(0)
 		}
@@ -58,7 +108,7 @@ func (f *flow) asyncRun() {
 }
 
 func (f *flow) RegisterDAG(name string, handler types.DAGHandler) error {
-	if !f.running {
+	if !f.running.Load() {
 		return errors.MethodNotAllowedf("not running")
 	}
 	dag := newDAGEntity(name, f)
@@ -89,7 +139,11 @@ func (f *flow) RenderRequestStatus(ctx context.Context, requestID string) (strin
 }
 
 func (f *flow) GetRequestStatus(ctx context.Context, requestID string) (*types.RequestStatus, error) {
-	return f.getExecutePlanStatus(requestID)
+	return f.getRequestStatus(ctx, requestID)
+}
+
+func (f *flow) GetSchedulingStats() ([]*types.GroupStats, error) {
+	return f.batchRunner.scheduler.stats(), nil
 }
 
 func (f *flow) ListDAGNames() ([]string, error) {
@@ -100,16 +154,16 @@ func (f *flow) ListDAGNames() ([]string, error) {
 	return names, nil
 }
 
-func (fe *flowExecute) PauseRequest(ctx context.Context, requestID string) error {
-	return fe.setExecutePlanStatus(requestID, types.Paused)
+func (f *flow) PauseRequest(ctx context.Context, requestID string) error {
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlPause})
 }
 
-func (fe *flowExecute) ResumeRequest(ctx context.Context, requestID string) error {
-	return fe.setExecutePlanStatus(requestID, types.Retrying)
+func (f *flow) ResumeRequest(ctx context.Context, requestID string) error {
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlResume})
 }
 
-func (fe *flowExecute) TerminateRequest(ctx context.Context, requestID string) error {
-	return fe.setExecutePlanStatus(requestID, types.Fatal)
+func (f *flow) TerminateRequest(ctx context.Context, requestID string) error {
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlTerminate})
 }
 
 func (f *flow) getDAG(name string) (*dagEntity, bool) {
@@ -123,6 +177,11 @@ func (f *flow) reloadPlans(ctx context.Context) (map[string]error, error) {
 	errs := make(map[string]error, 0)
 	err := f.store.List(ctx, RunContextPath, func(requestID string) bool {
 		err := f.rerunPlan(ctx, requestID)
+		if errors.Is(err, errors.Forbidden) || errors.Is(err, types.ErrLeaseHeld) {
+			// terminated ones keep the context for operations, but never rerun,
+			// and the ones held by the other instances are left to them
+			return true
+		}
 		errs[requestID] = errors.Trace(err)
 		return true
 	})
@@ -136,52 +195,131 @@ func (f *flow) rerunPlan(ctx context.Context, requestID string) error {
 	if f.batchRunner.exists(requestID) {
 		return errors.AlreadyExistsf("request already running: %s", requestID)
 	}
+	if err := f.checkLease(ctx, requestID); err != nil {
+		return errors.Trace(err)
+	}
+	// the run context is loaded after the lease claimed, otherwise the previous owner may finish
+	// the request in the meantime and release the lease, then it would run again from the stale context
+	if err := f.acquireLease(ctx, requestID); err != nil {
+		return errors.Trace(err)
+	}
 
 	dag, reRC, err := f.loadPlan(ctx, requestID)
+	if err == nil && reRC == nil {
+		err = errors.NotFoundf("rerun context: %s", requestID)
+	}
+	if err == nil && reRC.Status.IsTerminal() {
+		err = errors.Forbiddenf("request %s is terminated with status %v", requestID, reRC.Status)
+	}
 	if err != nil {
+		f.releaseLease(ctx, requestID)
 		return errors.Trace(err)
 	}
-	if reRC == nil {
-		return errors.NotFoundf("rerun context: %s", requestID)
+	meta := reRC.Meta
+	if meta == nil {
+		// the rerun context saved before request meta introduced
+		meta = newRequestMeta(dag.Name, types.NewRunOptions())
+	}
+	status := types.Pending
+	if reRC.Status == types.Paused && !reRC.Suspended {
+		// paused by the operator, it waits for resuming on whichever engine reloads it
+		status = types.Paused
 	}
-	return f.launchDAG(ctx, dag, requestID, reRC.Data, reRC.Entrypoint, nil)
+	return f.launchDAG(ctx, dag, requestID, meta, reRC.Data, reRC.Entrypoint, reRC.Override, status, func() error {
+		appendHistory(ctx, f.store, f.requestLogger(requestID), requestID, &types.HistoryEvent{
+			Type:     types.EventRequestReloaded,
+			Vertex:   reRC.Entrypoint.String(),
+			Status:   reRC.Status,
+			Operator: types.OperatorFromContext(ctx),
+		})
+		return nil
+	})
 }
 
-func (f *flow) RunDAG(ctx context.Context, dagName string, requestID string, params types.Data) error {
-	if !f.running {
-		return errors.MethodNotAllowedf("not running")
+func (f *flow) RunDAG(ctx context.Context, dagName string, requestID string, params types.Data, opts ...types.RunOption) error {
+	result, err := f.SubmitDAG(ctx, dagName, requestID, params, opts...)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if result.Duplicated {
+		return errors.AlreadyExistsf("request id: %s", result.RequestID)
+	}
+	return nil
+}
+
+func (f *flow) SubmitDAG(ctx context.Context, dagName string, requestID string, params types.Data, opts ...types.RunOption) (*types.SubmitResult, error) {
+	if !f.running.Load() {
+		return nil, errors.MethodNotAllowedf("not running")
 	}
 	dag, exists := f.getDAG(dagName)
 	if !exists {
-		return errors.NotFound
+		return nil, errors.NotFound
 	}
-	if f.hasExecutePlan(requestID) {
-		return errors.AlreadyExistsf("request id: %s", requestID)
+
+	runOpts := types.NewRunOptions(opts...)
+	if runOpts.IdempotencyKey == "" {
+		runOpts.IdempotencyKey = requestID
 	}
-	err := f.launchDAG(ctx, &dag.dagExecutePlan, requestID, params, utils.NewPath(), func() error {
-		return errors.Trace(f.savePlan(ctx, requestID, &dag.dagExecutePlan))
+	result, err := f.checkIdempotency(ctx, runOpts.IdempotencyKey, dagName, requestID, params)
+	if result != nil || err != nil {
+		return result, err
+	}
+
+	meta := newRequestMeta(dagName, runOpts)
+	err = f.launchDAG(ctx, &dag.dagExecutePlan, requestID, meta, params, utils.NewPath(), nil, types.Pending, func() error {
+		if err := f.savePlan(ctx, requestID, &dag.dagExecutePlan); err != nil {
+			return errors.Trace(err)
+		}
+		appendHistory(ctx, f.store, f.requestLogger(requestID), requestID, &types.HistoryEvent{
+			Type:     types.EventRequestStarted,
+			Status:   types.Pending,
+			Operator: types.OperatorFromContext(ctx),
+		})
+		return nil
 	})
 	if err != nil {
 		if lerr := f.removePlan(context.Background(), requestID); lerr != nil {
 			err = errors.Wrapf(err, lerr, "remove plan %s failed after launch DAG", requestID)
 		}
-		return errors.Trace(err)
+		if lerr := f.removeRequestInfo(context.Background(), requestID); lerr != nil {
+			err = errors.Wrapf(err, lerr, "remove request info %s failed after launch DAG", requestID)
+		}
+		if lerr := f.removeIdempotency(context.Background(), runOpts.IdempotencyKey); lerr != nil {
+			err = errors.Wrapf(err, lerr, "remove idempotency key %s failed after launch DAG", runOpts.IdempotencyKey)
+		}
+		return nil, errors.Trace(err)
 	}
-	return nil
+	f.events.emit(&types.LifecycleEvent{
+		Type:      types.LifecycleSubmitted,
+		RequestID: requestID,
+		DAGName:   dagName,
+		Tenant:    runOpts.Tenant,
+		Status:    types.Pending,
+	})
+	return &types.SubmitResult{
+		RequestID: requestID,
+		Status:    &types.RequestStatus{Status: types.Pending},
+	}, nil
 }
 
-func (f *flow) launchDAG(ctx context.Context, dag *dagExecutePlan, requestID string, params types.Data,
-	entrypoint utils.Path, preRunHandler func() error) error {
+func (f *flow) launchDAG(ctx context.Context, dag *dagExecutePlan, requestID string, meta *requestMeta, params types.Data,
+	entrypoint utils.Path, override *types.VertexOverride, status types.StatusType, preRunHandler func() error) error {
+	if err := f.acquireLease(ctx, requestID); err != nil {
+		return errors.Trace(err)
+	}
 	dr, err := dag.generateRuntime(f.gl, utils.NewPath(), entrypoint)
 	if err != nil {
+		f.releaseLease(ctx, requestID)
 		return errors.Trace(err)
 	}
 	if preRunHandler != nil {
 		if err := preRunHandler(); err != nil {
+			f.releaseLease(ctx, requestID)
 			return errors.Trace(err)
 		}
 	}
-	if err := f.startExecutePlan(requestID, dr, params); err != nil {
+	if err := f.startExecutePlan(ctx, requestID, meta, dr, params, override, status); err != nil {
+		f.releaseLease(ctx, requestID)
 		return errors.Trace(err)
 	}
 
@@ -189,18 +327,37 @@ func (f *flow) launchDAG(ctx context.Context, dag *dagExecutePlan, requestID str
 }
 
 func (f *flow) Close(ctx context.Context) error {
-	if !f.running {
-		return nil
+	if !f.running.CompareAndSwap(true, false) {
+		return errors.Trace(store.Flush(ctx, f.store))
 	}
 
 	f.cancel()
-	f.running = false
 
 	if f.exitCh != nil {
 		<-f.exitCh
 	}
+	if f.gcExitCh != nil {
+		<-f.gcExitCh
+	}
+	if f.leaseExitCh != nil {
+		<-f.leaseExitCh
+	}
 
-	return f.batchRunner.stopWait(ctx)
+	f.unsubscribeControl()
+	requestIDs := f.batchRunner.keys()
+	err := f.batchRunner.stopWait(ctx)
+	f.events.close(ctx)
+	// let the others take over right away
+	for _, requestID := range requestIDs {
+		f.releaseLease(ctx, requestID)
+	}
+	if len(requestIDs) > 0 {
+		f.notifyReleased(ctx)
+	}
+	if ferr := store.Flush(ctx, f.store); err == nil {
+		err = errors.Trace(ferr)
+	}
+	return err
 }
 
 func (f *flow) RunOnce() error {
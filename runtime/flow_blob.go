@@ -0,0 +1,183 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/blob"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+// blobValueKey is the key of the value in the Data saved as a blob, so that the value is encoded by the codec
+const blobValueKey = "value"
+
+/**
+ * blobOffloader moves the large top-level values of the Data to the blob store,
+ * the values are keyed by their contents, so a value kept by the records of many vertexes is saved once.
+ */
+type blobOffloader struct {
+	store     blob.Store
+	threshold int
+	codec     types.DataCodec
+}
+
+/**
+ * newBlobOffloader returns nil if there is no blob store
+ */
+func newBlobOffloader(opts *types.FlowOptions, codec types.DataCodec) *blobOffloader {
+	if opts.BlobStore == nil {
+		return nil
+	}
+	return &blobOffloader{store: opts.BlobStore, threshold: opts.BlobThreshold, codec: codec}
+}
+
+func (o *blobOffloader) resolve(ref *types.BlobRef) (any, error) {
+	b, err := o.store.Get(context.Background(), ref.RequestID, ref.Key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	d := types.Data{}
+	if err := utils.Unserialize(b, &d); err != nil {
+		return nil, errors.Annotatef(err, "blob %s of %s", ref.Key, ref.RequestID)
+	}
+	decoded, err := o.codec.Decode(d)
+	if err != nil {
+		return nil, errors.Annotatef(err, "blob %s of %s", ref.Key, ref.RequestID)
+	}
+	return decoded[blobValueKey], nil
+}
+
+/**
+ * offload returns a copy of the data with the values larger than the threshold replaced by BlobRefs,
+ * or the data itself if nothing is offloaded.
+ */
+func (o *blobOffloader) offload(ctx context.Context, requestID string, d types.Data) (types.Data, error) {
+	if o == nil {
+		return d, nil
+	}
+
+	var offloaded types.Data
+	for key, value := range d {
+		if _, ok := value.(*types.BlobRef); ok {
+			continue
+		}
+		encoded, err := o.codec.Encode(types.Data{blobValueKey: value})
+		if err != nil {
+			return nil, errors.Annotatef(err, "key %s", key)
+		}
+		b, err := utils.Serialize(encoded)
+		if err != nil {
+			return nil, errors.Annotatef(err, "key %s", key)
+		}
+		if len(b) <= o.threshold {
+			continue
+		}
+
+		blobKey := blob.Key(b)
+		if err := o.store.Put(ctx, requestID, blobKey, b); err != nil {
+			return nil, errors.Annotatef(err, "key %s", key)
+		}
+		if offloaded == nil {
+			offloaded = make(types.Data, len(d))
+			for k, v := range d {
+				offloaded[k] = v
+			}
+		}
+		offloaded[key] = types.NewBlobRef(requestID, blobKey, len(b), o.resolve)
+	}
+	if offloaded == nil {
+		return d, nil
+	}
+	return offloaded, nil
+}
+
+/**
+ * bind turns the top-level values decoded from the BlobRefs back to the references resolved by the offloader
+ */
+func (o *blobOffloader) bind(d types.Data) types.Data {
+	for key, value := range d {
+		if ref, ok := types.ParseBlobRef(value, o.resolve); ok {
+			d[key] = ref
+		}
+	}
+	return d
+}
+
+/**
+ * blobCodec binds the BlobRefs decoded by the codec, the BlobRefs are encoded as they are
+ */
+type blobCodec struct {
+	types.DataCodec
+	offloader *blobOffloader
+}
+
+func (c blobCodec) Decode(d types.Data) (types.Data, error) {
+	decoded, err := c.DataCodec.Decode(d)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return c.offloader.bind(decoded), nil
+}
+
+/**
+ * offloadData offloads the large values of the data, they are kept inline if the blob store fails
+ */
+func (r *contextRunner) offloadData(ctx context.Context, d types.Data) types.Data {
+	offloaded, _ := r.tryOffloadData(ctx, d)
+	return offloaded
+}
+
+/**
+ * tryOffloadData is offloadData telling whether the values are offloaded, false if the blob store fails
+ */
+func (r *contextRunner) tryOffloadData(ctx context.Context, d types.Data) (types.Data, bool) {
+	offloaded, err := r.blobs.offload(ctx, r.fc.requestID, d)
+	if err != nil {
+		r.logger.Errorf("failed to offload data, kept inline: %v", err)
+		return d, false
+	}
+	return offloaded, true
+}
+
+/**
+ * offloadCurrentData offloads the current data only if it changed since offloaded last time,
+ * so that the values are not measured again on every save.
+ */
+func (r *contextRunner) offloadCurrentData(ctx context.Context) {
+	if r.dataOffloaded {
+		return
+	}
+	r.currentData, r.dataOffloaded = r.tryOffloadData(ctx, r.currentData)
+}
+
+/**
+ * redactedRecord returns the record of the current vertex redacted by the policy,
+ * the values loaded from the blobs to redact are offloaded again, so the blobs kept for the run context never show up.
+ */
+func (r *contextRunner) redactedRecord(ctx context.Context) *types.NodeTraceRecord {
+	record := r.fc.redaction.Redact(r.fc.rcRecord)
+	if record == r.fc.rcRecord {
+		return record
+	}
+	record.Input = r.offloadData(ctx, record.Input)
+	record.Output = r.offloadData(ctx, record.Output)
+	return record
+}
+
+/**
+ * removeBlobs removes the blobs of the request if there is a blob store
+ */
+func (f *flow) removeBlobs(ctx context.Context, requestID string) error {
+	if f.blobs == nil {
+		return nil
+	}
+	removed, err := f.blobs.store.RemoveRequest(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if removed > 0 {
+		f.requestLogger(requestID).Debugf("%d blobs removed", removed)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/blob"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type reportDAG struct {
+	report string
+	read   string
+}
+
+func (d *reportDAG) generate(ctx types.Context, input types.Data) (types.Data, error) {
+	input.Set("report", d.report)
+	return input, nil
+}
+
+func (d *reportDAG) summarize(ctx types.Context, input types.Data) (types.Data, error) {
+	d.read, _ = input.GetString("report")
+	input.Set("length", len(d.read))
+	return input, nil
+}
+
+func (d *reportDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("generate", d.generate); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("summarize", d.summarize); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("generate", "summarize"))
+}
+
+func TestBlobOffload(t *testing.T) {
+	s := mem.NewMemStore()
+	blobs, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	opts := newOptions()
+	types.WithBlobStore(blobs, 1024)(opts)
+	types.WithRetention(types.RetentionPolicy{Finished: 1})(opts)
+	flow := newFlow(s, opts)
+
+	d := &reportDAG{report: strings.Repeat("x", 4096)}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"small": "s"}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	// resolved lazily by the getter of the next node
+	assert.Equal(t, d.report, d.read)
+
+	// the large value is not copied into the store
+	err = store.Scan(context.Background(), s, recordSavePath("req-1"), "", func(key string, b []byte) bool {
+		assert.NotContains(t, string(b), d.report[:1024], key)
+		return true
+	})
+	assert.Nil(t, err)
+	b, err := s.Get(context.Background(), SummaryPath, "req-1")
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), d.report[:1024])
+
+	result, err := newFlow(s, opts).GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, "s", result.Result["small"])
+	assert.IsType(t, &types.BlobRef{}, result.Result["report"])
+	report, _ := result.Result.GetString("report")
+	assert.Equal(t, d.report, report)
+	length, _ := result.Result.GetInt("length")
+	assert.Equal(t, 4096, length)
+	output := result.NodeTraceData["test.generate"].Output
+	report, _ = output.GetString("report")
+	assert.Equal(t, d.report, report)
+
+	// removed along with the request
+	ref := result.Result["report"].(*types.BlobRef)
+	assert.Nil(t, flow.PurgeRequest(context.Background(), "req-1"))
+	_, err = blobs.Get(context.Background(), "req-1", ref.Key)
+	assert.True(t, errors.IsNotFound(err))
+}
+
+// measureCodec counts the values measured by the offloader, which encodes each of them alone
+type measureCodec struct {
+	types.DataCodec
+	measured int
+}
+
+func (c *measureCodec) Encode(d types.Data) (types.Data, error) {
+	if _, ok := d[blobValueKey]; ok && len(d) == 1 {
+		c.measured++
+	}
+	return c.DataCodec.Encode(d)
+}
+
+func TestBlobOffload_Unchanged(t *testing.T) {
+	blobs, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	codec := &measureCodec{DataCodec: types.NewJSONCodec()}
+	opts := newOptions()
+	types.WithBlobStore(blobs, 1024)(opts)
+	types.WithDataCodec(codec)(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "retry", "req-1", types.Data{"a": "1", "b": "2"}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// saved again without the values changed
+	measured := codec.measured
+	assert.Nil(t, flow.PauseRequest(context.Background(), "req-1"))
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, measured, codec.measured)
+
+	// the patched values are measured
+	assert.Nil(t, flow.PatchRequestData(context.Background(), "req-1", types.Data{"c": "3"}))
+	assert.Equal(t, measured+3, codec.measured)
+}
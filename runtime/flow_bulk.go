@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+)
+
+/**
+ * selectRequests returns the IDs of the requests matching the filter for the bulk operations
+ */
+func (f *flow) selectRequests(ctx context.Context, filter *types.RequestFilter) ([]string, error) {
+	if filter == nil {
+		filter = &types.RequestFilter{}
+	}
+	requestIDs := make([]string, 0)
+	err := f.scanRequestInfo(ctx, filter, func(info *types.RequestInfo) bool {
+		if len(filter.Statuses) == 0 && info.Status.IsTerminal() {
+			return true
+		}
+		requestIDs = append(requestIDs, info.RequestID)
+		return filter.Limit <= 0 || len(requestIDs) < filter.Limit
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return requestIDs, nil
+}
+
+/**
+ * bulkOperate applies the operation on the requests one by one at the rate of the options,
+ * the results of the operated requests are returned along with the error if ctx is done.
+ */
+func (f *flow) bulkOperate(ctx context.Context, filter *types.RequestFilter, opts []types.BulkOption,
+	operate func(ctx context.Context, requestID string) error) (*types.BulkResult, error) {
+	bulkOpts := types.NewBulkOptions(opts...)
+	if bulkOpts.RatePerSecond < 0 {
+		return nil, errors.NotValidf("rate %v", bulkOpts.RatePerSecond)
+	}
+
+	requestIDs, err := f.selectRequests(ctx, filter)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	var interval time.Duration
+	if bulkOpts.RatePerSecond > 0 {
+		interval = time.Duration(float64(time.Second) / bulkOpts.RatePerSecond)
+	}
+
+	result := &types.BulkResult{Results: make([]*types.BulkItemResult, 0, len(requestIDs))}
+	for i, requestID := range requestIDs {
+		if err := ctx.Err(); err != nil {
+			return result, errors.Trace(err)
+		}
+		if i > 0 && interval > 0 {
+			select {
+			case <-ctx.Done():
+				return result, errors.Trace(ctx.Err())
+			case <-time.After(interval):
+			}
+		}
+
+		item := &types.BulkItemResult{RequestID: requestID}
+		if err := operate(ctx, requestID); err != nil {
+			item.Error = err.Error()
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+		result.Results = append(result.Results, item)
+	}
+	return result, nil
+}
+
+func (f *flow) PauseRequests(ctx context.Context, filter *types.RequestFilter, opts ...types.BulkOption) (*types.BulkResult, error) {
+	return f.bulkOperate(ctx, filter, opts, f.PauseRequest)
+}
+
+func (f *flow) ResumeRequests(ctx context.Context, filter *types.RequestFilter, opts ...types.BulkOption) (*types.BulkResult, error) {
+	return f.bulkOperate(ctx, filter, opts, f.ResumeRequest)
+}
+
+func (f *flow) TerminateRequests(ctx context.Context, filter *types.RequestFilter, opts ...types.BulkOption) (*types.BulkResult, error) {
+	return f.bulkOperate(ctx, filter, opts, f.TerminateRequest)
+}
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func TestBulkOperations(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RegisterDAG("count", (&countDAG{}).testDAG))
+
+	for i := 0; i < 4; i++ {
+		region := "east"
+		if i%2 == 1 {
+			region = "west"
+		}
+		assert.Nil(t, flow.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}, types.WithLabel("region", region)))
+	}
+	assert.Nil(t, flow.RunDAG(context.Background(), "count", "count-0", types.Data{}, types.WithLabel("region", "east")))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// the finished count-0 is skipped
+	result, err := flow.PauseRequests(context.Background(), &types.RequestFilter{Labels: map[string]string{"region": "east"}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 0, result.Failed)
+	assert.Equal(t, "retry-0", result.Results[0].RequestID)
+	assert.Equal(t, "retry-2", result.Results[1].RequestID)
+
+	list, err := flow.ListRequests(context.Background(), &types.RequestFilter{Statuses: []types.StatusType{types.Paused}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list.Requests))
+
+	// the finished one fails to be resumed
+	result, err = flow.ResumeRequests(context.Background(), &types.RequestFilter{
+		Statuses: []types.StatusType{types.Paused, types.Finished},
+	}, types.WithRateLimit(50))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, "count-0", result.Results[0].RequestID)
+	assert.NotEmpty(t, result.Results[0].Error)
+
+	// rate limited, canceled before the second one
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err = flow.PauseRequests(ctx, &types.RequestFilter{DAGName: "retry"}, types.WithRateLimit(1))
+	assert.Equal(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.Equal(t, 1, len(result.Results))
+
+	result, err = flow.TerminateRequests(context.Background(), &types.RequestFilter{CurrentVertex: "retry.retry", Limit: 3})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Succeeded)
+
+	list, err = flow.ListRequests(context.Background(), &types.RequestFilter{Statuses: []types.StatusType{types.Fatal}})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(list.Requests))
+}
+
+func TestBulkOperations_Canceled(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+	}
+
+	// not rate limited, canceled by the second operation
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	operated := 0
+	result, err := flow.bulkOperate(ctx, nil, nil, func(ctx context.Context, requestID string) error {
+		operated++
+		if operated == 2 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, errors.Cause(err))
+	assert.Equal(t, 2, operated)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 2, len(result.Results))
+}
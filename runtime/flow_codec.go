@@ -0,0 +1,108 @@
+package runtime
+
+import (
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+)
+
+/**
+ * the helpers below convert the Data in the persisted values with the codec of the options,
+ * the values are copied rather than changed, since the running ones are still in use.
+ */
+
+func encodeOverride(codec types.DataCodec, o *types.VertexOverride) (*types.VertexOverride, error) {
+	if o == nil || o.Output == nil {
+		return o, nil
+	}
+	encoded := *o
+	output, err := codec.Encode(o.Output)
+	if err != nil {
+		return nil, errors.Annotatef(err, "override output of %s", o.Vertex)
+	}
+	encoded.Output = output
+	return &encoded, nil
+}
+
+func decodeOverride(codec types.DataCodec, o *types.VertexOverride) error {
+	if o == nil || o.Output == nil {
+		return nil
+	}
+	output, err := codec.Decode(o.Output)
+	if err != nil {
+		return errors.Annotatef(err, "override output of %s", o.Vertex)
+	}
+	o.Output = output
+	return nil
+}
+
+func encodeRecord(codec types.DataCodec, record *types.NodeTraceRecord) (*types.NodeTraceRecord, error) {
+	if record == nil {
+		return nil, nil
+	}
+	encoded := *record
+	var err error
+	if encoded.Input, err = codec.Encode(record.Input); err != nil {
+		return nil, errors.Annotatef(err, "input of %v", record.Path)
+	}
+	if encoded.Output, err = codec.Encode(record.Output); err != nil {
+		return nil, errors.Annotatef(err, "output of %v", record.Vertex)
+	}
+	if encoded.Override, err = encodeOverride(codec, record.Override); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &encoded, nil
+}
+
+func decodeRecord(codec types.DataCodec, record *types.NodeTraceRecord) error {
+	if record == nil {
+		return nil
+	}
+	var err error
+	if record.Input, err = codec.Decode(record.Input); err != nil {
+		return errors.Annotatef(err, "input of %v", record.Path)
+	}
+	if record.Output, err = codec.Decode(record.Output); err != nil {
+		return errors.Annotatef(err, "output of %v", record.Vertex)
+	}
+	return errors.Trace(decodeOverride(codec, record.Override))
+}
+
+func encodeRerunContext(codec types.DataCodec, reRC *flowRerunContext) (*flowRerunContext, error) {
+	encoded := *reRC
+	var err error
+	if encoded.Data, err = codec.Encode(reRC.Data); err != nil {
+		return nil, errors.Annotatef(err, "data")
+	}
+	if encoded.Override, err = encodeOverride(codec, reRC.Override); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &encoded, nil
+}
+
+func decodeRerunContext(codec types.DataCodec, reRC *flowRerunContext) error {
+	var err error
+	if reRC.Data, err = codec.Decode(reRC.Data); err != nil {
+		return errors.Annotatef(err, "data")
+	}
+	return errors.Trace(decodeOverride(codec, reRC.Override))
+}
+
+func encodeSummary(codec types.DataCodec, summary *types.DAGStatus) (*types.DAGStatus, error) {
+	encoded := *summary
+	var err error
+	if encoded.Result, err = codec.Encode(summary.Result); err != nil {
+		return nil, errors.Annotatef(err, "result")
+	}
+	if encoded.LastVertexRecord, err = encodeRecord(codec, summary.LastVertexRecord); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &encoded, nil
+}
+
+func decodeSummary(codec types.DataCodec, summary *types.DAGStatus) error {
+	var err error
+	if summary.Result, err = codec.Decode(summary.Result); err != nil {
+		return errors.Annotatef(err, "result")
+	}
+	return errors.Trace(decodeRecord(codec, summary.LastVertexRecord))
+}
@@ -0,0 +1,88 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type codecOrder struct {
+	ID    int64
+	Items []string
+}
+
+func newCodecOptions(t *testing.T) *types.FlowOptions {
+	codec := types.NewTaggedCodec()
+	assert.Nil(t, codec.Register("order", codecOrder{}))
+	opts := newOptions()
+	types.WithDataCodec(codec)(opts)
+	return opts
+}
+
+func TestDataCodec(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newCodecOptions(t))
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	created := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	params := types.Data{
+		"valid":   false,
+		"count":   int64(1 << 60),
+		"created": created,
+		"order":   codecOrder{ID: 7, Items: []string{"a"}},
+	}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", params))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// the types are kept by the run context reloaded
+	reloaded := newFlow(s, newCodecOptions(t))
+	data, err := reloaded.GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1<<60), data["count"])
+	assert.Equal(t, created, data["created"])
+	assert.Equal(t, codecOrder{ID: 7, Items: []string{"a"}}, data["order"])
+
+	assert.Nil(t, reloaded.RegisterDAG("test", d.testDAG))
+	errs, err := reloaded.ReloadRequests(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, errs["req-1"])
+	// paused again on the reloaded data
+	assert.Nil(t, reloaded.runOnce())
+	assert.Nil(t, reloaded.PatchRequestData(context.Background(), "req-1", types.Data{"valid": true, "count": int64(3)}))
+	assert.Nil(t, reloaded.ResumeRequest(context.Background(), "req-1"))
+	assert.Nil(t, reloaded.runOnce())
+
+	result, err := newFlow(s, newCodecOptions(t)).GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, int64(3), result.Result["count"])
+	assert.Equal(t, created, result.Result["created"])
+	record := result.NodeTraceData["test.validate"]
+	assert.NotNil(t, record)
+	assert.Equal(t, codecOrder{ID: 7, Items: []string{"a"}}, record.Input["order"])
+}
+
+func TestDataCodec_Compatible(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	params := types.Data{"valid": false, "count": 1, "order": map[string]any{"ID": 7}}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", params))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// the plain JSON persisted by the default codec
+	data, err := newFlow(s, newCodecOptions(t)).GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Data{"valid": false, "count": float64(1), "order": map[string]any{"ID": float64(7)}}, data)
+}
@@ -204,7 +204,7 @@ func TestFlowEntrypoint(t *testing.T) {
 	inputData.Set("test_param2", "black sheep wall")
 	inputData.Set("node1", "food for thought")
 
-	assert.Nil(t, flow.launchDAG(context.Background(), &d.dagExecutePlan, "test-require-id", inputData, utils.NewPath("test", "node2"), nil))
+	assert.Nil(t, flow.launchDAG(context.Background(), &d.dagExecutePlan, "test-require-id", newRequestMeta("test", types.NewRunOptions()), inputData, utils.NewPath("test", "node2"), nil, types.Pending, nil))
 	assert.Nil(t, flow.runOnce())
 	assert.Equal(t, 0, singlef.node1Trigger)
 	assert.Equal(t, 1, singlef.node2Trigger)
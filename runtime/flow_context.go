@@ -6,7 +6,6 @@ import (
 	"time"
 
 	"github.com/juju/errors"
-	log "github.com/sirupsen/logrus"
 	"github.com/warriorguo/workflow/store"
 	"github.com/warriorguo/workflow/types"
 	"github.com/warriorguo/workflow/utils"
@@ -28,20 +27,26 @@ type flowContext struct {
 	context.Context
 
 	store store.Store
+	codec types.DataCodec
 
 	requestID string
+	logger    types.Logger
 
 	depth       int
 	executePath utils.Path
 	rcRecord    *types.NodeTraceRecord
+	redaction   *types.RedactionPolicy
+	// override is the operator decision for the next vertex to run
+	override *types.VertexOverride
 }
 
 func recordSavePath(requestID string) string {
 	return RecordPath + requestID
 }
 
-func newFlowContext(store store.Store, requestID string) *flowContext {
-	return &flowContext{store: store, requestID: requestID}
+func newFlowContext(store store.Store, codec types.DataCodec, requestID string) *flowContext {
+	logger := defaultLogger().WithFields(types.LogFields{types.LogFieldRequestID: requestID})
+	return &flowContext{store: store, codec: codec, requestID: requestID, logger: logger}
 }
 
 func (f *flowContext) GetRequestID() string {
@@ -53,7 +58,7 @@ func (f *flowContext) GetCurrentVertex() string {
 }
 
 func (f *flowContext) startRecord(ctx context.Context, path utils.Path, input types.Data) {
-	log.Debugf("running %v", path)
+	f.logger.WithFields(types.LogFields{types.LogFieldVertex: path.String()}).Debugf("running")
 
 	f.executePath = utils.Path{}
 	f.depth = 0
@@ -62,6 +67,12 @@ func (f *flowContext) startRecord(ctx context.Context, path utils.Path, input ty
 	f.rcRecord.Path = path
 	f.rcRecord.StartTime = time.Now()
 	f.rcRecord.Input = input
+
+	appendHistory(ctx, f.store, f.logger, f.requestID, &types.HistoryEvent{
+		Time:   f.rcRecord.StartTime,
+		Type:   types.EventVertexStarted,
+		Vertex: path.String(),
+	})
 }
 
 func (f *flowContext) endRecord(ctx context.Context, output types.Data, err error) {
@@ -71,20 +82,51 @@ func (f *flowContext) endRecord(ctx context.Context, output types.Data, err erro
 		f.rcRecord.Error = errors.ErrorStack(err)
 	}
 	f.rcRecord.Output = output
-	if err := f.saveRecord(ctx); err != nil {
-		log.Errorf("%s failed to save record: %v", f.requestID, err)
+
+	event := &types.HistoryEvent{
+		Time:   f.rcRecord.EndTime,
+		Type:   types.EventVertexFinished,
+		Vertex: f.executePath.String(),
+	}
+	if err != nil {
+		event.Type = types.EventVertexFailed
+		event.Error = err.Error()
+	}
+	appendHistory(ctx, f.store, f.logger, f.requestID, event)
+}
+
+/**
+ * takeOverride returns the override of the current vertex and marks it in the record,
+ * the override is consumed no matter it matches the current vertex or not.
+ */
+func (f *flowContext) takeOverride() *types.VertexOverride {
+	o := f.override
+	if o == nil {
+		return nil
 	}
+	f.override = nil
+
+	if o.Vertex != f.GetCurrentVertex() {
+		f.Logger().Warnf("drop the override of %s", o.Vertex)
+		return nil
+	}
+	f.rcRecord.Override = o
+	return o
 }
 
-func (f *flowContext) saveRecord(ctx context.Context) error {
-	b, err := utils.Serialize(f.rcRecord)
+/**
+ * recordOp returns the op saving the record redacted, it is committed along with the run context by the runner
+ */
+func (f *flowContext) recordOp(redacted *types.NodeTraceRecord) (store.Op, error) {
+	record, err := encodeRecord(f.codec, redacted)
 	if err != nil {
-		return errors.Trace(err)
+		return store.Op{}, errors.Trace(err)
 	}
-	if err := f.store.Set(ctx, recordSavePath(f.requestID), strings.Join(f.rcRecord.Vertex, "."), b); err != nil {
-		return errors.Trace(err)
+	b, err := utils.Serialize(record)
+	if err != nil {
+		return store.Op{}, errors.Trace(err)
 	}
-	return nil
+	return store.SetOp(recordSavePath(f.requestID), strings.Join(f.rcRecord.Vertex, "."), b), nil
 }
 
 func (f *flowContext) enterDAG(name string) {
@@ -0,0 +1,54 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func (f *flow) GetRequestData(ctx context.Context, requestID string) (types.Data, error) {
+	if cr := f.batchRunner.get(requestID); cr != nil {
+		return cr.getData()
+	}
+
+	// the request is not loaded by this engine
+	b, err := f.store.Get(ctx, RunContextPath, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if b == nil {
+		return nil, errors.NotFoundf("request id: %s", requestID)
+	}
+	reRC := &flowRerunContext{}
+	if err := utils.Unserialize(b, reRC); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return f.codec.Decode(reRC.Data)
+}
+
+func (f *flow) PatchRequestData(ctx context.Context, requestID string, patch types.Data) error {
+	if len(patch) == 0 {
+		return errors.NotValidf("empty patch")
+	}
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlPatch, Patch: patch})
+}
+
+func (f *flow) patchRequestData(ctx context.Context, requestID string, patch types.Data) error {
+	cr := f.batchRunner.get(requestID)
+	if cr == nil {
+		return errors.NotFoundf("request id: %s", requestID)
+	}
+	if err := cr.patchData(ctx, patch); err != nil {
+		return errors.Trace(err)
+	}
+
+	appendHistory(ctx, f.store, cr.logger, requestID, &types.HistoryEvent{
+		Type:     types.EventDataPatched,
+		Status:   types.Paused,
+		Operator: types.OperatorFromContext(ctx),
+		Patch:    f.redaction.RedactData(cr.meta.DAGName, patch),
+	})
+	return nil
+}
@@ -0,0 +1,93 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type validateDAG struct {
+	trigger int
+}
+
+func (d *validateDAG) validate(ctx types.Context, input types.Data) (types.Data, error) {
+	d.trigger++
+	if valid, _ := input.GetBool("valid"); !valid {
+		return nil, types.NewPauseErrorf("invalid input")
+	}
+	return input, nil
+}
+
+func (d *validateDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", dumbNode); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("validate", d.validate); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("node1", "validate"))
+}
+
+func TestPatchRequestData(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	params := types.Data{"valid": false, "user": map[string]any{"name": "bob", "age": 3}, "tmp": 1}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", params))
+
+	// only paused request can be patched
+	err := flow.PatchRequestData(context.Background(), "req-1", types.Data{"valid": true})
+	assert.True(t, errors.Is(err, errors.Forbidden))
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+
+	data, err := flow.GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, false, data["valid"])
+
+	ctx := types.WithOperator(context.Background(), "alice")
+	patch := types.Data{"valid": true, "user": map[string]any{"age": 4}, "tmp": nil}
+	assert.Nil(t, flow.PatchRequestData(ctx, "req-1", patch))
+
+	expected := types.Data{"valid": true, "user": map[string]any{"name": "bob", "age": float64(4)}}
+	data, err = flow.GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data)
+
+	// persisted with the run context
+	data, err = newFlow(s, newOptions()).GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, expected, data)
+
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	last := history.Events[len(history.Events)-1]
+	assert.Equal(t, types.EventDataPatched, last.Type)
+	assert.Equal(t, "alice", last.Operator)
+	assert.Equal(t, true, last.Patch["valid"])
+
+	assert.Nil(t, flow.ResumeRequest(context.Background(), "req-1"))
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 2, d.trigger)
+
+	result, err := flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, expected, result.Result)
+
+	err = flow.PatchRequestData(context.Background(), "req-unknown", patch)
+	assert.True(t, errors.IsNotFound(err))
+	_, err = flow.GetRequestData(context.Background(), "req-unknown")
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -0,0 +1,236 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/warriorguo/workflow/types"
+)
+
+const defaultEventBufferSize = 1024
+
+type eventListener struct {
+	listener types.EventListener
+	logger   types.Logger
+	// nil for a synchronous listener
+	queue   chan *types.LifecycleEvent
+	dropped atomic.Int64
+	exitCh  chan struct{}
+}
+
+/**
+ * eventDispatcher delivers the lifecycle events to the listeners of the options,
+ * the async listeners have bounded queues, so that a slow one never holds up the runner.
+ */
+type eventDispatcher struct {
+	logger    types.Logger
+	mu        sync.RWMutex
+	closed    bool
+	listeners []*eventListener
+}
+
+/**
+ * newEventDispatcher returns nil if there are no listeners
+ */
+func newEventDispatcher(configs []types.EventListenerConfig, logger types.Logger) *eventDispatcher {
+	if len(configs) == 0 {
+		return nil
+	}
+	d := &eventDispatcher{logger: logger}
+	for _, config := range configs {
+		if config.Listener == nil {
+			continue
+		}
+		l := &eventListener{listener: config.Listener, logger: logger}
+		if config.Async {
+			size := config.BufferSize
+			if size <= 0 {
+				size = defaultEventBufferSize
+			}
+			l.queue = make(chan *types.LifecycleEvent, size)
+			l.exitCh = make(chan struct{})
+			go l.loop()
+		}
+		d.listeners = append(d.listeners, l)
+	}
+	return d
+}
+
+func (l *eventListener) loop() {
+	defer close(l.exitCh)
+	for event := range l.queue {
+		l.call(event)
+	}
+}
+
+// call recovers the panic of the listener, which must not break the runner
+func (l *eventListener) call(event *types.LifecycleEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			l.logger.WithFields(eventLogFields(event)).Errorf("listener panics on %s event: %v", event.Type, r)
+		}
+	}()
+	l.listener(event)
+}
+
+func (d *eventDispatcher) emit(event *types.LifecycleEvent) {
+	if d == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, l := range d.listeners {
+		if l.queue == nil {
+			l.call(event)
+			continue
+		}
+		select {
+		case l.queue <- event:
+		default:
+			if dropped := l.dropped.Add(1); dropped == 1 || dropped%1000 == 0 {
+				d.logger.WithFields(eventLogFields(event)).Warnf("event listener is slow, %d events dropped, the last: %s", dropped, event.Type)
+			}
+		}
+	}
+}
+
+/**
+ * close stops accepting the events and waits for the async listeners to handle the ones queued until ctx is done
+ */
+func (d *eventDispatcher) close(ctx context.Context) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	for _, l := range d.listeners {
+		if l.queue != nil {
+			close(l.queue)
+			select {
+			case <-l.exitCh:
+			case <-ctx.Done():
+				d.logger.Warnf("event listener is not done on closing, %d events left", len(l.queue))
+			}
+		}
+	}
+}
+
+func eventLogFields(event *types.LifecycleEvent) types.LogFields {
+	return types.LogFields{types.LogFieldRequestID: event.RequestID, types.LogFieldDAG: event.DAGName}
+}
+
+/**
+ * newEvent returns the event of the request run by the runner
+ */
+func (r *contextRunner) newEvent(eventType types.LifecycleEventType) *types.LifecycleEvent {
+	return &types.LifecycleEvent{
+		Type:      eventType,
+		Time:      time.Now(),
+		RequestID: r.fc.requestID,
+		DAGName:   r.meta.DAGName,
+		Tenant:    r.meta.Tenant,
+		Status:    r.runningStatus,
+	}
+}
+
+func (r *contextRunner) emitVertexEvent(eventType types.LifecycleEventType, record *types.NodeTraceRecord, err error) {
+	if r.events == nil || record == nil {
+		return
+	}
+	event := r.newEvent(eventType)
+	event.Path = record.Path
+	if len(record.Vertex) > 0 {
+		event.Path = record.Vertex
+	}
+	event.StartTime, event.EndTime, event.Err = record.StartTime, record.EndTime, err
+	r.queueEvent(event)
+}
+
+/**
+ * emitStatusChanged emits the events of pausing and resuming
+ */
+func (r *contextRunner) emitStatusChanged(from types.StatusType, operator string) {
+	if r.events == nil || from == r.runningStatus {
+		return
+	}
+	var event *types.LifecycleEvent
+	switch {
+	case r.runningStatus == types.Paused:
+		event = r.newEvent(types.LifecyclePaused)
+	case from == types.Paused && !r.runningStatus.IsTerminal():
+		event = r.newEvent(types.LifecycleResumed)
+	default:
+		return
+	}
+	event.Operator = operator
+	r.queueEvent(event)
+}
+
+/**
+ * emitTerminal emits the event of the terminated request
+ */
+func (r *contextRunner) emitTerminal() {
+	if r.events == nil {
+		return
+	}
+	event := r.newEvent(types.LifecycleFinished)
+	if r.runningStatus != types.Finished {
+		// the last error is kept after resuming, so it only tells why the request is terminated
+		event.Type, event.Err = types.LifecycleTerminated, r.lastErr
+	}
+	event.StartTime, event.EndTime = r.meta.CreateTime, event.Time
+	r.queueEvent(event)
+}
+
+/**
+ * queueEvent keeps the event of the request until flushEvents,
+ * the events are queued while the locks of the runners are held,
+ * so that a synchronous listener is able to call back into the engine.
+ */
+func (r *contextRunner) queueEvent(event *types.LifecycleEvent) {
+	if r.events == nil {
+		return
+	}
+	r.eventsMu.Lock()
+	defer r.eventsMu.Unlock()
+	r.pendingEvents = append(r.pendingEvents, event)
+}
+
+/**
+ * flushEvents emits the queued events in order, it must be called without holding the locks of the runners.
+ * The events queued by the listeners themselves are emitted by the flushing one, so that the order is kept.
+ */
+func (r *contextRunner) flushEvents() {
+	r.eventsMu.Lock()
+	if r.flushing {
+		r.eventsMu.Unlock()
+		return
+	}
+	r.flushing = true
+	for len(r.pendingEvents) > 0 {
+		events := r.pendingEvents
+		r.pendingEvents = nil
+		r.eventsMu.Unlock()
+		for _, event := range events {
+			r.events.emit(event)
+		}
+		r.eventsMu.Lock()
+	}
+	r.flushing = false
+	r.eventsMu.Unlock()
+}
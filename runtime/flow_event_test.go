@@ -0,0 +1,246 @@
+package runtime
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []*types.LifecycleEvent
+}
+
+func (r *eventRecorder) listen(event *types.LifecycleEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []types.LifecycleEventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	eventTypes := make([]types.LifecycleEventType, len(r.events))
+	for i, event := range r.events {
+		eventTypes[i] = event.Type
+	}
+	return eventTypes
+}
+
+type retryOnceDAG struct {
+	retried bool
+}
+
+func (d *retryOnceDAG) node(ctx types.Context, input types.Data) (types.Data, error) {
+	if !d.retried {
+		d.retried = true
+		return nil, types.NewRetryErrorf(0, "not ready")
+	}
+	return input, nil
+}
+
+func (d *retryOnceDAG) testDAG(dag types.DAG) error {
+	return errors.Trace(dag.Node("node1", d.node))
+}
+
+func TestEventListener(t *testing.T) {
+	recorder := &eventRecorder{}
+	opts := newOptions()
+	types.WithEventListener(recorder.listen)(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"valid": false}, types.WithTenant("acme")))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	ctx := types.WithOperator(context.Background(), "alice")
+	assert.Nil(t, flow.PatchRequestData(ctx, "req-1", types.Data{"valid": true}))
+	assert.Nil(t, flow.ResumeRequest(ctx, "req-1"))
+	assert.Nil(t, flow.runOnce())
+
+	assert.Equal(t, []types.LifecycleEventType{
+		types.LifecycleSubmitted,
+		types.LifecycleStarted,
+		types.LifecycleVertexStarted, types.LifecycleVertexFinished,
+		types.LifecycleVertexStarted, types.LifecycleVertexFailed,
+		types.LifecyclePaused,
+		types.LifecycleResumed,
+		types.LifecycleVertexStarted, types.LifecycleVertexFinished,
+		types.LifecycleFinished,
+	}, recorder.types())
+
+	events := recorder.events
+	for _, event := range events {
+		assert.Equal(t, "req-1", event.RequestID)
+		assert.Equal(t, "test", event.DAGName)
+		assert.Equal(t, "acme", event.Tenant)
+		assert.False(t, event.Time.IsZero())
+	}
+	assert.Equal(t, []string{"test", "node1"}, events[3].Path)
+	assert.True(t, events[3].Duration() >= 0)
+	assert.False(t, events[3].EndTime.IsZero())
+	assert.Equal(t, []string{"test", "validate"}, events[5].Path)
+	assert.NotNil(t, events[5].Err)
+	assert.Equal(t, types.Paused, events[6].Status)
+	assert.Equal(t, "alice", events[7].Operator)
+	assert.Equal(t, types.Finished, events[10].Status)
+	assert.Nil(t, events[10].Err)
+
+	// retry and terminate
+	recorder.events = nil
+	r := &retryOnceDAG{}
+	assert.Nil(t, flow.RegisterDAG("retry", r.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "retry", "req-2", types.Data{}))
+	assert.Nil(t, flow.runOnce())
+	assert.Nil(t, flow.TerminateRequest(context.Background(), "req-2"))
+	assert.Equal(t, []types.LifecycleEventType{
+		types.LifecycleSubmitted,
+		types.LifecycleStarted,
+		types.LifecycleVertexStarted, types.LifecycleVertexFailed,
+		types.LifecycleRetryScheduled,
+		types.LifecycleTerminated,
+	}, recorder.types())
+	assert.Equal(t, []string{"retry", "node1"}, recorder.events[4].Path)
+	assert.False(t, recorder.events[4].RetryAt.IsZero())
+	assert.Equal(t, types.Fatal, recorder.events[5].Status)
+}
+
+func TestEventListener_Async(t *testing.T) {
+	recorder := &eventRecorder{}
+	blockCh := make(chan struct{})
+	slow := func(event *types.LifecycleEvent) {
+		<-blockCh
+	}
+	opts := newOptions()
+	types.WithAsyncEventListener(slow, 1)(opts)
+	types.WithAsyncEventListener(recorder.listen, 0)(opts)
+	types.WithEventListener(func(event *types.LifecycleEvent) { panic("broken listener") })(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	assert.Nil(t, flow.RegisterDAG("test", (&validateDAG{}).testDAG))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"valid": true}))
+		for i := 0; i < 2; i++ {
+			assert.Nil(t, flow.runOnce())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the runner is stalled by the slow listener")
+	}
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+
+	close(blockCh)
+	assert.Nil(t, flow.Close(context.Background()))
+	// the queued events are delivered before closed
+	assert.Len(t, recorder.types(), 7)
+	assert.Equal(t, types.LifecycleFinished, recorder.types()[6])
+	assert.True(t, flow.events.listeners[0].dropped.Load() > 0)
+}
+
+func TestEventListener_CallBack(t *testing.T) {
+	recorder := &eventRecorder{}
+	opts := newOptions()
+	var flow *flow
+	var seen *types.RequestStatus
+	types.WithEventListener(func(event *types.LifecycleEvent) {
+		if event.Type != types.LifecycleVertexFinished || seen != nil {
+			return
+		}
+		// the listener calls back into the engine while the request is being run
+		var err error
+		seen, err = flow.GetRequestStatus(context.Background(), event.RequestID)
+		assert.Nil(t, err)
+		assert.Nil(t, flow.PauseRequest(context.Background(), event.RequestID))
+	})(opts)
+	types.WithEventListener(recorder.listen)(opts)
+	flow = newFlow(mem.NewMemStore(), opts)
+
+	assert.Nil(t, flow.RegisterDAG("test", (&validateDAG{}).testDAG))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"valid": true}))
+		assert.Nil(t, flow.runOnce())
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the runner is stalled by the listener calling back")
+	}
+
+	if assert.NotNil(t, seen) {
+		assert.Equal(t, types.Running, seen.Status)
+	}
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	assert.Equal(t, []types.LifecycleEventType{
+		types.LifecycleSubmitted,
+		types.LifecycleStarted,
+		types.LifecycleVertexStarted, types.LifecycleVertexFinished,
+		types.LifecyclePaused,
+	}, recorder.types())
+}
+
+func TestEventListener_VertexStartedBeforeRun(t *testing.T) {
+	opts := newOptions()
+	var flow *flow
+	started := make(chan *types.RequestStatus, 1)
+	types.WithEventListener(func(event *types.LifecycleEvent) {
+		if event.Type != types.LifecycleVertexStarted {
+			return
+		}
+		// the listener calls back into the engine before the node runs
+		status, err := flow.GetRequestStatus(context.Background(), event.RequestID)
+		assert.Nil(t, err)
+		started <- status
+	})(opts)
+	flow = newFlow(mem.NewMemStore(), opts)
+
+	release := make(chan struct{})
+	assert.Nil(t, flow.RegisterDAG("test", func(dag types.DAG) error {
+		return errors.Trace(dag.Node("node1", func(ctx types.Context, input types.Data) (types.Data, error) {
+			<-release
+			return input, nil
+		}))
+	}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, flow.runOnce())
+	}()
+
+	select {
+	case status := <-started:
+		assert.Equal(t, types.Running, status.Status)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the vertex started event is not emitted while the node is running")
+	}
+	// the running request can not be run again meanwhile
+	assert.Nil(t, flow.batchRunner.runOnce(context.Background(), 1))
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the node is not finished")
+	}
+
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+}
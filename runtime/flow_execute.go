@@ -2,9 +2,11 @@ package runtime
 
 import (
 	"context"
+	"sync/atomic"
 
 	"github.com/juju/errors"
 	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/trace"
 	"github.com/warriorguo/workflow/types"
 )
 
@@ -12,17 +14,55 @@ type flowExecute struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	exitCh  chan struct{}
-	running bool
+	exitCh chan struct{}
+	// read by the goroutines of the flow while Close sets it
+	running atomic.Bool
 
 	store store.Store
+	// codec converts the Data persisted to the store
+	codec types.DataCodec
+	// nil if there is no blob store
+	blobs *blobOffloader
+	// the metrics listener is always there
+	events  *eventDispatcher
+	metrics *flowMetrics
+	// redaction of the trace records, nil for none
+	redaction *types.RedactionPolicy
+	// nil if the requests are not traced
+	tracer trace.Tracer
+	logger types.Logger
 
 	concurrency int
 	batchRunner *batchRunner
+	observer    runnerObserver
 }
 
-func (fe *flowExecute) startExecutePlan(requestID string, dr *dagRuntime, params types.Data) error {
-	return fe.batchRunner.add(requestID, newContextRunner(fe.store, requestID, dr, params))
+/**
+ * startExecutePlan adds the runner of the request, status is Pending unless the request is reloaded as paused
+ */
+func (fe *flowExecute) startExecutePlan(ctx context.Context, requestID string, meta *requestMeta, dr *dagRuntime, params types.Data,
+	override *types.VertexOverride, status types.StatusType) error {
+	cr := newContextRunner(fe.store, fe.codec, requestID, meta, fe.observer, dr, params)
+	cr.runningStatus = status
+	cr.fc.override = override
+	cr.blobs = fe.blobs
+	cr.events = fe.events
+	cr.fc.redaction = fe.redaction
+	cr.tracer = fe.tracer
+	cr.logger = runnerLogger(fe.logger, requestID, meta)
+	cr.fc.logger = cr.logger
+	if err := fe.batchRunner.add(requestID, cr); err != nil {
+		return errors.Trace(err)
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.startTrace(ctx)
+	if err := cr.saveContext(ctx); err != nil {
+		fe.batchRunner.remove(requestID)
+		return errors.Trace(err)
+	}
+	return nil
 }
 
 func (fe *flowExecute) hasExecutePlan(requestID string) bool {
@@ -37,13 +77,20 @@ func (fe *flowExecute) isRunningEmpty() bool {
 	return len(fe.batchRunner.runners) == 0
 }
 
-func (fe *flowExecute) setExecutePlanStatus(requestID string, newStatus types.StatusType) error {
+func (fe *flowExecute) setExecutePlanStatus(ctx context.Context, requestID string, newStatus types.StatusType) error {
 	cr := fe.batchRunner.get(requestID)
 	if cr == nil {
 		return errors.NotFoundf("request ID:%s", requestID)
 	}
 
-	return cr.setNextStatus(newStatus)
+	if err := cr.setNextStatus(newStatus, types.OperatorFromContext(ctx)); err != nil {
+		return errors.Trace(err)
+	}
+	// apply it right now if the request is not running,
+	// otherwise it would be applied after the running node.
+	err := cr.applyNextStatus(ctx)
+	cr.flushEvents()
+	return errors.Trace(err)
 }
 
 func (fe *flowExecute) getExecutePlanStatus(requestID string) (*types.RequestStatus, error) {
@@ -163,3 +163,51 @@ func TestFailCondition(t *testing.T) {
 	assert.Nil(t, err)
 	fmt.Printf("dot: %s\n", dot)
 }
+
+func TestCommitRecordWithContext(t *testing.T) {
+	failing := false
+	s := mem.NewMemStoreWithErrHandler(func() error {
+		if failing {
+			return errors.New("store failed")
+		}
+		return nil
+	})
+	flow := newFlow(s, newOptions())
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+
+	failing = true
+	assert.NotNil(t, flow.runOnce())
+	failing = false
+	assert.Equal(t, 1, d.trigger)
+
+	// neither the record nor the run context of node1 is saved
+	records, err := flow.loadRecords(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(records))
+	_, reRC, err := flow.loadPlan(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "test.node1", reRC.Entrypoint.String())
+
+	// node1 runs again on a restarted engine
+	flow = newFlow(s, newOptions())
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	errs, err := flow.reloadPlans(context.Background())
+	assert.Nil(t, err)
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Equal(t, 3, d.trigger)
+	records, err = flow.loadRecords(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	_, reRC, err = flow.loadPlan(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Nil(t, reRC)
+}
@@ -0,0 +1,341 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func hasRetention(opts *types.FlowOptions) bool {
+	if opts.Retention != (types.RetentionPolicy{}) {
+		return true
+	}
+	for _, policy := range opts.DAGRetentions {
+		if policy != (types.RetentionPolicy{}) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *flow) retentionPolicy(dagName string) types.RetentionPolicy {
+	if policy, exists := f.opts.DAGRetentions[dagName]; exists {
+		return policy
+	}
+	return f.opts.Retention
+}
+
+func (f *flow) isExpired(info *types.RequestInfo, now time.Time) bool {
+	retention, ok := f.retentionPolicy(info.DAGName).Of(info.Status)
+	return ok && now.Sub(info.UpdateTime) > retention
+}
+
+/**
+ * persistedStatus returns the status of a request not held by the engine,
+ * found is false if there is nothing tells the status.
+ */
+func (f *flow) persistedStatus(ctx context.Context, requestID string) (status types.StatusType, found bool, err error) {
+	b, err := f.store.Get(ctx, RunContextPath, requestID)
+	if err != nil {
+		return types.None, false, errors.Trace(err)
+	}
+	if b != nil {
+		reRC := &flowRerunContext{}
+		if err := utils.Unserialize(b, reRC); err != nil {
+			return types.None, false, errors.Trace(err)
+		}
+		return reRC.Status, true, nil
+	}
+
+	info, err := f.loadRequestInfo(ctx, requestID)
+	if err == nil {
+		return info.Status, true, nil
+	}
+	if !errors.IsNotFound(err) {
+		return types.None, false, errors.Trace(err)
+	}
+
+	summary, err := f.loadSummary(ctx, requestID)
+	if err != nil || summary == nil {
+		return types.None, false, errors.Trace(err)
+	}
+	return summary.Status, true, nil
+}
+
+/**
+ * purgeRequest removes all of the data of the terminated request in a batch,
+ * it returns the amount of the keys removed, which is 0 if nothing of the request is found.
+ */
+func (f *flow) purgeRequest(ctx context.Context, requestID string) (int, error) {
+	found := false
+	idempotencyKey := ""
+	if cr := f.batchRunner.get(requestID); cr != nil {
+		status, err := cr.getStatus()
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if !status.Status.IsTerminal() {
+			return 0, errors.Forbiddenf("request %s is %v", requestID, status.Status)
+		}
+		f.batchRunner.remove(requestID)
+		found, idempotencyKey = true, cr.meta.IdempotencyKey
+	} else {
+		status, exists, err := f.persistedStatus(ctx, requestID)
+		if err != nil {
+			return 0, errors.Trace(err)
+		}
+		if exists && !status.IsTerminal() {
+			return 0, errors.Forbiddenf("request %s is %v", requestID, status)
+		}
+		found = exists
+		info, err := f.loadRequestInfo(ctx, requestID)
+		if err == nil {
+			idempotencyKey = info.IdempotencyKey
+		} else if !errors.IsNotFound(err) {
+			return 0, errors.Trace(err)
+		}
+	}
+
+	ops := make([]store.Op, 0)
+	recordPath := recordSavePath(requestID)
+	if err := f.store.List(ctx, recordPath, func(vertex string) bool {
+		ops = append(ops, store.RemoveOp(recordPath, vertex))
+		return true
+	}); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	hasHistory := false
+	if err := f.store.ListAppend(ctx, HistoryPath, requestID, func(b []byte) bool {
+		hasHistory = true
+		return false
+	}); err != nil {
+		return 0, errors.Trace(err)
+	}
+	if hasHistory {
+		ops = append(ops, store.RemoveOp(HistoryPath, requestID))
+	}
+	if !found && len(ops) == 0 {
+		return 0, nil
+	}
+
+	if idempotencyKey == "" {
+		// SubmitDAG takes the request ID as the key by default
+		idempotencyKey = requestID
+	}
+	rec, _, err := f.loadIdempotency(ctx, idempotencyKey)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	// the expired key may have been taken by another request
+	if rec != nil && rec.RequestID == requestID {
+		ops = append(ops, store.RemoveOp(IdempotencyPath, idempotencyKey))
+	}
+
+	if err := f.removeBlobs(ctx, requestID); err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	// the index goes last, so that an interrupted purge would be picked up by the next GC
+	for _, prefix := range []string{RunContextPath, DAGPlanPath, SummaryPath, RequestInfoPath} {
+		ops = append(ops, store.RemoveOp(prefix, requestID))
+	}
+	if err := store.Batch(ctx, f.store, ops); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return len(ops), nil
+}
+
+func (f *flow) PurgeRequest(ctx context.Context, requestID string) error {
+	deleted, err := f.purgeRequest(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if deleted == 0 {
+		return errors.NotFoundf("request id: %s", requestID)
+	}
+	f.requestLogger(requestID).Infof("purged, %d keys deleted", deleted)
+	return nil
+}
+
+func (f *flow) GetGCReport() *types.GCReport {
+	f.gcReportMu.Lock()
+	defer f.gcReportMu.Unlock()
+
+	if f.gcReport == nil {
+		return nil
+	}
+	report := *f.gcReport
+	return &report
+}
+
+func (f *flow) updateGCReport(update func(report *types.GCReport)) {
+	f.gcReportMu.Lock()
+	defer f.gcReportMu.Unlock()
+
+	update(f.gcReport)
+}
+
+/**
+ * collectExpired returns at most limit expired requests after the key,
+ * and the last scanned key which is empty if the scan reached the end.
+ */
+func (f *flow) collectExpired(ctx context.Context, afterKey string, limit int, now time.Time) ([]string, string, error) {
+	expired := make([]string, 0, limit)
+	lastKey := ""
+	err := store.Scan(ctx, f.store, RequestInfoPath, afterKey, func(requestID string, b []byte) bool {
+		lastKey = requestID
+		info := &types.RequestInfo{}
+		if err := utils.Unserialize(b, info); err != nil {
+			f.requestLogger(requestID).Errorf("unserialize %s %s from store:%s failed: %v", RequestInfoPath, requestID, string(b), err)
+			return true
+		}
+		if !info.Status.IsTerminal() {
+			return true
+		}
+		f.updateGCReport(func(report *types.GCReport) { report.Scanned++ })
+		if f.isExpired(info, now) {
+			expired = append(expired, requestID)
+		}
+		return len(expired) < limit
+	})
+	if err != nil {
+		return nil, "", errors.Trace(err)
+	}
+	if len(expired) < limit {
+		// reached the end
+		lastKey = ""
+	}
+	return expired, lastKey, nil
+}
+
+func (f *flow) RunGC(ctx context.Context) (*types.GCReport, error) {
+	f.gcMu.Lock()
+	defer f.gcMu.Unlock()
+
+	f.gcReportMu.Lock()
+	f.gcReport = &types.GCReport{StartTime: time.Now()}
+	f.gcReportMu.Unlock()
+
+	err := f.runGC(ctx)
+	f.updateGCReport(func(report *types.GCReport) {
+		report.EndTime = time.Now()
+		if err != nil {
+			report.Error = err.Error()
+		}
+	})
+
+	report := f.GetGCReport()
+	f.logger.Infof("GC finished in %v, scanned: %d, expired: %d, purged: %d, failed: %d, deleted keys: %d",
+		report.EndTime.Sub(report.StartTime), report.Scanned, report.Expired, report.Purged, report.Failed, report.DeletedKeys)
+	return report, errors.Trace(err)
+}
+
+func (f *flow) runGC(ctx context.Context) error {
+	batchSize := f.opts.GCBatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	now := time.Now()
+	afterKey := ""
+	for {
+		expired, lastKey, err := f.collectExpired(ctx, afterKey, batchSize, now)
+		if err != nil {
+			return errors.Trace(err)
+		}
+
+		for _, requestID := range expired {
+			if err := ctx.Err(); err != nil {
+				return errors.Trace(err)
+			}
+			deleted, err := f.purgeRequest(ctx, requestID)
+			f.updateGCReport(func(report *types.GCReport) {
+				report.Expired++
+				report.DeletedKeys += deleted
+				if err != nil {
+					report.Failed++
+					report.Error = err.Error()
+				} else {
+					report.Purged++
+				}
+			})
+			if err != nil {
+				f.requestLogger(requestID).Errorf("failed to purge: %v", err)
+			}
+		}
+
+		if lastKey == "" {
+			break
+		}
+		afterKey = lastKey
+	}
+	return errors.Trace(f.sweepIdempotency(ctx, batchSize))
+}
+
+/**
+ * sweepIdempotency removes the expired idempotency records, batchSize at a time.
+ * The records of the purged requests are removed by purgeRequest, the others expire after IdempotencyRetention.
+ */
+func (f *flow) sweepIdempotency(ctx context.Context, batchSize int) error {
+	afterKey := ""
+	for {
+		ops := make([]store.Op, 0, batchSize)
+		lastKey := ""
+		err := store.Scan(ctx, f.store, IdempotencyPath, afterKey, func(key string, b []byte) bool {
+			lastKey = key
+			rec := &idempotencyRecord{}
+			if err := utils.Unserialize(b, rec); err != nil {
+				f.logger.Errorf("unserialize %s %s from store:%s failed: %v", IdempotencyPath, key, string(b), err)
+				return true
+			}
+			if rec.expired() {
+				ops = append(ops, store.RemoveOp(IdempotencyPath, key))
+			}
+			return len(ops) < batchSize
+		})
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if len(ops) > 0 {
+			if err := store.Batch(ctx, f.store, ops); err != nil {
+				return errors.Trace(err)
+			}
+			f.updateGCReport(func(report *types.GCReport) { report.DeletedKeys += len(ops) })
+		}
+		if len(ops) < batchSize {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return errors.Trace(err)
+		}
+		afterKey = lastKey
+	}
+}
+
+/**
+ * gcLoop runs the garbage collection every GCInterval until the flow closed
+ */
+func (f *flow) gcLoop() {
+	f.gcExitCh = make(chan struct{})
+	go func() {
+		defer close(f.gcExitCh)
+
+		ticker := time.NewTicker(f.opts.GCInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := f.RunGC(f.ctx); err != nil {
+					f.logger.Errorf("GC failed: %v", err)
+				}
+			}
+		}
+	}()
+}
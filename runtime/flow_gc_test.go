@@ -0,0 +1,112 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func countKeys(t *testing.T, s store.Store, prefix string) int {
+	count := 0
+	assert.Nil(t, s.List(context.Background(), prefix, func(key string) bool {
+		count++
+		return true
+	}))
+	return count
+}
+
+func TestRetentionGC(t *testing.T) {
+	s := mem.NewMemStore()
+	opts := newOptions()
+	opts.GCBatchSize = 2
+	types.WithRetention(types.RetentionPolicy{Finished: time.Millisecond, Fatal: time.Millisecond})(opts)
+	types.WithDAGRetention("fatal", types.RetentionPolicy{Finished: time.Millisecond})(opts)
+	flow := newFlow(s, opts)
+
+	assert.Nil(t, flow.RegisterDAG("count", (&countDAG{}).testDAG))
+	assert.Nil(t, flow.RegisterDAG("fatal", (&fatalDAG{}).testDAG))
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "count", fmt.Sprintf("count-%d", i), types.Data{}))
+	}
+	assert.Nil(t, flow.RunDAG(context.Background(), "fatal", "fatal-0", types.Data{}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "retry", "retry-0", types.Data{}, types.WithIdempotencyKey("retry-key")))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Nil(t, flow.GetGCReport())
+
+	err := flow.PurgeRequest(context.Background(), "retry-0")
+	assert.True(t, errors.Is(err, errors.Forbidden))
+	err = flow.PurgeRequest(context.Background(), "unknown")
+	assert.True(t, errors.IsNotFound(err))
+
+	time.Sleep(10 * time.Millisecond)
+	report, err := flow.RunGC(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 6, report.Scanned)
+	assert.Equal(t, 5, report.Expired)
+	assert.Equal(t, 5, report.Purged)
+	assert.Equal(t, 0, report.Failed)
+	assert.True(t, report.DeletedKeys > 5)
+	assert.False(t, report.EndTime.IsZero())
+	assert.Equal(t, report, flow.GetGCReport())
+
+	for i := 0; i < 5; i++ {
+		requestID := fmt.Sprintf("count-%d", i)
+		_, err := flow.GetRequestResult(context.Background(), requestID)
+		assert.True(t, errors.IsNotFound(err))
+		assert.Equal(t, 0, countKeys(t, s, recordSavePath(requestID)))
+		history, err := flow.GetRequestHistory(context.Background(), requestID, 0, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, 0, len(history.Events))
+	}
+	// the idempotency records of the purged requests are gone as well
+	assert.Equal(t, 2, countKeys(t, s, IdempotencyPath))
+
+	// the fatal one is kept by the DAG retention, then purged manually
+	list, err := flow.ListRequests(context.Background(), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list.Requests))
+
+	assert.Nil(t, flow.PurgeRequest(context.Background(), "fatal-0"))
+	_, err = flow.GetRequestResult(context.Background(), "fatal-0")
+	assert.True(t, errors.IsNotFound(err))
+	assert.Equal(t, 1, countKeys(t, s, DAGPlanPath))
+	assert.Equal(t, 1, countKeys(t, s, RunContextPath))
+	assert.Equal(t, 0, countKeys(t, s, recordSavePath("fatal-0")))
+	assert.Equal(t, 1, countKeys(t, s, IdempotencyPath))
+	rec, _, err := flow.loadIdempotency(context.Background(), "retry-key")
+	assert.Nil(t, err)
+	assert.Equal(t, "retry-0", rec.RequestID)
+}
+
+func TestRetentionGC_Idempotency(t *testing.T) {
+	s := mem.NewMemStore()
+	opts := newOptions()
+	opts.GCBatchSize = 2
+	opts.IdempotencyRetention = time.Millisecond
+	flow := newFlow(s, opts)
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+	}
+	assert.Equal(t, 5, countKeys(t, s, IdempotencyPath))
+
+	// the records expire even though the requests are still running
+	time.Sleep(10 * time.Millisecond)
+	report, err := flow.RunGC(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 5, report.DeletedKeys)
+	assert.Equal(t, 0, countKeys(t, s, IdempotencyPath))
+	assert.Equal(t, 5, countKeys(t, s, RequestInfoPath))
+}
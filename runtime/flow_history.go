@@ -0,0 +1,69 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	HistoryPath = "/history/"
+
+	defaultHistoryLimit = 100
+)
+
+/**
+ * appendHistory adds the event to the execution history of the request,
+ * failure of it is only logged since the history should never block the execution.
+ */
+func appendHistory(ctx context.Context, s store.Store, logger types.Logger, requestID string, event *types.HistoryEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b, err := utils.Serialize(event)
+	if err != nil {
+		logger.Errorf("failed to serialize history event %s: %v", event.Type, err)
+		return
+	}
+	if err := s.Append(ctx, HistoryPath, requestID, b); err != nil {
+		logger.Errorf("failed to append history event %s: %v", event.Type, err)
+	}
+}
+
+func (f *flow) GetRequestHistory(ctx context.Context, requestID string, offset, limit int) (*types.RequestHistory, error) {
+	if offset < 0 {
+		return nil, errors.NotValidf("offset %d", offset)
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	history := &types.RequestHistory{Events: make([]*types.HistoryEvent, 0), NextOffset: -1}
+	index := 0
+	err := f.store.ListAppend(ctx, HistoryPath, requestID, func(b []byte) bool {
+		defer func() { index++ }()
+		if index < offset {
+			return true
+		}
+		if len(history.Events) >= limit {
+			history.NextOffset = index
+			return false
+		}
+
+		event := &types.HistoryEvent{}
+		if err := utils.Unserialize(b, event); err != nil {
+			f.requestLogger(requestID).Errorf("unserialize %s %s from store:%s failed: %v", HistoryPath, requestID, string(b), err)
+			return true
+		}
+		history.Events = append(history.Events, event)
+		return true
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return history, nil
+}
@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func historyTypes(history *types.RequestHistory) []types.HistoryEventType {
+	eventTypes := make([]types.HistoryEventType, 0, len(history.Events))
+	for _, event := range history.Events {
+		eventTypes = append(eventTypes, event.Type)
+	}
+	return eventTypes
+}
+
+func TestRequestHistory(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "retry", "req-1", types.Data{}))
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	ctx := types.WithOperator(context.Background(), "alice")
+	assert.Nil(t, flow.PauseRequest(ctx, "req-1"))
+	assert.Nil(t, flow.TerminateRequest(ctx, "req-1"))
+
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, history.NextOffset)
+	assert.Equal(t, []types.HistoryEventType{
+		types.EventRequestStarted,
+		types.EventVertexStarted,
+		types.EventVertexFinished,
+		types.EventVertexStarted,
+		types.EventVertexFailed,
+		types.EventRetryScheduled,
+		types.EventStatusChanged,
+		types.EventStatusChanged,
+		types.EventRequestTerminated,
+	}, historyTypes(history))
+
+	assert.Equal(t, "retry.retry", history.Events[5].Vertex)
+	assert.Equal(t, types.Paused, history.Events[6].Status)
+	assert.Equal(t, "alice", history.Events[6].Operator)
+	assert.Equal(t, types.Fatal, history.Events[8].Status)
+	for i := 1; i < len(history.Events); i++ {
+		assert.False(t, history.Events[i].Time.Before(history.Events[i-1].Time))
+	}
+
+	// paging
+	page, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, history.Events[:4], page.Events)
+	assert.Equal(t, 4, page.NextOffset)
+
+	page, err = flow.GetRequestHistory(context.Background(), "req-1", page.NextOffset, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, history.Events[4:], page.Events)
+	assert.Equal(t, -1, page.NextOffset)
+
+	page, err = flow.GetRequestHistory(context.Background(), "req-unknown", 0, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(page.Events))
+
+	_, err = flow.GetRequestHistory(context.Background(), "req-1", -1, 10)
+	assert.True(t, errors.IsNotValid(err))
+}
+
+func TestRequestHistory_NotRecorded(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "retry", "req-1", types.Data{}))
+
+	// the status set is not allowed any more once it is to be assigned, e.g. the request finished meanwhile
+	cr := flow.batchRunner.get("req-1")
+	assert.Nil(t, cr.setNextStatus(types.Paused, "alice"))
+	cr.runningStatus = types.Finished
+	cr.assignNextStatus(context.Background())
+	assert.Equal(t, types.Finished, cr.runningStatus)
+
+	// the undecodable entry is skipped
+	assert.Nil(t, s.Append(context.Background(), HistoryPath, "req-1", []byte("broken")))
+
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.HistoryEventType{types.EventRequestStarted}, historyTypes(history))
+}
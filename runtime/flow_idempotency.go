@@ -0,0 +1,161 @@
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	IdempotencyPath = "/idempotency/"
+)
+
+/**
+ * idempotencyRecord remembers a submitted request by its idempotency key,
+ * so that a duplicate submit would not run the side effects again,
+ * even after the request left the memory or the process restarted.
+ */
+type idempotencyRecord struct {
+	RequestID  string    `json:",omitempty"`
+	DAGName    string    `json:",omitempty"`
+	ParamsHash string    `json:",omitempty"`
+	CreateTime time.Time `json:",omitempty"`
+	ExpireTime time.Time `json:",omitempty"`
+}
+
+func (rec *idempotencyRecord) expired() bool {
+	return !rec.ExpireTime.IsZero() && time.Now().After(rec.ExpireTime)
+}
+
+func hashParams(dagName string, params types.Data) (string, error) {
+	b, err := utils.Serialize(params)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	h := sha256.New()
+	h.Write([]byte(dagName))
+	h.Write([]byte{0})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/**
+ * loadIdempotency returns the record of the key along with its version if the store is a store.TxStore,
+ * the version is 0 if the record does not exist or the store is not versioned.
+ */
+func (f *flow) loadIdempotency(ctx context.Context, key string) (*idempotencyRecord, int64, error) {
+	var (
+		b       []byte
+		version int64
+		err     error
+	)
+	if txStore, ok := f.store.(store.TxStore); ok {
+		b, version, err = txStore.GetVersion(ctx, IdempotencyPath, key)
+	} else {
+		b, err = f.store.Get(ctx, IdempotencyPath, key)
+	}
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	if b == nil {
+		return nil, 0, nil
+	}
+	rec := &idempotencyRecord{}
+	if err := utils.Unserialize(b, rec); err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	return rec, version, nil
+}
+
+/**
+ * saveIdempotency saves the record by compare-and-set on the version loaded if the store is a store.TxStore,
+ * so that only one of the engines submitting the same key at the same time wins,
+ * the others get ErrVersionConflict.
+ */
+func (f *flow) saveIdempotency(ctx context.Context, key string, rec *idempotencyRecord, version int64) error {
+	b, err := utils.Serialize(rec)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if txStore, ok := f.store.(store.TxStore); ok {
+		_, err = txStore.CompareAndSet(ctx, IdempotencyPath, key, b, version)
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.store.Set(ctx, IdempotencyPath, key, b))
+}
+
+func (f *flow) removeIdempotency(ctx context.Context, key string) error {
+	return errors.Trace(f.store.Remove(ctx, IdempotencyPath, key))
+}
+
+/**
+ * checkIdempotency returns the SubmitResult of the existing request if the key has been submitted,
+ * otherwise it remembers the key for the new request and returns nil.
+ * idempotencyMu serializes the submits of this process only, the ones of the other engines
+ * are told apart by the compare-and-set of the record if the store is a store.TxStore.
+ */
+func (f *flow) checkIdempotency(ctx context.Context, key, dagName, requestID string, params types.Data) (*types.SubmitResult, error) {
+	paramsHash, err := hashParams(dagName, params)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	f.idempotencyMu.Lock()
+	defer f.idempotencyMu.Unlock()
+
+	for {
+		rec, version, err := f.loadIdempotency(ctx, key)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if rec != nil && !rec.expired() {
+			result := &types.SubmitResult{
+				RequestID:  rec.RequestID,
+				Duplicated: true,
+				Conflict:   rec.ParamsHash != paramsHash || rec.DAGName != dagName,
+				Status:     f.idempotencyStatus(ctx, rec),
+			}
+			if result.Conflict {
+				return result, errors.WithType(
+					errors.Errorf("idempotency key %s has been submitted by request %s with different parameters", key, rec.RequestID),
+					types.ErrIdempotencyConflict)
+			}
+			return result, nil
+		}
+		if f.hasExecutePlan(requestID) {
+			return nil, errors.AlreadyExistsf("request id: %s", requestID)
+		}
+
+		now := time.Now()
+		rec = &idempotencyRecord{
+			RequestID:  requestID,
+			DAGName:    dagName,
+			ParamsHash: paramsHash,
+			CreateTime: now,
+		}
+		if f.opts.IdempotencyRetention > 0 {
+			rec.ExpireTime = now.Add(f.opts.IdempotencyRetention)
+		}
+		err = f.saveIdempotency(ctx, key, rec, version)
+		if errors.Is(err, store.ErrVersionConflict) {
+			// claimed by another engine in the meantime, reload to take it as a duplicate
+			continue
+		}
+		return nil, errors.Trace(err)
+	}
+}
+
+func (f *flow) idempotencyStatus(ctx context.Context, rec *idempotencyRecord) *types.RequestStatus {
+	status, err := f.getRequestStatus(ctx, rec.RequestID)
+	if err != nil {
+		// the request is neither in memory nor terminated, e.g. it has not been reloaded yet
+		return &types.RequestStatus{Status: types.None, LastError: err.Error()}
+	}
+	return status
+}
@@ -0,0 +1,126 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func TestIdempotentSubmit(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+
+	params := types.Data{"order": "1"}
+	result, err := flow.SubmitDAG(context.Background(), "test", "req-1", params)
+	assert.Nil(t, err)
+	assert.False(t, result.Duplicated)
+
+	// duplicate submit while running
+	result, err = flow.SubmitDAG(context.Background(), "test", "req-1", params)
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicated)
+	assert.Equal(t, types.Pending, result.Status.Status)
+	assert.True(t, errors.IsAlreadyExists(flow.RunDAG(context.Background(), "test", "req-1", params)))
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Equal(t, 2, d.trigger)
+	assert.True(t, flow.isRunningEmpty())
+
+	// duplicate submit after the request left memory, on a restarted engine
+	flow = newFlow(s, newOptions())
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	result, err = flow.SubmitDAG(context.Background(), "test", "req-1", params)
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicated)
+	assert.Equal(t, types.Finished, result.Status.Status)
+	assert.Equal(t, "1", result.Status.Result["order"])
+	assert.True(t, flow.isRunningEmpty())
+
+	// different parameters
+	result, err = flow.SubmitDAG(context.Background(), "test", "req-1", types.Data{"order": "2"})
+	assert.True(t, errors.Is(err, types.ErrIdempotencyConflict))
+	assert.True(t, result.Conflict)
+	assert.Equal(t, "req-1", result.RequestID)
+
+	// separate idempotency key
+	result, err = flow.SubmitDAG(context.Background(), "test", "req-2", params, types.WithIdempotencyKey("order-1"))
+	assert.Nil(t, err)
+	assert.False(t, result.Duplicated)
+	result, err = flow.SubmitDAG(context.Background(), "test", "req-3", params, types.WithIdempotencyKey("order-1"))
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicated)
+	assert.Equal(t, "req-2", result.RequestID)
+}
+
+func TestIdempotencyRetention(t *testing.T) {
+	opts := newOptions()
+	opts.IdempotencyRetention = 50 * time.Millisecond
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.True(t, errors.IsAlreadyExists(flow.RunDAG(context.Background(), "test", "req-1", types.Data{})))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+}
+
+// racingStore runs race once before the first GetVersion returns, as if another engine ran in the meantime
+type racingStore struct {
+	store.Store
+	race func()
+}
+
+func (s *racingStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	b, version, err := s.Store.(store.TxStore).GetVersion(ctx, prefix, key)
+	if race := s.race; race != nil {
+		s.race = nil
+		race()
+	}
+	return b, version, err
+}
+
+func (s *racingStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	return s.Store.(store.TxStore).CompareAndSet(ctx, prefix, key, value, version)
+}
+
+func (s *racingStore) Batch(ctx context.Context, ops []store.Op) error {
+	return s.Store.(store.TxStore).Batch(ctx, ops)
+}
+
+func TestIdempotentSubmit_MultiEngines(t *testing.T) {
+	s := mem.NewMemStore()
+	other := newFlow(s, newOptions())
+	assert.Nil(t, other.RegisterDAG("test", (&countDAG{}).testDAG))
+
+	// the other engine claims the key after this one found it free
+	racing := &racingStore{Store: s}
+	racing.race = func() {
+		result, err := other.SubmitDAG(context.Background(), "test", "req-1", types.Data{}, types.WithIdempotencyKey("order-1"))
+		assert.Nil(t, err)
+		assert.False(t, result.Duplicated)
+	}
+	flow := newFlow(racing, newOptions())
+	assert.Nil(t, flow.RegisterDAG("test", (&countDAG{}).testDAG))
+	result, err := flow.SubmitDAG(context.Background(), "test", "req-2", types.Data{}, types.WithIdempotencyKey("order-1"))
+	assert.Nil(t, err)
+	assert.True(t, result.Duplicated)
+	assert.Equal(t, "req-1", result.RequestID)
+	assert.True(t, flow.isRunningEmpty())
+}
@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+)
+
+func (f *flow) acquireLease(ctx context.Context, requestID string) error {
+	if f.leases == nil {
+		return nil
+	}
+	return errors.Trace(f.leases.acquire(ctx, requestID))
+}
+
+/**
+ * checkLease returns ErrLeaseHeld if the request is held by another instance,
+ * it is a cheap check before loading the request.
+ */
+func (f *flow) checkLease(ctx context.Context, requestID string) error {
+	if f.leases == nil {
+		return nil
+	}
+	lease, err := f.leases.load(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if lease != nil && lease.heldByOther(f.leases.owner, time.Now()) {
+		return errLeaseHeld(requestID, lease.Owner)
+	}
+	return nil
+}
+
+func (f *flow) releaseLease(ctx context.Context, requestID string) {
+	if f.leases == nil {
+		return
+	}
+	if err := f.leases.release(ctx, requestID); err != nil {
+		f.requestLogger(requestID).Errorf("failed to release lease: %v", err)
+	}
+}
+
+/**
+ * renewLeases renews the leases of the requests held by the engine,
+ * the ones taken over by the others are dropped without saving anything.
+ */
+func (f *flow) renewLeases(ctx context.Context) {
+	for _, requestID := range f.batchRunner.keys() {
+		err := f.leases.renew(ctx, requestID)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, types.ErrLeaseHeld) {
+			f.requestLogger(requestID).Errorf("failed to renew lease: %v", err)
+			continue
+		}
+
+		f.requestLogger(requestID).Warnf("lost the lease: %v", err)
+		if cr := f.batchRunner.get(requestID); cr != nil {
+			cr.leaseLost.Store(true)
+		}
+		f.batchRunner.remove(requestID)
+	}
+}
+
+/**
+ * takeOverRequests loads the requests which are not held by any alive instance
+ */
+func (f *flow) takeOverRequests(ctx context.Context) {
+	errs, err := f.reloadPlans(ctx)
+	if err != nil {
+		f.logger.Errorf("failed to take over requests: %v", err)
+	}
+	for requestID, err := range errs {
+		if err != nil && !errors.Is(err, errors.AlreadyExists) && !errors.IsNotFound(err) {
+			f.requestLogger(requestID).Errorf("failed to take over: %v", err)
+		}
+	}
+}
+
+/**
+ * leaseLoop renews the leases and takes over the expired ones every LeaseRenewInterval until the flow closed
+ */
+func (f *flow) leaseLoop() {
+	f.leaseExitCh = make(chan struct{})
+	go func() {
+		defer close(f.leaseExitCh)
+
+		ticker := time.NewTicker(f.opts.LeaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-f.ctx.Done():
+				return
+			case <-ticker.C:
+				f.renewLeases(f.ctx)
+				f.takeOverRequests(f.ctx)
+			}
+		}
+	}()
+}
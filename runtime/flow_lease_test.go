@@ -0,0 +1,169 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func newLeaseFlow(t *testing.T, s store.Store, instanceID string) *flow {
+	opts := newOptions()
+	types.EnableLease(instanceID)(opts)
+	types.WithLeaseTTL(50*time.Millisecond, 10*time.Millisecond)(opts)
+	flow := newFlow(s, opts)
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RegisterDAG("count", (&countDAG{}).testDAG))
+	return flow
+}
+
+func TestLeaseTakeOver(t *testing.T) {
+	s := mem.NewMemStore()
+	flowA := newLeaseFlow(t, s, "a")
+	flowB := newLeaseFlow(t, s, "b")
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, flowA.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+	}
+	assert.Nil(t, flowA.runOnce())
+	assert.Nil(t, flowA.runOnce())
+
+	// all held by a
+	errs, err := flowB.ReloadRequests(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, errs)
+	assert.True(t, flowB.isRunningEmpty())
+
+	_, err = flowB.SubmitDAG(context.Background(), "count", "count-0", types.Data{})
+	assert.Nil(t, err)
+
+	// a stops renewing, then b takes over after the leases expired
+	time.Sleep(60 * time.Millisecond)
+	flowB.renewLeases(context.Background())
+	flowB.takeOverRequests(context.Background())
+	assert.Equal(t, 5, len(flowB.batchRunner.keys()))
+
+	// a finds out the leases lost and drops them
+	err = flowA.acquireLease(context.Background(), "retry-0")
+	assert.True(t, errors.Is(err, types.ErrLeaseHeld))
+	flowA.renewLeases(context.Background())
+	assert.True(t, flowA.isRunningEmpty())
+
+	// the count request owned by b runs to the end and releases the lease
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flowB.runOnce())
+	}
+	status, err := flowB.GetRequestStatus(context.Background(), "count-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+	lease, err := flowB.leases.load(context.Background(), "count-0")
+	assert.Nil(t, err)
+	assert.Nil(t, lease)
+
+	// closing b releases the leases, so that a takes over right away
+	assert.Nil(t, flowB.Close(context.Background()))
+	flowA.takeOverRequests(context.Background())
+	assert.Equal(t, 4, len(flowA.batchRunner.keys()))
+}
+
+func TestLeaseTakeOver_Paused(t *testing.T) {
+	s := mem.NewMemStore()
+	flowA := newLeaseFlow(t, s, "a")
+	flowB := newLeaseFlow(t, s, "b")
+
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flowA.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+	}
+	assert.Nil(t, flowA.runOnce())
+	assert.Nil(t, flowA.PauseRequest(context.Background(), "retry-0"))
+
+	// a crashes, then b takes over the request paused by the operator as it is
+	time.Sleep(60 * time.Millisecond)
+	flowB.takeOverRequests(context.Background())
+	assert.Equal(t, 2, len(flowB.batchRunner.keys()))
+	status, err := flowB.GetRequestStatus(context.Background(), "retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flowB.runOnce())
+	}
+	status, err = flowB.GetRequestStatus(context.Background(), "retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	status, err = flowB.GetRequestStatus(context.Background(), "retry-1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, types.Paused, status.Status)
+
+	// closing b suspends the running requests only, a resumes them right away
+	assert.Nil(t, flowB.RunDAG(context.Background(), "retry", "retry-2", types.Data{}))
+	assert.Nil(t, flowB.Close(context.Background()))
+	flowA.takeOverRequests(context.Background())
+	status, err = flowA.GetRequestStatus(context.Background(), "retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	status, err = flowA.GetRequestStatus(context.Background(), "retry-2")
+	assert.Nil(t, err)
+	assert.NotEqual(t, types.Paused, status.Status)
+}
+
+func TestLeaseMultiEngines(t *testing.T) {
+	s := mem.NewMemStore()
+	engines := make([]*flow, 0, 3)
+	for i := 0; i < 3; i++ {
+		opts := newAsyncOptions(10)
+		opts.AutoStart = true
+		types.EnableLease(fmt.Sprintf("engine-%d", i))(opts)
+		types.WithLeaseTTL(50*time.Millisecond, 10*time.Millisecond)(opts)
+
+		d := &countDAG{}
+		engine := newFlow(s, opts)
+		assert.Nil(t, engine.RegisterDAG("count", d.testDAG))
+		engines = append(engines, engine)
+	}
+
+	for i := 0; i < 30; i++ {
+		assert.Nil(t, engines[i%3].RunDAG(context.Background(), "count", fmt.Sprintf("count-%d", i), types.Data{}))
+	}
+
+	assert.Eventually(t, func() bool {
+		list, err := engines[0].ListRequests(context.Background(), &types.RequestFilter{Statuses: []types.StatusType{types.Finished}})
+		return err == nil && len(list.Requests) == 30
+	}, time.Second, 10*time.Millisecond)
+
+	for _, engine := range engines {
+		assert.Nil(t, engine.Close(context.Background()))
+	}
+	assert.Equal(t, 0, countKeys(t, s, LeasePath))
+}
+
+func TestLeaseReleased_UnresolvedEntrypoint(t *testing.T) {
+	s := mem.NewMemStore()
+	flowA := newLeaseFlow(t, s, "a")
+	assert.Nil(t, flowA.RunDAG(context.Background(), "retry", "retry-0", types.Data{}))
+	assert.Nil(t, flowA.runOnce())
+	assert.Nil(t, flowA.Close(context.Background()))
+
+	// the vertex the request stopped at is gone from the plan
+	b, err := s.Get(context.Background(), RunContextPath, "retry-0")
+	assert.Nil(t, err)
+	reRC := &flowRerunContext{}
+	assert.Nil(t, utils.Unserialize(b, reRC))
+	reRC.Entrypoint = utils.NewPath("retry", "missing")
+	b, err = utils.Serialize(reRC)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Set(context.Background(), RunContextPath, "retry-0", b))
+
+	flowB := newLeaseFlow(t, s, "b")
+	errs, err := flowB.ReloadRequests(context.Background())
+	assert.Nil(t, err)
+	assert.True(t, errors.IsNotFound(errs["retry-0"]))
+	assert.True(t, flowB.isRunningEmpty())
+	assert.Equal(t, 0, countKeys(t, s, LeasePath))
+}
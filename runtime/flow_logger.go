@@ -0,0 +1,39 @@
+package runtime
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/warriorguo/workflow/types"
+)
+
+func defaultLogger() types.Logger {
+	return types.NewLogrusLogger(logrus.StandardLogger())
+}
+
+/**
+ * requestLogger returns the logger of the request which is not run by the engine,
+ * the one of a running request is contextRunner.logger which carries the DAG as well.
+ */
+func (fe *flowExecute) requestLogger(requestID string) types.Logger {
+	return fe.logger.WithFields(types.LogFields{types.LogFieldRequestID: requestID})
+}
+
+func runnerLogger(logger types.Logger, requestID string, meta *requestMeta) types.Logger {
+	fields := types.LogFields{
+		types.LogFieldRequestID: requestID,
+		types.LogFieldDAG:       meta.DAGName,
+	}
+	if meta.Tenant != "" {
+		fields[types.LogFieldTenant] = meta.Tenant
+	}
+	return logger.WithFields(fields)
+}
+
+/**
+ * Logger returns the logger of the request, with the vertex running if there is
+ */
+func (f *flowContext) Logger() types.Logger {
+	if len(f.executePath) == 0 {
+		return f.logger
+	}
+	return f.logger.WithFields(types.LogFields{types.LogFieldVertex: f.GetCurrentVertex()})
+}
@@ -0,0 +1,109 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type logEntry struct {
+	level   string
+	message string
+	fields  types.LogFields
+}
+
+type logRecorder struct {
+	mu      sync.Mutex
+	entries []*logEntry
+}
+
+type recordLogger struct {
+	recorder *logRecorder
+	fields   types.LogFields
+}
+
+func (l *recordLogger) log(level, format string, args ...any) {
+	l.recorder.mu.Lock()
+	defer l.recorder.mu.Unlock()
+	l.recorder.entries = append(l.recorder.entries, &logEntry{level: level, message: fmt.Sprintf(format, args...), fields: l.fields})
+}
+
+func (l *recordLogger) Debugf(format string, args ...any) { l.log("debug", format, args...) }
+func (l *recordLogger) Infof(format string, args ...any)  { l.log("info", format, args...) }
+func (l *recordLogger) Warnf(format string, args ...any)  { l.log("warn", format, args...) }
+func (l *recordLogger) Errorf(format string, args ...any) { l.log("error", format, args...) }
+
+func (l *recordLogger) WithFields(fields types.LogFields) types.Logger {
+	merged := make(types.LogFields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &recordLogger{recorder: l.recorder, fields: merged}
+}
+
+// find returns the first entry of the message with the prefix
+func (r *logRecorder) find(prefix string) *logEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, entry := range r.entries {
+		if strings.HasPrefix(entry.message, prefix) {
+			return entry
+		}
+	}
+	return nil
+}
+
+func TestLogger(t *testing.T) {
+	recorder := &logRecorder{}
+	opts := newOptions()
+	types.WithLogger(&recordLogger{recorder: recorder})(opts)
+	types.WithEventListener(func(event *types.LifecycleEvent) {
+		if event.Type == types.LifecycleFinished {
+			panic("broken listener")
+		}
+	})(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	greet := func(ctx types.Context, input types.Data) (types.Data, error) {
+		ctx.Logger().Infof("hello %s", ctx.GetRequestID())
+		return input, nil
+	}
+	assert.Nil(t, flow.RegisterDAG("test", func(dag types.DAG) error {
+		return dag.Node("greet", greet)
+	}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}, types.WithTenant("acme")))
+	assert.Nil(t, flow.runOnce())
+
+	// the logger of the handler
+	entry := recorder.find("hello req-1")
+	assert.NotNil(t, entry)
+	assert.Equal(t, "info", entry.level)
+	assert.Equal(t, types.LogFields{
+		types.LogFieldRequestID: "req-1",
+		types.LogFieldDAG:       "test",
+		types.LogFieldTenant:    "acme",
+		types.LogFieldVertex:    "test.greet",
+	}, entry.fields)
+
+	// the logs of the engine
+	entry = recorder.find("listener panics on Finished event: broken listener")
+	assert.NotNil(t, entry)
+	assert.Equal(t, "error", entry.level)
+	assert.Equal(t, "req-1", entry.fields[types.LogFieldRequestID])
+	assert.Equal(t, "test", entry.fields[types.LogFieldDAG])
+
+	assert.Nil(t, flow.PurgeRequest(context.Background(), "req-1"))
+	entry = recorder.find("purged")
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, "req-1", entry.fields[types.LogFieldRequestID])
+	}
+}
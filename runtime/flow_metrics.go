@@ -0,0 +1,177 @@
+package runtime
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/metrics"
+	"github.com/warriorguo/workflow/types"
+)
+
+const (
+	vertexSucceeded = "succeeded"
+	vertexFailed    = "failed"
+	vertexRetry     = "retry"
+	vertexPaused    = "paused"
+)
+
+/**
+ * flowMetrics keeps the engine-wide metrics per DAG and vertex,
+ * the ones of the requests and the vertices are collected from the lifecycle events.
+ */
+type flowMetrics struct {
+	registry *metrics.Registry
+
+	submitted       *metrics.CounterVec
+	terminated      *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	activeRequests  *metrics.GaugeVec
+
+	vertexRunning  *metrics.GaugeVec
+	vertexRuns     *metrics.CounterVec
+	vertexDuration *metrics.HistogramVec
+	vertexRetries  *metrics.CounterVec
+
+	queueDepth   *metrics.GaugeVec
+	schedulerLag *metrics.HistogramVec
+	// the DAGs reported by the last scheduling round, only touched by batchRunner under its lock
+	queuedDAGs map[string]bool
+}
+
+func newFlowMetrics() *flowMetrics {
+	r := metrics.NewRegistry()
+	return &flowMetrics{
+		registry: r,
+
+		submitted: r.NewCounterVec("workflow_requests_submitted_total",
+			"Requests accepted by RunDAG or SubmitDAG.", "dag"),
+		terminated: r.NewCounterVec("workflow_requests_terminated_total",
+			"Requests came to a terminal status.", "dag", "status"),
+		requestDuration: r.NewHistogramVec("workflow_request_duration_seconds",
+			"Time from the submission to the termination of the requests.", nil, "dag", "status"),
+		activeRequests: r.NewGaugeVec("workflow_requests_active",
+			"Requests held by the engine which are not terminated.", "dag"),
+
+		vertexRunning: r.NewGaugeVec("workflow_vertex_running",
+			"Vertices running right now.", "dag", "vertex"),
+		vertexRuns: r.NewCounterVec("workflow_vertex_runs_total",
+			"Runs of the vertices by the result, which is succeeded, failed, retry or paused.", "dag", "vertex", "result"),
+		vertexDuration: r.NewHistogramVec("workflow_vertex_duration_seconds",
+			"Duration of the runs of the vertices.", nil, "dag", "vertex"),
+		vertexRetries: r.NewCounterVec("workflow_vertex_retries_total",
+			"Retries scheduled for the vertices.", "dag", "vertex"),
+
+		queueDepth: r.NewGaugeVec("workflow_queue_depth",
+			"Requests ready to run but not picked by the last scheduling round.", "dag"),
+		schedulerLag: r.NewHistogramVec("workflow_scheduler_lag_seconds",
+			"Time from a request being ready to run to being picked by the scheduler.", nil, "dag"),
+		queuedDAGs: make(map[string]bool),
+	}
+}
+
+/**
+ * observe is the listener of the lifecycle events
+ */
+func (m *flowMetrics) observe(event *types.LifecycleEvent) {
+	vertex := strings.Join(event.Path, ".")
+	switch event.Type {
+	case types.LifecycleSubmitted:
+		m.submitted.Inc(event.DAGName)
+	case types.LifecycleVertexFinished, types.LifecycleVertexFailed:
+		m.vertexRuns.Inc(event.DAGName, vertex, vertexResult(event.Err))
+		m.vertexDuration.Observe(event.Duration().Seconds(), event.DAGName, vertex)
+	case types.LifecycleRetryScheduled:
+		m.vertexRetries.Inc(event.DAGName, vertex)
+	case types.LifecycleFinished, types.LifecycleTerminated:
+		status := statusLabel(event.Status)
+		m.terminated.Inc(event.DAGName, status)
+		m.requestDuration.Observe(event.Duration().Seconds(), event.DAGName, status)
+	}
+}
+
+func statusLabel(status types.StatusType) string {
+	switch status {
+	case types.Finished:
+		return "finished"
+	case types.Failed:
+		return "failed"
+	case types.Fatal:
+		return "fatal"
+	}
+	return strconv.Itoa(int(status))
+}
+
+func vertexResult(err error) string {
+	if err == nil {
+		return vertexSucceeded
+	}
+	if _, ok := errors.AsType[*types.RetryError](err); ok {
+		return vertexRetry
+	}
+	if _, ok := errors.AsType[*types.PauseError](err); ok {
+		return vertexPaused
+	}
+	return vertexFailed
+}
+
+func (m *flowMetrics) requestAdded(r *contextRunner) {
+	if m != nil {
+		m.activeRequests.Add(1, r.meta.DAGName)
+	}
+}
+
+func (m *flowMetrics) requestRemoved(r *contextRunner) {
+	if m != nil {
+		m.activeRequests.Add(-1, r.meta.DAGName)
+	}
+}
+
+/**
+ * vertexRunningAdd updates the running vertices by delta around the node run,
+ * rather than by the events which are emitted after the node finished.
+ */
+func (m *flowMetrics) vertexRunningAdd(delta float64, r *contextRunner, path []string) {
+	if m != nil {
+		m.vertexRunning.Add(delta, r.meta.DAGName, strings.Join(path, "."))
+	}
+}
+
+/**
+ * scheduled records the lag of the picked runners,
+ * and the depth of the queue which is the candidates left to the next rounds.
+ */
+func (m *flowMetrics) scheduled(candidates, picked []*contextRunner) {
+	if m == nil {
+		return
+	}
+	now := time.Now()
+	depth := make(map[string]int)
+	for _, r := range candidates {
+		depth[r.meta.DAGName]++
+	}
+	for _, r := range picked {
+		depth[r.meta.DAGName]--
+		lag := now.Sub(r.readyTime)
+		if lag < 0 {
+			lag = 0
+		}
+		m.schedulerLag.Observe(lag.Seconds(), r.meta.DAGName)
+	}
+	for dagName := range m.queuedDAGs {
+		if _, exists := depth[dagName]; !exists {
+			m.queueDepth.Set(0, dagName)
+			delete(m.queuedDAGs, dagName)
+		}
+	}
+	for dagName, n := range depth {
+		m.queueDepth.Set(float64(n), dagName)
+		m.queuedDAGs[dagName] = true
+	}
+}
+
+func (f *flow) MetricsHandler() http.Handler {
+	return f.metrics.registry
+}
@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func scrapeMetrics(t *testing.T, flow *flow) string {
+	w := httptest.NewRecorder()
+	flow.MetricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+	assert.Nil(t, flow.RegisterDAG("test", (&validateDAG{}).testDAG))
+	r := &retryOnceDAG{}
+	assert.Nil(t, flow.RegisterDAG("retry", r.testDAG))
+
+	ctx := context.Background()
+	assert.Nil(t, flow.RunDAG(ctx, "test", "req-1", types.Data{"valid": true}))
+	assert.Nil(t, flow.RunDAG(ctx, "test", "req-2", types.Data{"valid": false}))
+	assert.Nil(t, flow.RunDAG(ctx, "retry", "req-3", types.Data{}))
+	text := scrapeMetrics(t, flow)
+	assert.Contains(t, text, `workflow_requests_submitted_total{dag="test"} 2`)
+	assert.Contains(t, text, `workflow_requests_active{dag="retry"} 1`)
+
+	assert.Nil(t, flow.runOnce())
+	assert.Nil(t, flow.TerminateRequest(ctx, "req-3"))
+	assert.Nil(t, flow.runOnce())
+
+	text = scrapeMetrics(t, flow)
+	for _, line := range []string{
+		"# TYPE workflow_vertex_duration_seconds histogram",
+		`workflow_vertex_runs_total{dag="test",vertex="test.node1",result="succeeded"} 2`,
+		`workflow_vertex_runs_total{dag="test",vertex="test.validate",result="succeeded"} 1`,
+		`workflow_vertex_runs_total{dag="test",vertex="test.validate",result="paused"} 1`,
+		`workflow_vertex_runs_total{dag="retry",vertex="retry.node1",result="retry"} 1`,
+		`workflow_vertex_retries_total{dag="retry",vertex="retry.node1"} 1`,
+		`workflow_vertex_running{dag="test",vertex="test.node1"} 0`,
+		`workflow_vertex_duration_seconds_count{dag="test",vertex="test.node1"} 2`,
+		`workflow_vertex_duration_seconds_bucket{dag="test",vertex="test.node1",le="+Inf"} 2`,
+		`workflow_requests_terminated_total{dag="test",status="finished"} 1`,
+		`workflow_requests_terminated_total{dag="retry",status="fatal"} 1`,
+		`workflow_request_duration_seconds_count{dag="test",status="finished"} 1`,
+		`workflow_requests_active{dag="test"} 1`,
+		`workflow_requests_active{dag="retry"} 0`,
+		`workflow_queue_depth{dag="test"} 0`,
+		`workflow_scheduler_lag_seconds_count{dag="test"} 4`,
+	} {
+		assert.Contains(t, text, line)
+	}
+}
+
+func TestMetrics_QueueDepth(t *testing.T) {
+	opts := newOptions()
+	opts.MaxNodeConcurrency = 1
+	flow := newFlow(mem.NewMemStore(), opts)
+	assert.Nil(t, flow.RegisterDAG("test", (&validateDAG{}).testDAG))
+
+	ctx := context.Background()
+	for _, requestID := range []string{"req-1", "req-2", "req-3"} {
+		assert.Nil(t, flow.RunDAG(ctx, "test", requestID, types.Data{"valid": true}))
+	}
+	assert.Nil(t, flow.runOnce())
+	text := scrapeMetrics(t, flow)
+	assert.Contains(t, text, `workflow_queue_depth{dag="test"} 2`)
+	assert.Contains(t, text, `workflow_scheduler_lag_seconds_count{dag="test"} 1`)
+}
+
+func TestMetrics_VertexRunning(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+	running := make(chan struct{})
+	release := make(chan struct{})
+	assert.Nil(t, flow.RegisterDAG("test", func(dag types.DAG) error {
+		return errors.Trace(dag.Node("node1", func(ctx types.Context, input types.Data) (types.Data, error) {
+			close(running)
+			<-release
+			return input, nil
+		}))
+	}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.Nil(t, flow.runOnce())
+	}()
+
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the node is not run")
+	}
+	assert.Contains(t, scrapeMetrics(t, flow), `workflow_vertex_running{dag="test",vertex="test.node1"} 1`)
+	close(release)
+	<-done
+	assert.Contains(t, scrapeMetrics(t, flow), `workflow_vertex_running{dag="test",vertex="test.node1"} 0`)
+}
@@ -0,0 +1,332 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	// ControlChannel is the notifier channel the engines exchange the control messages on
+	ControlChannel = "workflow_control"
+)
+
+type controlType string
+
+const (
+	controlPause     controlType = "pause"
+	controlResume    controlType = "resume"
+	controlTerminate controlType = "terminate"
+	controlOverride  controlType = "override"
+	controlPatch     controlType = "patch"
+	controlRestart   controlType = "restart"
+	// controlReply carries the result of a control applied by the engine running the request
+	controlReply controlType = "reply"
+	// controlReleased wakes up the other engines to take over the requests released by a closing engine
+	controlReleased controlType = "released"
+)
+
+/**
+ * controlMessage is sent by the engine a control operation is called on to the engine running the request
+ */
+type controlMessage struct {
+	ID   string
+	From string
+	// To is the instance holding the lease of the request, empty for all
+	To        string      `json:",omitempty"`
+	Type      controlType `json:",omitempty"`
+	RequestID string      `json:",omitempty"`
+	Operator  string      `json:",omitempty"`
+
+	Override *types.VertexOverride `json:",omitempty"`
+	Patch    types.Data            `json:",omitempty"`
+	Vertex   string                `json:",omitempty"`
+	Data     *types.Data           `json:",omitempty"`
+
+	// ReplyTo is the ID of the message replied
+	ReplyTo   string `json:",omitempty"`
+	Error     string `json:",omitempty"`
+	ErrorType string `json:",omitempty"`
+}
+
+// remoteErrorTypes are kept along with the errors replied, so that the callers check them the same as the local ones
+var remoteErrorTypes = map[string]errors.ConstError{
+	"NotFound":        errors.NotFound,
+	"Forbidden":       errors.Forbidden,
+	"NotValid":        errors.NotValid,
+	"NotYetAvailable": errors.NotYetAvailable,
+	"LeaseHeld":       types.ErrLeaseHeld,
+}
+
+func encodeRemoteError(msg *controlMessage, err error) {
+	msg.Error = err.Error()
+	for name, errType := range remoteErrorTypes {
+		if errors.Is(err, errType) {
+			msg.ErrorType = name
+			return
+		}
+	}
+}
+
+func decodeRemoteError(msg *controlMessage) error {
+	if msg.Error == "" {
+		return nil
+	}
+	err := errors.Errorf("%s: %s", msg.From, msg.Error)
+	if errType, ok := remoteErrorTypes[msg.ErrorType]; ok {
+		return errors.WithType(err, errType)
+	}
+	return err
+}
+
+/**
+ * controlNotifier sends the control messages through the notifier of the options and waits for the replies
+ */
+type controlNotifier struct {
+	seq         atomic.Int64
+	unsubscribe func()
+
+	mu      sync.Mutex
+	pending map[string]chan *controlMessage
+}
+
+/**
+ * subscribeControl starts receiving the control messages if there is a notifier
+ */
+func (f *flow) subscribeControl() error {
+	if f.opts.Notifier == nil {
+		return nil
+	}
+	// set ahead, the messages may arrive before Subscribe returns
+	f.control = &controlNotifier{pending: make(map[string]chan *controlMessage)}
+	unsubscribe, err := f.opts.Notifier.Subscribe(ControlChannel, f.onControlMessage)
+	if err != nil {
+		f.control = nil
+		return errors.Trace(err)
+	}
+	f.control.unsubscribe = unsubscribe
+	return nil
+}
+
+func (f *flow) nextControlID() string {
+	return fmt.Sprintf("%s-%d", f.instanceID, f.control.seq.Add(1))
+}
+
+func (f *flow) publishControl(ctx context.Context, msg *controlMessage) error {
+	if msg.ID == "" {
+		msg.ID = f.nextControlID()
+	}
+	msg.From = f.instanceID
+	b, err := utils.Serialize(msg)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.opts.Notifier.Publish(ctx, ControlChannel, b))
+}
+
+/**
+ * requestOwner returns the instance to send the control of the request to, and false if it is applied by this engine.
+ * With leases it is the alive lease holder, otherwise all of the engines if the request is not terminated.
+ */
+func (f *flow) requestOwner(ctx context.Context, requestID string) (string, bool, error) {
+	if f.leases != nil {
+		lease, err := f.leases.load(ctx, requestID)
+		if err != nil {
+			return "", false, errors.Trace(err)
+		}
+		if lease != nil && lease.heldByOther(f.leases.owner, time.Now()) {
+			return lease.Owner, true, nil
+		}
+		return "", false, nil
+	}
+
+	status, found, err := f.persistedStatus(ctx, requestID)
+	if err != nil {
+		return "", false, errors.Trace(err)
+	}
+	return "", found && !status.IsTerminal(), nil
+}
+
+/**
+ * controlRequest applies the control if the request is run by this engine,
+ * otherwise it is sent to the engine running the request and the result is waited for NotifyTimeout.
+ */
+func (f *flow) controlRequest(ctx context.Context, requestID string, msg *controlMessage) error {
+	msg.RequestID = requestID
+	if f.control == nil || f.batchRunner.exists(requestID) {
+		return f.applyControl(ctx, msg)
+	}
+	owner, remote, err := f.requestOwner(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !remote {
+		return f.applyControl(ctx, msg)
+	}
+
+	msg.To = owner
+	msg.Operator = types.OperatorFromContext(ctx)
+	msg.ID = f.nextControlID()
+	replyCh := make(chan *controlMessage, 1)
+	f.control.mu.Lock()
+	f.control.pending[msg.ID] = replyCh
+	f.control.mu.Unlock()
+	defer func() {
+		f.control.mu.Lock()
+		delete(f.control.pending, msg.ID)
+		f.control.mu.Unlock()
+	}()
+	if err := encodeControl(f.codec, msg); err != nil {
+		return errors.Trace(err)
+	}
+	if err := f.publishControl(ctx, msg); err != nil {
+		return errors.Trace(err)
+	}
+
+	timer := time.NewTimer(f.opts.NotifyTimeout)
+	defer timer.Stop()
+	select {
+	case reply := <-replyCh:
+		return decodeRemoteError(reply)
+	case <-ctx.Done():
+		return errors.Trace(ctx.Err())
+	case <-timer.C:
+		if owner == "" {
+			// nobody runs the request
+			return errors.NotFoundf("request id: %s", requestID)
+		}
+		return errors.Timeoutf("%s of request %s sent to %s", msg.Type, requestID, owner)
+	}
+}
+
+/**
+ * applyControl applies the control on the request run by this engine
+ */
+func (f *flow) applyControl(ctx context.Context, msg *controlMessage) error {
+	switch msg.Type {
+	case controlPause:
+		return f.setExecutePlanStatus(ctx, msg.RequestID, types.Paused)
+	case controlResume:
+		return f.setExecutePlanStatus(ctx, msg.RequestID, types.Retrying)
+	case controlTerminate:
+		return f.setExecutePlanStatus(ctx, msg.RequestID, types.Fatal)
+	case controlOverride:
+		if msg.Override == nil {
+			return errors.NotValidf("empty override")
+		}
+		return f.applyOverride(ctx, msg.RequestID, msg.Override)
+	case controlPatch:
+		return f.patchRequestData(ctx, msg.RequestID, msg.Patch)
+	case controlRestart:
+		return f.restartRequestFrom(ctx, msg.RequestID, msg.Vertex, msg.Data)
+	}
+	return errors.NotSupportedf("control %s", msg.Type)
+}
+
+/**
+ * onControlMessage handles the messages from the notifier, the controls are applied in goroutines of their own,
+ * so that a control waiting for the running node does not hold up the others.
+ */
+func (f *flow) onControlMessage(payload []byte) {
+	msg := &controlMessage{}
+	if err := utils.Unserialize(payload, msg); err != nil {
+		f.logger.Errorf("unserialize control message %s failed: %v", string(payload), err)
+		return
+	}
+	if msg.From == f.instanceID || (msg.To != "" && msg.To != f.instanceID) {
+		return
+	}
+
+	switch msg.Type {
+	case controlReply:
+		f.control.mu.Lock()
+		replyCh := f.control.pending[msg.ReplyTo]
+		f.control.mu.Unlock()
+		if replyCh != nil {
+			select {
+			case replyCh <- msg:
+			default:
+				// replied by another engine already
+			}
+		}
+	case controlReleased:
+		if f.leases != nil && f.running.Load() {
+			go f.takeOverRequests(f.ctx)
+		}
+	default:
+		// the broadcast is answered by the engine running the request only
+		if msg.To == "" && !f.batchRunner.exists(msg.RequestID) {
+			return
+		}
+		go f.replyControl(msg)
+	}
+}
+
+// encodeControl converts the Data carried by the message with the codec before it is sent
+func encodeControl(codec types.DataCodec, msg *controlMessage) error {
+	var err error
+	if msg.Patch, err = codec.Encode(msg.Patch); err != nil {
+		return errors.Annotatef(err, "patch")
+	}
+	if msg.Data != nil {
+		data, err := codec.Encode(*msg.Data)
+		if err != nil {
+			return errors.Annotatef(err, "data")
+		}
+		msg.Data = &data
+	}
+	msg.Override, err = encodeOverride(codec, msg.Override)
+	return errors.Trace(err)
+}
+
+func decodeControl(codec types.DataCodec, msg *controlMessage) error {
+	var err error
+	if msg.Patch, err = codec.Decode(msg.Patch); err != nil {
+		return errors.Annotatef(err, "patch")
+	}
+	if msg.Data != nil {
+		data, err := codec.Decode(*msg.Data)
+		if err != nil {
+			return errors.Annotatef(err, "data")
+		}
+		msg.Data = &data
+	}
+	return errors.Trace(decodeOverride(codec, msg.Override))
+}
+
+func (f *flow) replyControl(msg *controlMessage) {
+	ctx := types.WithOperator(f.ctx, msg.Operator)
+	reply := &controlMessage{To: msg.From, Type: controlReply, RequestID: msg.RequestID, ReplyTo: msg.ID}
+	if err := decodeControl(f.codec, msg); err != nil {
+		encodeRemoteError(reply, errors.NewNotValid(err, "control message"))
+	} else if err := f.applyControl(ctx, msg); err != nil {
+		encodeRemoteError(reply, err)
+	}
+	if err := f.publishControl(f.ctx, reply); err != nil {
+		f.requestLogger(msg.RequestID).Errorf("failed to reply %s from %s: %v", msg.Type, msg.From, err)
+	}
+}
+
+/**
+ * notifyReleased wakes up the other engines to take over the requests released by this engine
+ */
+func (f *flow) notifyReleased(ctx context.Context) {
+	if f.control == nil || f.leases == nil {
+		return
+	}
+	if err := f.publishControl(ctx, &controlMessage{Type: controlReleased}); err != nil {
+		f.logger.Errorf("failed to notify the released requests: %v", err)
+	}
+}
+
+func (f *flow) unsubscribeControl() {
+	if f.control != nil {
+		f.control.unsubscribe()
+	}
+}
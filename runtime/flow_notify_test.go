@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/notify"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func newNotifyFlow(t *testing.T, s store.Store, n notify.Notifier, instanceID string, lease bool) *flow {
+	opts := newOptions()
+	if lease {
+		types.EnableLease(instanceID)(opts)
+	} else {
+		opts.InstanceID = instanceID
+	}
+	types.WithNotifier(n)(opts)
+	types.WithNotifyTimeout(time.Second)(opts)
+	flow := newFlow(s, opts)
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	return flow
+}
+
+func TestNotifyControl(t *testing.T) {
+	ctx := context.Background()
+	s := mem.NewMemStore()
+	n := notify.NewMemNotifier()
+	flowA := newNotifyFlow(t, s, n, "a", true)
+	flowB := newNotifyFlow(t, s, n, "b", true)
+
+	assert.Nil(t, flowA.RunDAG(ctx, "retry", "retry-0", types.Data{}))
+	assert.Nil(t, flowA.runOnce())
+	assert.Nil(t, flowA.runOnce())
+
+	// paused by b on the engine holding the lease
+	assert.Nil(t, flowB.PauseRequest(types.WithOperator(ctx, "alice"), "retry-0"))
+	assert.False(t, flowB.batchRunner.exists("retry-0"))
+	status, err := flowA.getExecutePlanStatus("retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	history, err := flowA.GetRequestHistory(ctx, "retry-0", 0, 0)
+	assert.Nil(t, err)
+	last := history.Events[len(history.Events)-1]
+	assert.Equal(t, types.EventStatusChanged, last.Type)
+	assert.Equal(t, "alice", last.Operator)
+
+	assert.Nil(t, flowB.PatchRequestData(ctx, "retry-0", types.Data{"patched": true}))
+	data, err := flowA.GetRequestData(ctx, "retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, true, data["patched"])
+
+	// the error types are kept
+	assert.Nil(t, flowB.ResumeRequest(ctx, "retry-0"))
+	err = flowB.PatchRequestData(ctx, "retry-0", types.Data{"patched": false})
+	assert.True(t, errors.Is(err, errors.Forbidden))
+
+	assert.Nil(t, flowB.TerminateRequest(ctx, "retry-0"))
+	status, err = flowA.GetRequestStatus(ctx, "retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, status.Status)
+
+	// released on termination, so applied by b itself
+	err = flowB.PauseRequest(ctx, "retry-0")
+	assert.True(t, errors.Is(err, errors.NotFound))
+}
+
+func TestNotifyControl_Broadcast(t *testing.T) {
+	ctx := context.Background()
+	s := mem.NewMemStore()
+	n := notify.NewMemNotifier()
+	flowA := newNotifyFlow(t, s, n, "a", false)
+	flowB := newNotifyFlow(t, s, n, "b", false)
+	flowC := newNotifyFlow(t, s, n, "c", false)
+
+	assert.Nil(t, flowA.RunDAG(ctx, "retry", "retry-0", types.Data{}))
+	assert.Nil(t, flowA.runOnce())
+
+	// answered by a only
+	assert.Nil(t, flowC.PauseRequest(ctx, "retry-0"))
+	status, err := flowA.getExecutePlanStatus("retry-0")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	assert.False(t, flowB.batchRunner.exists("retry-0"))
+
+	err = flowC.PauseRequest(ctx, "retry-1")
+	assert.True(t, errors.Is(err, errors.NotFound))
+}
+
+func TestNotifyReleased(t *testing.T) {
+	ctx := context.Background()
+	s := mem.NewMemStore()
+	n := notify.NewMemNotifier()
+	flowA := newNotifyFlow(t, s, n, "a", true)
+	flowB := newNotifyFlow(t, s, n, "b", true)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flowA.RunDAG(ctx, "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+	}
+	assert.Nil(t, flowA.runOnce())
+
+	// b takes over without waiting for its lease loop
+	assert.Nil(t, flowA.Close(ctx))
+	assert.Eventually(t, func() bool {
+		return len(flowB.batchRunner.keys()) == 3
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+)
+
+func canOverride(status types.StatusType) bool {
+	return status == types.Paused || status == types.Retrying || status == types.Failed
+}
+
+func (f *flow) SkipVertex(ctx context.Context, requestID string, output types.Data) error {
+	return f.overrideVertex(ctx, requestID, &types.VertexOverride{
+		Type:     types.OverrideSkip,
+		Output:   output,
+		Operator: types.OperatorFromContext(ctx),
+	})
+}
+
+func (f *flow) ForceBranch(ctx context.Context, requestID string, branch bool) error {
+	return f.overrideVertex(ctx, requestID, &types.VertexOverride{
+		Type:     types.OverrideForceBranch,
+		Branch:   branch,
+		Operator: types.OperatorFromContext(ctx),
+	})
+}
+
+func (f *flow) overrideVertex(ctx context.Context, requestID string, o *types.VertexOverride) error {
+	if !f.running.Load() {
+		return errors.MethodNotAllowedf("not running")
+	}
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlOverride, Override: o})
+}
+
+func (f *flow) applyOverride(ctx context.Context, requestID string, o *types.VertexOverride) error {
+	relaunch := true
+	cr := f.batchRunner.get(requestID)
+	if cr != nil {
+		status, err := cr.getStatus()
+		if err != nil {
+			return errors.Trace(err)
+		}
+		relaunch = status.Status == types.Failed
+	}
+	var err error
+	if relaunch {
+		// the failed request or the one not in memory has to be launched again
+		err = f.relaunchWithOverride(ctx, requestID, o)
+	} else {
+		err = cr.setOverride(ctx, o)
+	}
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	message := "skipped"
+	if o.Type == types.OverrideForceBranch {
+		message = fmt.Sprintf("forced the %v branch", o.Branch)
+	}
+	appendHistory(ctx, f.store, f.requestLogger(requestID), requestID, &types.HistoryEvent{
+		Type:     types.EventVertexOverridden,
+		Vertex:   o.Vertex,
+		Status:   types.Retrying,
+		Operator: o.Operator,
+		Message:  message,
+	})
+	return nil
+}
+
+func (f *flow) relaunchWithOverride(ctx context.Context, requestID string, o *types.VertexOverride) error {
+	dag, reRC, err := f.loadPlan(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	status, err := f.currentRequestStatus(ctx, requestID, reRC)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !canOverride(status) {
+		return errors.Forbiddenf("request %s is %v", requestID, status)
+	}
+	if reRC == nil {
+		return errors.NotFoundf("rerun context: %s", requestID)
+	}
+
+	dr, err := dag.generateRuntime(f.gl, nil, reRC.Entrypoint)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := prepareOverride(dr, o); err != nil {
+		return errors.Trace(err)
+	}
+	meta, err := f.restartMeta(ctx, requestID, dag, reRC)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := f.takeOverRunner(requestID); err != nil {
+		return errors.Trace(err)
+	}
+	return f.launchDAG(ctx, dag, requestID, meta, reRC.Data, reRC.Entrypoint, o, types.Pending, func() error {
+		return errors.Trace(f.removeSummary(ctx, requestID))
+	})
+}
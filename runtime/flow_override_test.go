@@ -0,0 +1,116 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type stuckDAG struct {
+	trigger map[string]int
+}
+
+func (d *stuckDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("broken", func(ctx types.Context, input types.Data) (types.Data, error) {
+		d.trigger["broken"]++
+		return nil, types.NewRetryErrorf(time.Hour, "downstream is broken")
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	for _, name := range []string{"normal", "fallback"} {
+		name := name
+		if err := dag.Node(name, func(ctx types.Context, input types.Data) (types.Data, error) {
+			d.trigger[name]++
+			return input, nil
+		}); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := dag.Condition("route", "normal", "fallback", func(ctx types.Context, input types.Data) (bool, error) {
+		d.trigger["route"]++
+		return false, errors.New("unknown route")
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("broken", "route"))
+}
+
+func TestOverrideVertex(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &stuckDAG{trigger: make(map[string]int)}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+
+	// running ones can not be overridden
+	err := flow.SkipVertex(context.Background(), "req-1", types.Data{"skipped": true})
+	assert.True(t, errors.Is(err, errors.Forbidden))
+
+	assert.Nil(t, flow.runOnce())
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Retrying, status.Status)
+
+	// the override must match the vertex type
+	err = flow.ForceBranch(context.Background(), "req-1", true)
+	assert.True(t, errors.IsNotSupported(err))
+
+	ctx := types.WithOperator(context.Background(), "alice")
+	assert.Nil(t, flow.SkipVertex(ctx, "req-1", types.Data{"skipped": true}))
+	assert.Nil(t, flow.runOnce())
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 1, d.trigger["broken"])
+	assert.Equal(t, 1, d.trigger["route"])
+
+	status, err = flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Failed, status.Status)
+	assert.True(t, flow.isRunningEmpty())
+
+	// the failed request is launched again on another engine
+	flow = newFlow(s, newOptions())
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.ForceBranch(ctx, "req-1", false))
+	assert.Nil(t, flow.runOnce())
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 1, d.trigger["route"])
+	assert.Equal(t, 0, d.trigger["normal"])
+	assert.Equal(t, 1, d.trigger["fallback"])
+
+	result, err := flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, types.Data{"skipped": true}, result.Result)
+
+	skipped := result.NodeTraceData["test.broken"].Override
+	assert.Equal(t, types.OverrideSkip, skipped.Type)
+	assert.Equal(t, "alice", skipped.Operator)
+	forced := result.NodeTraceData["test.route"].Override
+	assert.Equal(t, types.OverrideForceBranch, forced.Type)
+	assert.False(t, forced.Branch)
+	assert.Nil(t, result.NodeTraceData["test.fallback"].Override)
+
+	dot, err := flow.RenderRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, strings.Count(dot, `color="purple"`))
+
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	overridden := make([]string, 0)
+	for _, event := range history.Events {
+		if event.Type == types.EventVertexOverridden {
+			overridden = append(overridden, event.Vertex)
+		}
+	}
+	assert.Equal(t, []string{"test.broken", "test.route"}, overridden)
+
+	err = flow.SkipVertex(ctx, "req-1", types.Data{})
+	assert.True(t, errors.Is(err, errors.Forbidden))
+}
@@ -0,0 +1,316 @@
+package runtime
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	defaultListLimit = 100
+	// fixed width layout, so that the formatted times sort the same as the times,
+	// in microseconds which is the precision of the stores selecting the requests themselves
+	sortTimeLayout = "2006-01-02T15:04:05.000000Z"
+)
+
+/**
+ * requestQuerier is implemented by the stores able to select the request index entries by the filter themselves,
+ * the entries are matched by the filter again so that the store may return a superset.
+ * The entries are in the order of the page and no more than its limit, or all of them unordered if page is nil.
+ */
+type requestQuerier interface {
+	QueryRequests(ctx context.Context, filter *types.RequestFilter, page *types.RequestPage,
+		iterator func(requestID string, value []byte) bool) error
+}
+
+/**
+ * listCursor points to the last request of the previous page
+ */
+type listCursor struct {
+	SortBy     types.RequestSortField `json:",omitempty"`
+	Descending bool                   `json:",omitempty"`
+	Value      string                 `json:",omitempty"`
+	RequestID  string                 `json:",omitempty"`
+}
+
+func encodeListCursor(c *listCursor) (string, error) {
+	b, err := utils.Serialize(c)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/**
+ * requestPage returns the page after the cursor, which is nil on the first page
+ */
+func requestPage(filter *types.RequestFilter, cursor *listCursor, limit int) (*types.RequestPage, error) {
+	page := &types.RequestPage{SortBy: filter.SortBy, Descending: filter.Descending, Limit: limit}
+	if cursor == nil {
+		return page, nil
+	}
+	page.AfterRequestID = cursor.RequestID
+	if filter.SortBy != types.SortByRequestID {
+		afterTime, err := time.Parse(sortTimeLayout, cursor.Value)
+		if err != nil {
+			return nil, errors.NewNotValid(err, "invalid cursor")
+		}
+		page.AfterTime = afterTime
+	}
+	return page, nil
+}
+
+func decodeListCursor(s string) (*listCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.NewNotValid(err, "invalid cursor")
+	}
+	c := &listCursor{}
+	if err := utils.Unserialize(b, c); err != nil {
+		return nil, errors.NewNotValid(err, "invalid cursor")
+	}
+	return c, nil
+}
+
+func sortValue(info *types.RequestInfo, sortBy types.RequestSortField) string {
+	switch sortBy {
+	case types.SortByUpdateTime:
+		return info.UpdateTime.UTC().Format(sortTimeLayout)
+	case types.SortByRequestID:
+		return ""
+	default:
+		return info.CreateTime.UTC().Format(sortTimeLayout)
+	}
+}
+
+/**
+ * compareRequestInfo compares 2 requests by the sort value, then the request ID
+ */
+func compareRequestInfo(lValue, lID, rValue, rID string) int {
+	switch {
+	case lValue < rValue:
+		return -1
+	case lValue > rValue:
+		return 1
+	case lID < rID:
+		return -1
+	case lID > rID:
+		return 1
+	}
+	return 0
+}
+
+func matchRequestFilter(info *types.RequestInfo, filter *types.RequestFilter) bool {
+	if filter.DAGName != "" && info.DAGName != filter.DAGName {
+		return false
+	}
+	if filter.Tenant != "" && info.Tenant != filter.Tenant {
+		return false
+	}
+	if filter.CurrentVertex != "" && info.CurrentVertex != filter.CurrentVertex {
+		return false
+	}
+	for key, value := range filter.Labels {
+		if v, exists := info.Labels[key]; !exists || v != value {
+			return false
+		}
+	}
+	if len(filter.Statuses) > 0 {
+		matched := false
+		for _, status := range filter.Statuses {
+			if info.Status == status {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !filter.CreatedAfter.IsZero() && info.CreateTime.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !info.CreateTime.Before(filter.CreatedBefore) {
+		return false
+	}
+	if !filter.UpdatedAfter.IsZero() && info.UpdateTime.Before(filter.UpdatedAfter) {
+		return false
+	}
+	if !filter.UpdatedBefore.IsZero() && !info.UpdateTime.Before(filter.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+func (f *flow) loadRequestInfo(ctx context.Context, requestID string) (*types.RequestInfo, error) {
+	b, err := f.store.Get(ctx, RequestInfoPath, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if b == nil {
+		return nil, errors.NotFoundf("request info: %s", requestID)
+	}
+	info := &types.RequestInfo{}
+	if err := utils.Unserialize(b, info); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return info, nil
+}
+
+func (f *flow) removeRequestInfo(ctx context.Context, requestID string) error {
+	return errors.Trace(f.store.Remove(ctx, RequestInfoPath, requestID))
+}
+
+func (f *flow) unserializeRequestInfo(requestID string, b []byte) *types.RequestInfo {
+	info := &types.RequestInfo{}
+	if err := utils.Unserialize(b, info); err != nil {
+		f.requestLogger(requestID).Errorf("unserialize %s %s from store:%s failed: %v", RequestInfoPath, requestID, string(b), err)
+		return nil
+	}
+	return info
+}
+
+/**
+ * scanRequestInfo iterates all of the request index entries matching the filter
+ */
+func (f *flow) scanRequestInfo(ctx context.Context, filter *types.RequestFilter, iterator func(info *types.RequestInfo) bool) error {
+	scanned := func(requestID string, b []byte) bool {
+		info := f.unserializeRequestInfo(requestID, b)
+		if info == nil || !matchRequestFilter(info, filter) {
+			return true
+		}
+		return iterator(info)
+	}
+	if querier, ok := f.store.(requestQuerier); ok {
+		return errors.Trace(querier.QueryRequests(ctx, filter, nil, scanned))
+	}
+	return errors.Trace(store.Scan(ctx, f.store, RequestInfoPath, "", scanned))
+}
+
+/**
+ * queryRequestPage selects the page with the store, the entries are matched by the filter again,
+ * it returns the last entry selected as well if the store filled the page,
+ * so that the next page starts after it even if it is filtered out.
+ */
+func (f *flow) queryRequestPage(ctx context.Context, querier requestQuerier, filter *types.RequestFilter,
+	page *types.RequestPage) ([]*types.RequestInfo, *types.RequestInfo, error) {
+	var (
+		selected int
+		last     *types.RequestInfo
+	)
+	matched := make([]*types.RequestInfo, 0)
+	err := querier.QueryRequests(ctx, filter, page, func(requestID string, b []byte) bool {
+		selected++
+		if info := f.unserializeRequestInfo(requestID, b); info != nil {
+			last = info
+			if matchRequestFilter(info, filter) {
+				matched = append(matched, info)
+			}
+		}
+		return selected < page.Limit
+	})
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	if selected < page.Limit {
+		last = nil
+	}
+	return matched, last, nil
+}
+
+func (f *flow) ListRequests(ctx context.Context, filter *types.RequestFilter) (*types.RequestList, error) {
+	if filter == nil {
+		filter = &types.RequestFilter{}
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	var cursor *listCursor
+	if filter.Cursor != "" {
+		var err error
+		if cursor, err = decodeListCursor(filter.Cursor); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if cursor.SortBy != filter.SortBy || cursor.Descending != filter.Descending {
+			return nil, errors.NotValidf("cursor does not match the sorting")
+		}
+	}
+
+	// compare returns negative if l should be listed before r
+	compare := func(lValue, lID, rValue, rID string) int {
+		c := compareRequestInfo(lValue, lID, rValue, rID)
+		if filter.Descending {
+			return -c
+		}
+		return c
+	}
+
+	afterCursor := func(info *types.RequestInfo) bool {
+		return cursor == nil || compare(sortValue(info, filter.SortBy), info.RequestID, cursor.Value, cursor.RequestID) > 0
+	}
+
+	var (
+		matched = make([]*types.RequestInfo, 0)
+		// the last entry the next page starts after
+		last *types.RequestInfo
+	)
+	if querier, ok := f.store.(requestQuerier); ok {
+		// one more than the limit tells whether there is the next page
+		page, err := requestPage(filter, cursor, limit+1)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		selected, selectedLast, err := f.queryRequestPage(ctx, querier, filter, page)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for _, info := range selected {
+			if afterCursor(info) {
+				matched = append(matched, info)
+			}
+		}
+		last = selectedLast
+	} else {
+		err := f.scanRequestInfo(ctx, filter, func(info *types.RequestInfo) bool {
+			if afterCursor(info) {
+				matched = append(matched, info)
+			}
+			return true
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		return compare(sortValue(matched[i], filter.SortBy), matched[i].RequestID,
+			sortValue(matched[j], filter.SortBy), matched[j].RequestID) < 0
+	})
+
+	list := &types.RequestList{Requests: matched}
+	if len(matched) > limit {
+		list.Requests = matched[:limit]
+		last = list.Requests[limit-1]
+	}
+	if last != nil {
+		nextCursor, err := encodeListCursor(&listCursor{
+			SortBy:     filter.SortBy,
+			Descending: filter.Descending,
+			Value:      sortValue(last, filter.SortBy),
+			RequestID:  last.RequestID,
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		list.NextCursor = nextCursor
+	}
+	return list, nil
+}
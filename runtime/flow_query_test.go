@@ -0,0 +1,186 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+type retryDAG struct{}
+
+func (d *retryDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", dumbNode); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("retry", func(ctx types.Context, input types.Data) (types.Data, error) {
+		return nil, types.NewRetryErrorf(time.Hour, "retry later")
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("node1", "retry"))
+}
+
+func TestListRequests(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+
+	assert.Nil(t, flow.RegisterDAG("retry", (&retryDAG{}).testDAG))
+	assert.Nil(t, flow.RegisterDAG("count", (&countDAG{}).testDAG))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "retry", fmt.Sprintf("retry-%d", i), types.Data{}))
+		assert.Nil(t, flow.RunDAG(context.Background(), "count", fmt.Sprintf("count-%d", i), types.Data{}, types.WithTenant("t1")))
+	}
+
+	list, err := flow.ListRequests(context.Background(), &types.RequestFilter{DAGName: "retry"})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(list.Requests))
+	for _, info := range list.Requests {
+		assert.Equal(t, types.Pending, info.Status)
+	}
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	filter := &types.RequestFilter{
+		DAGName:      "retry",
+		Statuses:     []types.StatusType{types.Retrying},
+		UpdatedAfter: time.Now().Add(-time.Hour),
+		Limit:        2,
+	}
+	ids := make([]string, 0)
+	for {
+		list, err = flow.ListRequests(context.Background(), filter)
+		assert.Nil(t, err)
+		assert.True(t, len(list.Requests) <= 2)
+		for _, info := range list.Requests {
+			assert.Equal(t, types.Retrying, info.Status)
+			assert.Equal(t, "retry.retry", info.CurrentVertex)
+			ids = append(ids, info.RequestID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		filter.Cursor = list.NextCursor
+	}
+	assert.Equal(t, []string{"retry-0", "retry-1", "retry-2", "retry-3", "retry-4"}, ids)
+
+	list, err = flow.ListRequests(context.Background(), &types.RequestFilter{
+		Tenant:     "t1",
+		Statuses:   []types.StatusType{types.Finished},
+		SortBy:     types.SortByRequestID,
+		Descending: true,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(list.Requests))
+	assert.Equal(t, "count-4", list.Requests[0].RequestID)
+	assert.Equal(t, "", list.NextCursor)
+
+	_, err = flow.ListRequests(context.Background(), &types.RequestFilter{Cursor: "broken"})
+	assert.True(t, errors.IsNotValid(err))
+}
+
+/**
+ * queryStore selects the request index entries of the DAG in the order of the page, ignoring the rest of the filter
+ */
+type queryStore struct {
+	store.Store
+	queries int
+	pages   []*types.RequestPage
+}
+
+func (s *queryStore) QueryRequests(ctx context.Context, filter *types.RequestFilter, page *types.RequestPage,
+	iterator func(requestID string, value []byte) bool) error {
+	s.queries++
+	s.pages = append(s.pages, page)
+	selected := make([]*types.RequestInfo, 0)
+	values := make(map[string][]byte)
+	err := store.Scan(ctx, s.Store, RequestInfoPath, "", func(requestID string, value []byte) bool {
+		info := &types.RequestInfo{}
+		if err := utils.Unserialize(value, info); err != nil || info.DAGName != filter.DAGName {
+			return true
+		}
+		selected = append(selected, info)
+		values[requestID] = value
+		return true
+	})
+	if err != nil || page == nil {
+		for _, info := range selected {
+			iterator(info.RequestID, values[info.RequestID])
+		}
+		return err
+	}
+
+	compare := func(l, r *types.RequestInfo) int {
+		c := compareRequestInfo(sortValue(l, page.SortBy), l.RequestID, sortValue(r, page.SortBy), r.RequestID)
+		if page.Descending {
+			return -c
+		}
+		return c
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return compare(selected[i], selected[j]) < 0
+	})
+	after := &types.RequestInfo{RequestID: page.AfterRequestID, CreateTime: page.AfterTime, UpdateTime: page.AfterTime}
+	count := 0
+	for _, info := range selected {
+		if page.AfterRequestID != "" && compare(info, after) <= 0 {
+			continue
+		}
+		if count++; (page.Limit > 0 && count > page.Limit) || !iterator(info.RequestID, values[info.RequestID]) {
+			break
+		}
+	}
+	return nil
+}
+
+func TestListRequests_Query(t *testing.T) {
+	s := &queryStore{Store: mem.NewMemStore()}
+	flow := newFlow(s, newOptions())
+
+	assert.Nil(t, flow.RegisterDAG("count", (&countDAG{}).testDAG))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "count", fmt.Sprintf("count-%d", i), types.Data{},
+			types.WithTenant(fmt.Sprintf("t%d", i%2))))
+	}
+
+	// the entries returned by the store are matched by the filter again
+	list, err := flow.ListRequests(context.Background(), &types.RequestFilter{DAGName: "count", Tenant: "t0"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, s.queries)
+	assert.Equal(t, &types.RequestPage{Limit: defaultListLimit + 1}, s.pages[0])
+	ids := make([]string, 0)
+	for _, info := range list.Requests {
+		ids = append(ids, info.RequestID)
+	}
+	assert.Equal(t, []string{"count-0", "count-2"}, ids)
+
+	// the pages are selected by the store, the one filtered out entirely still leads to the next
+	filter := &types.RequestFilter{DAGName: "count", Tenant: "t0", SortBy: types.SortByRequestID, Descending: true, Limit: 1}
+	ids = ids[:0]
+	for pages := 0; ; pages++ {
+		list, err = flow.ListRequests(context.Background(), filter)
+		assert.Nil(t, err)
+		for _, info := range list.Requests {
+			ids = append(ids, info.RequestID)
+		}
+		if list.NextCursor == "" || pages > 3 {
+			break
+		}
+		filter.Cursor = list.NextCursor
+	}
+	assert.Equal(t, []string{"count-2", "count-0"}, ids)
+	last := s.pages[len(s.pages)-1]
+	assert.Equal(t, 2, last.Limit)
+	assert.True(t, last.Descending)
+	assert.NotEmpty(t, last.AfterRequestID)
+}
@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/blob"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func TestRedaction(t *testing.T) {
+	s := mem.NewMemStore()
+	opts := newOptions()
+	types.WithRedactRules(
+		types.RedactRule{Keys: []string{"password"}},
+		types.RedactRule{DAG: "test", Node: "validate", Keys: []string{"user.name"}, Action: types.RedactHash},
+	)(opts)
+	flow := newFlow(s, opts)
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	params := types.Data{"valid": true, "password": "secret-password", "user": map[string]any{"name": "bob"}}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", params))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// the records and the summary are redacted
+	err := store.Scan(context.Background(), s, recordSavePath("req-1"), "", func(key string, b []byte) bool {
+		assert.NotContains(t, string(b), "secret-password", key)
+		return true
+	})
+	assert.Nil(t, err)
+	b, err := s.Get(context.Background(), SummaryPath, "req-1")
+	assert.Nil(t, err)
+	summary := &types.DAGStatus{}
+	assert.Nil(t, utils.Unserialize(b, summary))
+	assert.Equal(t, types.RedactedMask, summary.LastVertexRecord.Output["password"])
+	assert.NotContains(t, string(b), "secret-password")
+
+	result, err := flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.RedactedMask, result.Result["password"])
+	node1 := result.NodeTraceData["test.node1"]
+	assert.Equal(t, types.RedactedMask, node1.Input["password"])
+	assert.Equal(t, "bob", node1.Input["user"].(map[string]any)["name"])
+	validate := result.NodeTraceData["test.validate"]
+	hashed := validate.Input["user"].(map[string]any)["name"]
+	assert.Contains(t, hashed, types.RedactedHashPrefix)
+
+	// the rules added later apply to the rendering
+	types.WithRedactRules(types.RedactRule{Keys: []string{"valid"}})(opts)
+	dot, err := flow.RenderRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.NotContains(t, dot, "secret-password")
+	assert.NotContains(t, dot, `\"valid\":true`)
+	assert.Contains(t, dot, `\"valid\":\"[REDACTED]\"`)
+	assert.Contains(t, dot, hashed)
+}
+
+func TestRedaction_PatchAndBlob(t *testing.T) {
+	s := mem.NewMemStore()
+	blobs, err := blob.NewFileStore(t.TempDir())
+	assert.Nil(t, err)
+	opts := newOptions()
+	types.WithBlobStore(blobs, 1024)(opts)
+	types.WithRedactRules(types.RedactRule{Keys: []string{"password"}})(opts)
+	flow := newFlow(s, opts)
+
+	d := &validateDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	payload := map[string]any{"password": "secret-password", "pad": strings.Repeat("x", 2048)}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"valid": false, "payload": payload}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Nil(t, flow.PatchRequestData(context.Background(), "req-1", types.Data{"valid": true, "password": "patched-password"}))
+
+	// the patch in the history
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	patched := history.Events[len(history.Events)-1]
+	assert.Equal(t, types.EventDataPatched, patched.Type)
+	assert.Equal(t, types.Data{"valid": true, "password": types.RedactedMask}, patched.Patch)
+
+	// the offloaded payload of the records refers to the blob redacted
+	record, err := flow.loadRecords(context.Background(), "req-1")
+	assert.Nil(t, err)
+	input := record["test.node1"].Input
+	assert.IsType(t, &types.BlobRef{}, input["payload"])
+	b, err := blobs.Get(context.Background(), "req-1", input["payload"].(*types.BlobRef).Key)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(b), "secret-password")
+	assert.Contains(t, string(b), types.RedactedMask)
+
+	// the run context keeps the value for the next nodes
+	data, err := flow.GetRequestData(context.Background(), "req-1")
+	assert.Nil(t, err)
+	value, err := data["payload"].(*types.BlobRef).Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-password", value.(map[string]any)["password"])
+}
@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func canRestart(status types.StatusType) bool {
+	return status == types.Paused || status.IsTerminal()
+}
+
+/**
+ * currentRequestStatus returns the status of the request from memory,
+ * then the rerun context, then the terminal summary.
+ */
+func (f *flow) currentRequestStatus(ctx context.Context, requestID string, reRC *flowRerunContext) (types.StatusType, error) {
+	if status, err := f.getExecutePlanStatus(requestID); err == nil {
+		return status.Status, nil
+	}
+	if reRC != nil {
+		return reRC.Status, nil
+	}
+	summary, err := f.loadSummary(ctx, requestID)
+	if err != nil {
+		return types.None, errors.Trace(err)
+	}
+	if summary == nil {
+		return types.None, errors.NotFoundf("request id: %s", requestID)
+	}
+	return summary.Status, nil
+}
+
+/**
+ * restartMeta keeps the meta of the request, the rerun context is gone once the request finished,
+ * then it is recovered from the request index.
+ */
+func (f *flow) restartMeta(ctx context.Context, requestID string, dag *dagExecutePlan, reRC *flowRerunContext) (*requestMeta, error) {
+	if reRC != nil && reRC.Meta != nil {
+		return reRC.Meta, nil
+	}
+	meta := newRequestMeta(dag.Name, types.NewRunOptions())
+	info, err := f.loadRequestInfo(ctx, requestID)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return meta, nil
+		}
+		return nil, errors.Trace(err)
+	}
+	meta.Tenant = info.Tenant
+	meta.Labels = info.Labels
+	meta.CreateTime = info.CreateTime
+	return meta, nil
+}
+
+/**
+ * takeOverRunner removes the runner of the request from memory if there is,
+ * so that the request can be launched again.
+ */
+func (f *flow) takeOverRunner(requestID string) error {
+	cr := f.batchRunner.get(requestID)
+	if cr == nil {
+		return nil
+	}
+	if !cr.tryLockIdle() {
+		return errors.NotYetAvailablef("request %s is running", requestID)
+	}
+	defer cr.mu.Unlock()
+
+	if !canRestart(cr.runningStatus) || cr.hasNextStatus() {
+		return errors.Forbiddenf("request %s is %v", requestID, cr.runningStatus)
+	}
+	f.batchRunner.remove(requestID)
+	return nil
+}
+
+func (f *flow) RestartRequestFrom(ctx context.Context, requestID, vertexPath string, data *types.Data) error {
+	if !f.running.Load() {
+		return errors.MethodNotAllowedf("not running")
+	}
+	if vertexPath == "" {
+		return errors.NotValidf("empty vertex path")
+	}
+	return f.controlRequest(ctx, requestID, &controlMessage{Type: controlRestart, Vertex: vertexPath, Data: data})
+}
+
+func (f *flow) restartRequestFrom(ctx context.Context, requestID, vertexPath string, data *types.Data) error {
+	dag, reRC, err := f.loadPlan(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	status, err := f.currentRequestStatus(ctx, requestID, reRC)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !canRestart(status) {
+		return errors.Forbiddenf("request %s is %v, only paused or terminated one can be restarted", requestID, status)
+	}
+
+	entrypoint := utils.NewPath(strings.Split(vertexPath, ".")...)
+	if first, _ := entrypoint.First(); first != dag.Name {
+		return errors.NotValidf("vertex path %s not in DAG %s", vertexPath, dag.Name)
+	}
+	// make sure the vertex path is valid before taking over the request
+	if _, err := dag.generateRuntime(f.gl, utils.NewPath(), entrypoint); err != nil {
+		return errors.Annotatef(err, "vertex path %s", vertexPath)
+	}
+
+	var input types.Data
+	if data != nil {
+		input = *data
+	} else {
+		records, err := f.loadRecords(ctx, requestID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		record, exists := records[vertexPath]
+		if !exists {
+			return errors.NotFoundf("record of vertex %s", vertexPath)
+		}
+		input = record.Input
+	}
+
+	meta, err := f.restartMeta(ctx, requestID, dag, reRC)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	if err := f.takeOverRunner(requestID); err != nil {
+		return errors.Trace(err)
+	}
+	return f.launchDAG(ctx, dag, requestID, meta, input, entrypoint, nil, types.Pending, func() error {
+		if err := f.removeSummary(ctx, requestID); err != nil {
+			return errors.Trace(err)
+		}
+		appendHistory(ctx, f.store, f.requestLogger(requestID), requestID, &types.HistoryEvent{
+			Type:     types.EventRequestRestarted,
+			Vertex:   vertexPath,
+			Status:   types.Pending,
+			Operator: types.OperatorFromContext(ctx),
+			Message:  fmt.Sprintf("restarted from status %v", status),
+		})
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type restartDAG struct {
+	fixed   bool
+	trigger map[string]int
+}
+
+func (d *restartDAG) node(name string) types.NodeHandler {
+	return func(ctx types.Context, input types.Data) (types.Data, error) {
+		d.trigger[name]++
+		if name == "broken" && !d.fixed {
+			return nil, types.NewFatalErrorf("not fixed yet")
+		}
+		output := types.Data{}
+		for k, v := range input {
+			output[k] = v
+		}
+		output[name] = "done"
+		return output, nil
+	}
+}
+
+func (d *restartDAG) innerDAG(dag types.DAG) error {
+	if err := dag.Node("prepare", d.node("prepare")); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("broken", d.node("broken")); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("prepare", "broken"))
+}
+
+func (d *restartDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", d.node("node1")); err != nil {
+		return errors.Trace(err)
+	}
+	// the vertex name differs from the sub DAG name on purpose
+	if err := dag.SubDAG("sub", "inner"); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("node3", d.node("node3")); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Edge("node1", "sub"); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("sub", "node3"))
+}
+
+func TestRestartRequestFrom(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &restartDAG{trigger: make(map[string]int)}
+	assert.Nil(t, flow.RegisterDAG("inner", d.innerDAG))
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{"k": "v"}))
+
+	// only paused or terminated requests can be restarted
+	err := flow.RestartRequestFrom(context.Background(), "req-1", "test.sub.broken", nil)
+	assert.True(t, errors.Is(err, errors.Forbidden))
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, status.Status)
+	assert.Equal(t, []string{"test", "sub", "broken"}, status.LastVertexRecord.Vertex)
+	assert.True(t, flow.isRunningEmpty())
+
+	err = flow.RestartRequestFrom(context.Background(), "req-1", "test.sub.unknown", nil)
+	assert.True(t, errors.IsNotFound(err))
+	err = flow.RestartRequestFrom(context.Background(), "req-1", "test.node1.broken", nil)
+	assert.True(t, errors.IsNotValid(err))
+	err = flow.RestartRequestFrom(context.Background(), "req-1", "other.node1", nil)
+	assert.True(t, errors.IsNotValid(err))
+
+	// restarted on another engine with the recorded input
+	d.fixed = true
+	flow = newFlow(s, newOptions())
+	assert.Nil(t, flow.RegisterDAG("inner", d.innerDAG))
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+
+	ctx := types.WithOperator(context.Background(), "alice")
+	assert.Nil(t, flow.RestartRequestFrom(ctx, "req-1", "test.sub.broken", nil))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Equal(t, 1, d.trigger["node1"])
+	assert.Equal(t, 1, d.trigger["prepare"])
+	assert.Equal(t, 2, d.trigger["broken"])
+	assert.Equal(t, 1, d.trigger["node3"])
+
+	result, err := flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, types.Data{
+		"k":       "v",
+		"node1":   "done",
+		"prepare": "done",
+		"broken":  "done",
+		"node3":   "done",
+	}, result.Result)
+
+	// restarted from a finished request with the data override
+	data := types.Data{"k": "override"}
+	assert.Nil(t, flow.RestartRequestFrom(ctx, "req-1", "test.node3", &data))
+	_, err = flow.GetRequestResult(context.Background(), "req-1")
+	assert.True(t, errors.IsNotYetAvailable(err))
+	assert.Nil(t, flow.runOnce())
+
+	result, err = flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Data{"k": "override", "node3": "done"}, result.Result)
+
+	history, err := flow.GetRequestHistory(context.Background(), "req-1", 0, 0)
+	assert.Nil(t, err)
+	restarts := 0
+	for _, event := range history.Events {
+		if event.Type == types.EventRequestRestarted {
+			restarts++
+			assert.Equal(t, "alice", event.Operator)
+		}
+	}
+	assert.Equal(t, 2, restarts)
+
+	err = flow.RestartRequestFrom(context.Background(), "req-unknown", "test.node1", nil)
+	assert.True(t, errors.IsNotFound(err))
+}
@@ -0,0 +1,133 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	SummaryPath = "/summary/"
+)
+
+func (r *contextRunner) exportSummary(ctx context.Context) *types.DAGStatus {
+	summary := &types.DAGStatus{
+		RequestID:        r.fc.requestID,
+		DAGName:          r.meta.DAGName,
+		Status:           r.runningStatus,
+		CreateTime:       r.meta.CreateTime,
+		EndTime:          time.Now(),
+		LastVertexRecord: r.redactedRecord(ctx),
+	}
+	if r.fc.rcRecord != nil {
+		summary.CurrentVertex = strings.Join(r.fc.rcRecord.Vertex, ".")
+	} else if r.runningRC != nil {
+		summary.CurrentVertex = strings.Join(r.runningRC.getPath(), ".")
+	}
+	if r.runningStatus == types.Finished {
+		summary.Result = r.offloadData(ctx, r.fc.redaction.RedactData(r.meta.DAGName, r.currentData))
+	}
+	if r.lastErr != nil {
+		summary.Error = r.lastErr.Error()
+	}
+	return summary
+}
+
+func (f *flow) saveSummary(ctx context.Context, summary *types.DAGStatus) error {
+	encoded, err := encodeSummary(f.codec, summary)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	b, err := utils.Serialize(encoded)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(f.store.Set(ctx, SummaryPath, summary.RequestID, b))
+}
+
+/**
+ * loadSummary returns nil if the request has no terminal summary
+ */
+func (f *flow) loadSummary(ctx context.Context, requestID string) (*types.DAGStatus, error) {
+	b, err := f.store.Get(ctx, SummaryPath, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if b == nil {
+		return nil, nil
+	}
+	summary := &types.DAGStatus{}
+	if err := utils.Unserialize(b, summary); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := decodeSummary(f.codec, summary); err != nil {
+		return nil, errors.Annotatef(err, "summary of %s", requestID)
+	}
+	return summary, nil
+}
+
+func (f *flow) removeSummary(ctx context.Context, requestID string) error {
+	return errors.Trace(f.store.Remove(ctx, SummaryPath, requestID))
+}
+
+func summaryToStatus(summary *types.DAGStatus) *types.RequestStatus {
+	return &types.RequestStatus{
+		Status:           summary.Status,
+		LastError:        summary.Error,
+		Result:           summary.Result,
+		LastVertexRecord: summary.LastVertexRecord,
+	}
+}
+
+func (f *flow) getRequestStatus(ctx context.Context, requestID string) (*types.RequestStatus, error) {
+	status, err := f.getExecutePlanStatus(requestID)
+	if err == nil || !errors.IsNotFound(err) {
+		return status, errors.Trace(err)
+	}
+
+	summary, err := f.loadSummary(ctx, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if summary == nil {
+		return nil, errors.NotFoundf("request id: %s", requestID)
+	}
+	return summaryToStatus(summary), nil
+}
+
+func (f *flow) GetRequestResult(ctx context.Context, requestID string) (*types.DAGStatus, error) {
+	summary, err := f.loadSummary(ctx, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if summary == nil {
+		if f.hasExecutePlan(requestID) {
+			return nil, errors.NotYetAvailablef("request %s is not terminated", requestID)
+		}
+		return nil, errors.NotFoundf("request id: %s", requestID)
+	}
+
+	if summary.NodeTraceData, err = f.loadRecords(ctx, requestID); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return summary, nil
+}
+
+func (f *flow) onTerminal(ctx context.Context, r *contextRunner) {
+	summary := r.exportSummary(ctx)
+	if err := f.saveSummary(ctx, summary); err != nil {
+		r.logger.Errorf("failed to save summary: %v", err)
+	}
+	appendHistory(ctx, f.store, r.logger, r.fc.requestID, &types.HistoryEvent{
+		Time:   summary.EndTime,
+		Type:   types.EventRequestTerminated,
+		Vertex: summary.CurrentVertex,
+		Status: summary.Status,
+		Error:  summary.Error,
+	})
+	f.releaseLease(ctx, r.fc.requestID)
+}
@@ -0,0 +1,129 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type fatalDAG struct{}
+
+func (d *fatalDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", dumbNode); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("fatal", fatalNode); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("node1", "fatal"))
+}
+
+func TestRequestResultAfterFinished(t *testing.T) {
+	s := mem.NewMemStore()
+	flow := newFlow(s, newOptions())
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RegisterDAG("fatal", (&fatalDAG{}).testDAG))
+
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-ok", types.Data{"k": "v"}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "fatal", "req-fatal", types.Data{}))
+
+	_, err := flow.GetRequestResult(context.Background(), "req-ok")
+	assert.True(t, errors.IsNotYetAvailable(err))
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.True(t, flow.isRunningEmpty())
+
+	// served from the store on a restarted engine
+	flow = newFlow(s, newOptions())
+	status, err := flow.GetRequestStatus(context.Background(), "req-ok")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+	assert.Equal(t, "v", status.Result["k"])
+
+	result, err := flow.GetRequestResult(context.Background(), "req-ok")
+	assert.Nil(t, err)
+	assert.Equal(t, "test", result.DAGName)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, "test.node2", result.CurrentVertex)
+	assert.Equal(t, "v", result.Result["k"])
+	assert.False(t, result.EndTime.Before(result.CreateTime))
+	assert.Equal(t, 2, len(result.NodeTraceData))
+
+	result, err = flow.GetRequestResult(context.Background(), "req-fatal")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, result.Status)
+	assert.Equal(t, "fatal.fatal", result.CurrentVertex)
+	assert.NotEmpty(t, result.Error)
+	assert.Nil(t, result.Result)
+
+	// terminated requests are not rerun
+	errs, err := flow.reloadPlans(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, errs)
+	assert.True(t, flow.isRunningEmpty())
+
+	_, err = flow.GetRequestResult(context.Background(), "req-unknown")
+	assert.True(t, errors.IsNotFound(err))
+}
+
+func TestTerminatePausedRequest(t *testing.T) {
+	flow := newFlow(mem.NewMemStore(), newOptions())
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-1", types.Data{}))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-2", types.Data{}))
+
+	assert.Nil(t, flow.PauseRequest(context.Background(), "req-1"))
+	assert.Nil(t, flow.PauseRequest(context.Background(), "req-2"))
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 0, d.trigger)
+
+	assert.Nil(t, flow.ResumeRequest(context.Background(), "req-1"))
+	assert.Nil(t, flow.TerminateRequest(context.Background(), "req-2"))
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 1, d.trigger)
+
+	status, err := flow.GetRequestStatus(context.Background(), "req-2")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, status.Status)
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 2, d.trigger)
+	assert.True(t, flow.isRunningEmpty())
+}
+
+func TestFatalRequestRemoved(t *testing.T) {
+	opts := newOptions()
+	types.EnableLease("a")(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+	assert.Nil(t, flow.RegisterDAG("fatal", (&fatalDAG{}).testDAG))
+	assert.Nil(t, flow.RunDAG(context.Background(), "fatal", "req-1", types.Data{}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+
+	// the Fatal request leaves the memory along with its lease, it is served from the summary
+	assert.Nil(t, flow.batchRunner.get("req-1"))
+	lease, err := flow.leases.load(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Nil(t, lease)
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, status.Status)
+	assert.NotEmpty(t, status.LastError)
+	result, err := flow.GetRequestResult(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Fatal, result.Status)
+
+	// restarted from the store
+	assert.Nil(t, flow.RestartRequestFrom(context.Background(), "req-1", "fatal.node1", nil))
+	assert.NotNil(t, flow.batchRunner.get("req-1"))
+}
@@ -0,0 +1,110 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+type countDAG struct {
+	trigger int
+}
+
+func (d *countDAG) node(ctx types.Context, input types.Data) (types.Data, error) {
+	d.trigger++
+	return input, nil
+}
+
+func (d *countDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", d.node); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("node2", d.node); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("node1", "node2"))
+}
+
+func statsOf(t *testing.T, flow *flow, group string) *types.GroupStats {
+	stats, err := flow.GetSchedulingStats()
+	assert.Nil(t, err)
+	for _, gs := range stats {
+		if gs.Group == group {
+			return gs
+		}
+	}
+	return nil
+}
+
+func TestFairShareAcrossDAGs(t *testing.T) {
+	opts := newOptions()
+	opts.MaxNodeConcurrency = 2
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	busy, idle := &countDAG{}, &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("busy", busy.testDAG))
+	assert.Nil(t, flow.RegisterDAG("idle", idle.testDAG))
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "busy", fmt.Sprintf("busy-%d", i), types.Data{}))
+	}
+	assert.Nil(t, flow.RunDAG(context.Background(), "idle", "idle-0", types.Data{}))
+
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 1, busy.trigger)
+	assert.Equal(t, 1, idle.trigger)
+
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 2, busy.trigger)
+	assert.Equal(t, 2, idle.trigger)
+
+	// idle DAG finished, all slots go to the busy one
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, 4, busy.trigger)
+
+	gs := statsOf(t, flow, "busy")
+	assert.NotNil(t, gs)
+	assert.Equal(t, int64(4), gs.DispatchedNodes)
+	assert.Equal(t, 10, gs.InflightRequests)
+	assert.Equal(t, 0, gs.RunningNodes)
+
+	gs = statsOf(t, flow, "idle")
+	assert.NotNil(t, gs)
+	assert.Equal(t, 0, gs.InflightRequests)
+}
+
+func TestFairShareWeightAndCaps(t *testing.T) {
+	opts := newOptions()
+	opts.MaxNodeConcurrency = 4
+	types.WithSchedulingGroupBy(types.GroupByTenant)(opts)
+	types.WithGroupQuota("gold", types.GroupQuota{Weight: 3})(opts)
+	types.WithGroupQuota("capped", types.GroupQuota{MaxConcurrentNodes: 1, MaxInflightRequests: 2})(opts)
+	flow := newFlow(mem.NewMemStore(), opts)
+
+	d := &countDAG{}
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+
+	for i := 0; i < 8; i++ {
+		assert.Nil(t, flow.RunDAG(context.Background(), "test", fmt.Sprintf("gold-%d", i), types.Data{}, types.WithTenant("gold")))
+		assert.Nil(t, flow.RunDAG(context.Background(), "test", fmt.Sprintf("silver-%d", i), types.Data{}, types.WithTenant("silver")))
+	}
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "capped-0", types.Data{}, types.WithTenant("capped")))
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "capped-1", types.Data{}, types.WithTenant("capped")))
+	err := flow.RunDAG(context.Background(), "test", "capped-2", types.Data{}, types.WithTenant("capped"))
+	assert.True(t, errors.IsQuotaLimitExceeded(err))
+
+	assert.Nil(t, flow.runOnce())
+	assert.Equal(t, int64(2), statsOf(t, flow, "gold").DispatchedNodes)
+	assert.Equal(t, int64(1), statsOf(t, flow, "silver").DispatchedNodes)
+	assert.Equal(t, int64(1), statsOf(t, flow, "capped").DispatchedNodes)
+
+	capped := statsOf(t, flow, "capped")
+	assert.Equal(t, 2, capped.InflightRequests)
+	assert.Equal(t, int64(1), capped.RejectedRequests)
+	assert.True(t, capped.ThrottledTimes > 0)
+}
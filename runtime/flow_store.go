@@ -3,10 +3,10 @@ package runtime
 import (
 	"context"
 
+	"github.com/warriorguo/workflow/store"
 	"github.com/warriorguo/workflow/types"
 	"github.com/warriorguo/workflow/utils"
 	"github.com/juju/errors"
-	log "github.com/sirupsen/logrus"
 )
 
 func (f *flow) savePlan(ctx context.Context, requestID string, plan *dagExecutePlan) error {
@@ -46,6 +46,8 @@ func (f *flow) loadPlan(ctx context.Context, requestID string) (*dagExecutePlan,
 		reRC = nil
 	} else if err := utils.Unserialize(b, reRC); err != nil {
 		return nil, nil, errors.Trace(err)
+	} else if err := decodeRerunContext(f.codec, reRC); err != nil {
+		return nil, nil, errors.Annotatef(err, "run context of %s", requestID)
 	}
 	return dag, reRC, nil
 }
@@ -53,15 +55,14 @@ func (f *flow) loadPlan(ctx context.Context, requestID string) (*dagExecutePlan,
 func (f *flow) loadRecords(ctx context.Context, requestID string) (map[string]*types.NodeTraceRecord, error) {
 	records := make(map[string]*types.NodeTraceRecord)
 	recordPath := recordSavePath(requestID)
-	err := f.store.List(ctx, recordPath, func(node string) bool {
-		b, err := f.store.Get(ctx, recordPath, node)
-		if err != nil {
-			log.Errorf("load %s %s from store failed: %v", recordPath, node, err)
-			return true
-		}
+	err := store.Scan(ctx, f.store, recordPath, "", func(node string, b []byte) bool {
 		record := &types.NodeTraceRecord{}
 		if err := utils.Unserialize(b, record); err != nil {
-			log.Errorf("unserialize %s %s from store:%s failed: %v", recordPath, node, string(b), err)
+			f.requestLogger(requestID).Errorf("unserialize %s %s from store:%s failed: %v", recordPath, node, string(b), err)
+			return true
+		}
+		if err := decodeRecord(f.codec, record); err != nil {
+			f.requestLogger(requestID).Errorf("decode %s %s failed: %v", recordPath, node, err)
 			return true
 		}
 		records[node] = record
@@ -73,3 +74,17 @@ func (f *flow) loadRecords(ctx context.Context, requestID string) (map[string]*t
 func (f *flow) ReloadRequests(ctx context.Context) (map[string]error, error) {
 	return f.reloadPlans(ctx)
 }
+
+/**
+ * StorePrefixes returns the prefixes the engine sets values under, including the record prefix of every
+ * indexed request, for the tools walking the whole store, e.g. crypt.Reencrypt.
+ * The history is appended to HistoryPath with the request IDs as the keys.
+ */
+func StorePrefixes(ctx context.Context, s store.Store) ([]string, error) {
+	prefixes := []string{RunContextPath, DAGPlanPath, SummaryPath, RequestInfoPath, IdempotencyPath, LeasePath}
+	err := s.List(ctx, RequestInfoPath, func(requestID string) bool {
+		prefixes = append(prefixes, recordSavePath(requestID))
+		return true
+	})
+	return prefixes, errors.Trace(err)
+}
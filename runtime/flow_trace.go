@@ -0,0 +1,173 @@
+package runtime
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/trace"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	attrDAG       = "workflow.dag"
+	attrRequestID = "workflow.request_id"
+	attrTenant    = "workflow.tenant"
+	attrVertex    = "workflow.vertex"
+	attrAttempt   = "workflow.attempt"
+	attrStatus    = "workflow.status"
+)
+
+/**
+ * traceState is the spans open of a request, it is saved with the request meta,
+ * so that the spans continue with the same contexts after the request reloaded by another process.
+ */
+type traceState struct {
+	// the span of the request then the ones of the sub DAGs entered
+	Spans []*spanState `json:",omitempty"`
+	// the vertex run last and how many times it ran in a row
+	Vertex  string `json:",omitempty"`
+	Attempt int    `json:",omitempty"`
+}
+
+type spanState struct {
+	Path        []string
+	Traceparent string
+	// the traceparent of the parent, empty for a root span
+	Parent    string    `json:",omitempty"`
+	StartTime time.Time `json:",omitempty"`
+
+	span trace.Span
+}
+
+func (r *contextRunner) traceAttrs() []trace.Attribute {
+	return []trace.Attribute{
+		trace.Attr(attrDAG, r.meta.DAGName),
+		trace.Attr(attrRequestID, r.fc.requestID),
+		trace.Attr(attrTenant, r.meta.Tenant),
+	}
+}
+
+/**
+ * startTrace starts the span of the request as the child of the one carried by ctx,
+ * or continues the spans saved if the request is reloaded.
+ */
+func (r *contextRunner) startTrace(ctx context.Context) {
+	if r.tracer == nil {
+		return
+	}
+	if r.meta.Trace != nil && len(r.meta.Trace.Spans) > 0 {
+		for _, state := range r.meta.Trace.Spans {
+			sc, err := trace.ParseTraceparent(state.Traceparent)
+			if err != nil {
+				r.logger.Warnf("failed to continue the span of %v: %v", state.Path, err)
+			}
+			// an invalid parent makes the span a root, which is the same as the request span
+			parent, _ := trace.ParseTraceparent(state.Parent)
+			state.span = r.tracer.Start(parent, strings.Join(state.Path, "."), trace.WithSpanContext(sc),
+				trace.WithStartTime(state.StartTime), trace.WithAttributes(r.traceAttrs()...))
+			state.Traceparent = state.span.SpanContext().Traceparent()
+		}
+		return
+	}
+
+	parent := trace.SpanContextFromContext(ctx)
+	state := &spanState{Path: []string{r.meta.DAGName}, Parent: parent.Traceparent(), StartTime: time.Now()}
+	state.span = r.tracer.Start(parent, r.meta.DAGName, trace.WithStartTime(state.StartTime), trace.WithAttributes(r.traceAttrs()...))
+	state.Traceparent = state.span.SpanContext().Traceparent()
+	r.meta.Trace = &traceState{Spans: []*spanState{state}}
+}
+
+/**
+ * endSpans ends the spans of the sub DAGs not containing the path
+ */
+func (r *contextRunner) endSpans(path utils.Path) {
+	spans := r.meta.Trace.Spans
+	for len(spans) > 1 && !hasPrefix(path, spans[len(spans)-1].Path) {
+		top := spans[len(spans)-1]
+		top.span.SetAttributes(trace.Attr(attrStatus, statusLabel(types.Finished)))
+		top.span.End(nil)
+		spans = spans[:len(spans)-1]
+	}
+	r.meta.Trace.Spans = spans
+}
+
+func hasPrefix(path utils.Path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * startVertexSpan starts the spans of the sub DAGs entered, then the one of the vertex as the child of the innermost,
+ * it returns nil if there is no tracer.
+ */
+func (r *contextRunner) startVertexSpan(path utils.Path) trace.Span {
+	if r.tracer == nil || r.meta.Trace == nil || len(r.meta.Trace.Spans) == 0 {
+		return nil
+	}
+	state := r.meta.Trace
+	r.endSpans(path)
+	for depth := len(state.Spans) + 1; depth < len(path); depth++ {
+		parent := state.Spans[len(state.Spans)-1]
+		sub := &spanState{Path: append([]string(nil), path[:depth]...), Parent: parent.Traceparent, StartTime: time.Now()}
+		sub.span = r.tracer.Start(parent.span.SpanContext(), strings.Join(sub.Path, "."),
+			trace.WithStartTime(sub.StartTime), trace.WithAttributes(r.traceAttrs()...))
+		sub.Traceparent = sub.span.SpanContext().Traceparent()
+		state.Spans = append(state.Spans, sub)
+	}
+
+	vertex := path.String()
+	if vertex == state.Vertex {
+		state.Attempt++
+	} else {
+		state.Vertex, state.Attempt = vertex, 1
+	}
+	parent := state.Spans[len(state.Spans)-1].span
+	attrs := append(r.traceAttrs(), trace.Attr(attrVertex, vertex), trace.Attr(attrAttempt, state.Attempt))
+	return r.tracer.Start(parent.SpanContext(), vertex, trace.WithAttributes(attrs...))
+}
+
+/**
+ * endVertexSpan ends the span of the vertex, a paused vertex is not taken as an error
+ */
+func endVertexSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	result := vertexResult(err)
+	span.SetAttributes(trace.Attr(attrStatus, result))
+	if result == vertexPaused {
+		err = nil
+	}
+	span.End(err)
+}
+
+/**
+ * endTrace ends all of the spans open once the request is terminated
+ */
+func (r *contextRunner) endTrace() {
+	if r.tracer == nil || r.meta.Trace == nil {
+		return
+	}
+	var err error
+	if r.runningStatus != types.Finished {
+		if err = r.lastErr; err == nil {
+			err = errors.Errorf("request %s", statusLabel(r.runningStatus))
+		}
+	}
+	spans := r.meta.Trace.Spans
+	for i := len(spans) - 1; i >= 0; i-- {
+		spans[i].span.SetAttributes(trace.Attr(attrStatus, statusLabel(r.runningStatus)))
+		spans[i].span.End(err)
+	}
+	r.meta.Trace.Spans = nil
+}
@@ -0,0 +1,193 @@
+package runtime
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/trace"
+	"github.com/warriorguo/workflow/types"
+)
+
+type tracedDAG struct {
+	retried bool
+	pause   bool
+	// the span contexts seen by the nodes
+	seen []trace.SpanContext
+}
+
+func (d *tracedDAG) node(ctx types.Context, input types.Data) (types.Data, error) {
+	d.seen = append(d.seen, trace.SpanContextFromContext(ctx))
+	if !d.retried {
+		d.retried = true
+		return nil, types.NewRetryErrorf(0, "not ready")
+	}
+	return input, nil
+}
+
+func (d *tracedDAG) prepare(ctx types.Context, input types.Data) (types.Data, error) {
+	if d.pause {
+		return nil, types.NewPauseErrorf("wait")
+	}
+	return input, nil
+}
+
+func (d *tracedDAG) innerDAG(dag types.DAG) error {
+	if err := dag.Node("prepare", d.prepare); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("work", dumbNode); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("prepare", "work"))
+}
+
+func (d *tracedDAG) testDAG(dag types.DAG) error {
+	if err := dag.Node("node1", d.node); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.SubDAG("sub", "inner"); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Node("node3", dumbNode); err != nil {
+		return errors.Trace(err)
+	}
+	if err := dag.Edge("node1", "sub"); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(dag.Edge("sub", "node3"))
+}
+
+func newTracedFlow(t *testing.T, s store.Store, d *tracedDAG, exporter trace.Exporter) *flow {
+	opts := newOptions()
+	types.WithTracer(trace.NewTracer(exporter))(opts)
+	flow := newFlow(s, opts)
+	assert.Nil(t, flow.RegisterDAG("inner", d.innerDAG))
+	assert.Nil(t, flow.RegisterDAG("test", d.testDAG))
+	return flow
+}
+
+func spansByName(spans []*trace.SpanData) map[string][]*trace.SpanData {
+	byName := make(map[string][]*trace.SpanData)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+	}
+	return byName
+}
+
+func TestTracing(t *testing.T) {
+	exporter := trace.NewInMemoryExporter()
+	d := &tracedDAG{}
+	flow := newTracedFlow(t, mem.NewMemStore(), d, exporter)
+
+	caller, err := trace.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.Nil(t, err)
+	ctx := trace.ContextWithSpanContext(context.Background(), caller)
+	assert.Nil(t, flow.RunDAG(ctx, "test", "req-1", types.Data{}, types.WithTenant("acme")))
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	status, err := flow.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 7)
+	byName := spansByName(spans)
+	request := byName["test"][0]
+	assert.Equal(t, caller, request.Parent)
+	assert.Equal(t, caller.TraceID, request.SpanContext.TraceID)
+	assert.Equal(t, "finished", request.Attributes["workflow.status"])
+	assert.Equal(t, "req-1", request.Attributes["workflow.request_id"])
+	assert.Equal(t, "acme", request.Attributes["workflow.tenant"])
+	// the request span ends last
+	assert.Same(t, request, spans[len(spans)-1])
+
+	node1 := byName["test.node1"]
+	assert.Len(t, node1, 2)
+	assert.Equal(t, 1, node1[0].Attributes["workflow.attempt"])
+	assert.Equal(t, "retry", node1[0].Attributes["workflow.status"])
+	assert.Equal(t, trace.StatusError, node1[0].Status)
+	assert.Equal(t, 2, node1[1].Attributes["workflow.attempt"])
+	assert.Equal(t, "succeeded", node1[1].Attributes["workflow.status"])
+	assert.Equal(t, request.SpanContext, node1[1].Parent)
+	assert.Equal(t, "test", node1[1].Attributes["workflow.dag"])
+	assert.Equal(t, "test.node1", node1[1].Attributes["workflow.vertex"])
+	// the nodes run with their spans
+	assert.Equal(t, []trace.SpanContext{node1[0].SpanContext, node1[1].SpanContext}, d.seen)
+
+	sub := byName["test.sub"][0]
+	assert.Equal(t, request.SpanContext, sub.Parent)
+	assert.Equal(t, sub.SpanContext, byName["test.sub.prepare"][0].Parent)
+	assert.Equal(t, sub.SpanContext, byName["test.sub.work"][0].Parent)
+	assert.Equal(t, request.SpanContext, byName["test.node3"][0].Parent)
+	assert.False(t, sub.EndTime.After(byName["test.node3"][0].StartTime))
+	for _, span := range spans {
+		assert.Equal(t, caller.TraceID, span.SpanContext.TraceID, span.Name)
+	}
+
+	// terminated
+	exporter.Reset()
+	assert.Nil(t, flow.RunDAG(context.Background(), "test", "req-2", types.Data{}))
+	assert.Nil(t, flow.TerminateRequest(context.Background(), "req-2"))
+	spans = exporter.Spans()
+	assert.Len(t, spans, 1)
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.Equal(t, trace.StatusError, spans[0].Status)
+	assert.Equal(t, "fatal", spans[0].Attributes["workflow.status"])
+}
+
+func TestTracing_Reload(t *testing.T) {
+	s := mem.NewMemStore()
+	exporter := trace.NewInMemoryExporter()
+	flow := newTracedFlow(t, s, &tracedDAG{retried: true, pause: true}, exporter)
+
+	caller := trace.SpanContext{TraceID: trace.NewTraceID(), SpanID: trace.NewSpanID(), Sampled: true}
+	ctx := trace.ContextWithSpanContext(context.Background(), caller)
+	assert.Nil(t, flow.RunDAG(ctx, "test", "req-1", types.Data{}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flow.runOnce())
+	}
+	assert.Nil(t, flow.Close(context.Background()))
+	spans := spansByName(exporter.Spans())
+	// the request and the sub DAG are still open
+	assert.Len(t, spans, 2)
+	node1, prepare := spans["test.node1"][0], spans["test.sub.prepare"][0]
+	assert.Equal(t, "paused", prepare.Attributes["workflow.status"])
+	assert.Equal(t, trace.StatusOK, prepare.Status)
+
+	// reloaded by another process
+	reloaded := trace.NewInMemoryExporter()
+	other := newTracedFlow(t, s, &tracedDAG{retried: true}, reloaded)
+	errs, err := other.ReloadRequests(context.Background())
+	assert.Nil(t, err)
+	assert.Nil(t, errs["req-1"])
+	// the request paused by the node waits for resuming after reloaded
+	status, err := other.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Paused, status.Status)
+	assert.Nil(t, other.ResumeRequest(context.Background(), "req-1"))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, other.runOnce())
+	}
+	status, err = other.GetRequestStatus(context.Background(), "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+
+	spans = spansByName(reloaded.Spans())
+	request, sub := spans["test"][0], spans["test.sub"][0]
+	assert.Equal(t, node1.Parent, request.SpanContext)
+	assert.Equal(t, caller, request.Parent)
+	assert.Equal(t, prepare.Parent, sub.SpanContext)
+	assert.Equal(t, request.SpanContext, sub.Parent)
+	assert.True(t, sub.StartTime.Before(prepare.StartTime))
+	assert.True(t, request.StartTime.Before(node1.StartTime))
+
+	again := spans["test.sub.prepare"][0]
+	assert.Equal(t, sub.SpanContext, again.Parent)
+	assert.Equal(t, 2, again.Attributes["workflow.attempt"])
+	assert.Equal(t, "succeeded", again.Attributes["workflow.status"])
+}
@@ -0,0 +1,194 @@
+package runtime
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+const (
+	LeasePath = "/lease/"
+)
+
+type leaseRecord struct {
+	Owner      string
+	ExpireTime time.Time
+}
+
+func (l *leaseRecord) heldByOther(owner string, now time.Time) bool {
+	return l.Owner != owner && now.Before(l.ExpireTime)
+}
+
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(b))
+}
+
+/**
+ * leaseKeeper claims requests for the engine on the shared store.
+ * The lease is taken by compare-and-set if the store is a store.TxStore,
+ * otherwise by read, write and read again to verify, so that the instances racing for the same lease would find out the winner.
+ */
+type leaseKeeper struct {
+	store store.Store
+	owner string
+	ttl   time.Duration
+}
+
+func newLeaseKeeper(store store.Store, owner string, ttl time.Duration) *leaseKeeper {
+	if owner == "" {
+		owner = defaultInstanceID()
+	}
+	return &leaseKeeper{store: store, owner: owner, ttl: ttl}
+}
+
+func (l *leaseKeeper) load(ctx context.Context, requestID string) (*leaseRecord, error) {
+	b, err := l.store.Get(ctx, LeasePath, requestID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if b == nil {
+		return nil, nil
+	}
+	lease := &leaseRecord{}
+	if err := utils.Unserialize(b, lease); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return lease, nil
+}
+
+/**
+ * acquire takes the lease of the request,
+ * it returns ErrLeaseHeld if the lease is held by another alive instance.
+ */
+func (l *leaseKeeper) acquire(ctx context.Context, requestID string) error {
+	return errors.Trace(l.claim(ctx, requestID, false))
+}
+
+/**
+ * renew extends the lease of the request held by this instance,
+ * it returns ErrLeaseHeld if the lease is gone or held by another instance.
+ */
+func (l *leaseKeeper) renew(ctx context.Context, requestID string) error {
+	return errors.Trace(l.claim(ctx, requestID, true))
+}
+
+func (l *leaseKeeper) claim(ctx context.Context, requestID string, mustExist bool) error {
+	if txStore, ok := l.store.(store.TxStore); ok {
+		return errors.Trace(l.claimCAS(ctx, txStore, requestID, mustExist))
+	}
+
+	lease, err := l.load(ctx, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if lease == nil && mustExist {
+		return errLeaseHeld(requestID, "nobody")
+	}
+	if lease != nil && lease.heldByOther(l.owner, time.Now()) {
+		return errLeaseHeld(requestID, lease.Owner)
+	}
+
+	b, err := l.newLease()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err := l.store.Set(ctx, LeasePath, requestID, b); err != nil {
+		return errors.Trace(err)
+	}
+
+	// verify in case of racing with the others
+	if lease, err = l.load(ctx, requestID); err != nil {
+		return errors.Trace(err)
+	}
+	if lease == nil || lease.Owner != l.owner {
+		return errLeaseHeld(requestID, "the others")
+	}
+	return nil
+}
+
+func (l *leaseKeeper) claimCAS(ctx context.Context, txStore store.TxStore, requestID string, mustExist bool) error {
+	b, version, err := txStore.GetVersion(ctx, LeasePath, requestID)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if b == nil && mustExist {
+		return errLeaseHeld(requestID, "nobody")
+	}
+	if b != nil {
+		lease := &leaseRecord{}
+		if err := utils.Unserialize(b, lease); err != nil {
+			return errors.Trace(err)
+		}
+		if lease.heldByOther(l.owner, time.Now()) {
+			return errLeaseHeld(requestID, lease.Owner)
+		}
+	}
+
+	if b, err = l.newLease(); err != nil {
+		return errors.Trace(err)
+	}
+	_, err = txStore.CompareAndSet(ctx, LeasePath, requestID, b, version)
+	if errors.Is(err, store.ErrVersionConflict) {
+		return errLeaseHeld(requestID, "the others")
+	}
+	return errors.Trace(err)
+}
+
+func (l *leaseKeeper) newLease() ([]byte, error) {
+	return utils.Serialize(&leaseRecord{Owner: l.owner, ExpireTime: time.Now().Add(l.ttl)})
+}
+
+func errLeaseHeld(requestID, owner string) error {
+	return errors.WithType(errors.Errorf("request %s held by %s", requestID, owner), types.ErrLeaseHeld)
+}
+
+/**
+ * release removes the lease of the request if it is held by this instance
+ */
+func (l *leaseKeeper) release(ctx context.Context, requestID string) error {
+	txStore, ok := l.store.(store.TxStore)
+	if !ok {
+		lease, err := l.load(ctx, requestID)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if lease == nil || lease.Owner != l.owner {
+			return nil
+		}
+		return errors.Trace(l.store.Remove(ctx, LeasePath, requestID))
+	}
+
+	b, version, err := txStore.GetVersion(ctx, LeasePath, requestID)
+	if err != nil || b == nil {
+		return errors.Trace(err)
+	}
+	lease := &leaseRecord{}
+	if err := utils.Unserialize(b, lease); err != nil {
+		return errors.Trace(err)
+	}
+	if lease.Owner != l.owner {
+		return nil
+	}
+	op := store.RemoveOp(LeasePath, requestID)
+	op.Version = version
+	err = txStore.Batch(ctx, []store.Op{op})
+	if errors.Is(err, store.ErrVersionConflict) {
+		// taken by the others in the meantime
+		return nil
+	}
+	return errors.Trace(err)
+}
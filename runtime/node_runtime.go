@@ -74,12 +74,41 @@ func (n *nodeRuntime) runNode(fc *flowContext, input types.Data) (runContext, ty
 	return n.node.nextRC, output, nil
 }
 
+/**
+ * checkOverride makes sure the override can be applied on the node
+ */
+func (n *nodeRuntime) checkOverride(o *types.VertexOverride) error {
+	switch {
+	case n.nodeType == node && o.Type == types.OverrideSkip:
+		return nil
+	case n.nodeType == condition && o.Type == types.OverrideForceBranch:
+		return nil
+	}
+	return errors.NotSupportedf("override %s on %v", o.Type, n.path)
+}
+
+func (n *nodeRuntime) runOverride(o *types.VertexOverride, input types.Data) (runContext, types.Data, error) {
+	if err := n.checkOverride(o); err != nil {
+		return n, nil, types.NewFatalError(err)
+	}
+	if n.nodeType == node {
+		return n.node.nextRC, o.Output, nil
+	}
+	if o.Branch {
+		return n.cond.trueRC, input, nil
+	}
+	return n.cond.falseRC, input, nil
+}
+
 func (n *nodeRuntime) runHandler(fc *flowContext, input types.Data) (nextRC runContext, output types.Data, retErr error) {
 	defer func() {
 		if r := recover(); r != nil {
 			retErr = types.NewFatalError(fmt.Errorf("panic on %s: %v", fc.GetCurrentVertex(), r))
 		}
 	}()
+	if o := fc.takeOverride(); o != nil {
+		return n.runOverride(o, input)
+	}
 	switch n.nodeType {
 	case node:
 		{
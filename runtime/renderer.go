@@ -12,6 +12,14 @@ import (
 
 func (f *flow) renderDOT(plan *dagExecutePlan, records map[string]*types.NodeTraceRecord) (string, error) {
 	renderer := newDAGRenderer()
+	if f.redaction != nil && len(records) > 0 {
+		// the records saved before the rules are added are not redacted yet
+		redacted := make(map[string]*types.NodeTraceRecord, len(records))
+		for vertex, record := range records {
+			redacted[vertex] = f.redaction.Redact(record)
+		}
+		records = redacted
+	}
 	return renderer.generateDOT(plan, records)
 }
 
@@ -69,6 +77,8 @@ func (d *dagRenderer) calcAttr(prefix, name string) string {
 		color = "white"
 	case record.EndTime.IsZero():
 		color = "yellow"
+	case record.Override != nil:
+		color = "purple"
 	case record.Error != "":
 		color = "red"
 	default:
@@ -2,19 +2,23 @@ package runtime
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gammazero/workerpool"
 	"github.com/juju/errors"
-	log "github.com/sirupsen/logrus"
 	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/trace"
 	"github.com/warriorguo/workflow/types"
 	"github.com/warriorguo/workflow/utils"
 )
 
 const (
-	RunContextPath = "/run_context/"
+	RunContextPath  = "/run_context/"
+	RequestInfoPath = "/request/"
 )
 
 var (
@@ -26,10 +30,12 @@ type runContext interface {
 	getPath() utils.Path
 }
 
-func newBatchRunner(concurrency int, asyncFlag bool) *batchRunner {
+func newBatchRunner(concurrency int, asyncFlag bool, scheduler *fairScheduler, metrics *flowMetrics) *batchRunner {
 	return &batchRunner{
 		wp:        workerpool.New(concurrency),
 		asyncFlag: asyncFlag,
+		scheduler: scheduler,
+		metrics:   metrics,
 	}
 }
 
@@ -38,7 +44,10 @@ type batchRunner struct {
 
 	wp        *workerpool.WorkerPool
 	asyncFlag bool
+	scheduler *fairScheduler
 	runners   map[string]*contextRunner
+	// nil if the metrics are not collected
+	metrics *flowMetrics
 }
 
 func (b *batchRunner) exists(key string) bool {
@@ -49,6 +58,17 @@ func (b *batchRunner) exists(key string) bool {
 	return exists
 }
 
+func (b *batchRunner) keys() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0, len(b.runners))
+	for key := range b.runners {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func (b *batchRunner) get(key string) *contextRunner {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -60,10 +80,13 @@ func (b *batchRunner) remove(key string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if _, exists := b.runners[key]; !exists {
+	r, exists := b.runners[key]
+	if !exists {
 		return
 	}
 	delete(b.runners, key)
+	b.scheduler.leave(r.group)
+	b.metrics.requestRemoved(r)
 }
 
 func (b *batchRunner) add(key string, r *contextRunner) error {
@@ -76,7 +99,13 @@ func (b *batchRunner) add(key string, r *contextRunner) error {
 	if _, exists := b.runners[key]; exists {
 		return errors.AlreadyExistsf("key: %s", key)
 	}
+	r.group = b.scheduler.groupKey(r.meta)
+	r.metrics = b.metrics
+	if err := b.scheduler.admit(r.group); err != nil {
+		return errors.Trace(err)
+	}
 	b.runners[key] = r
+	b.metrics.requestAdded(r)
 	return nil
 }
 
@@ -88,7 +117,7 @@ func (b *batchRunner) stopWait(ctx context.Context) error {
 
 	var retErr error
 	for key, r := range b.runners {
-		err := r.setStatus(ctx, types.Paused)
+		err := r.suspend(ctx)
 		if err != nil {
 			retErr = errors.Wrapf(retErr, err, "failed on %s", key)
 		}
@@ -96,34 +125,84 @@ func (b *batchRunner) stopWait(ctx context.Context) error {
 	return retErr
 }
 
+/**
+ * runOnce runs the requests picked, the synchronous ones are run without b.mu,
+ * then it emits the events of the runners once b.mu is released.
+ */
 func (b *batchRunner) runOnce(ctx context.Context, maxRunAmount int) error {
+	runners, picked, err := b.pickLocked(ctx, maxRunAmount)
+	for _, r := range picked {
+		if err == nil {
+			err = errors.Trace(r.runOnce(ctx, r.fc.requestID))
+		}
+		b.scheduler.done(r.group)
+	}
+	if len(picked) > 0 {
+		// the terminated ones leave before their events are emitted
+		b.removeTerminated()
+	}
+	for _, r := range runners {
+		r.flushEvents()
+	}
+	return err
+}
+
+/**
+ * pickLocked returns the runners visited, including the removed ones, whose events are not emitted yet,
+ * along with the runners picked to run synchronously, the asynchronous ones are submitted to the worker pool.
+ */
+func (b *batchRunner) pickLocked(ctx context.Context, maxRunAmount int) ([]*contextRunner, []*contextRunner, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	if len(b.runners) == 0 {
-		return nil
+		return nil, nil, nil
 	}
 
-	runAmount := 0
-	for key, r := range b.runners {
-		if !r.canRun() {
-			continue
+	runners := make([]*contextRunner, 0, len(b.runners))
+	for _, r := range b.runners {
+		runners = append(runners, r)
+	}
+
+	candidates := make([]*contextRunner, 0, len(b.runners))
+	for _, r := range runners {
+		pending, err := r.collectAsyncResult()
+		if err != nil {
+			return runners, nil, errors.Trace(err)
 		}
-		if runAmount++; runAmount > maxRunAmount {
-			break
+		if !pending {
+			if err := r.applyNextStatus(ctx); err != nil {
+				return runners, nil, errors.Trace(err)
+			}
 		}
-
-		var err error
-		if b.asyncFlag {
-			err = errors.Trace(r.tryAsyncRunOnce(ctx, b.wp, key))
-		} else {
-			err = errors.Trace(r.runOnce(ctx, key))
+		if pending || !r.canRun() {
+			continue
 		}
-		if err != nil {
-			return errors.Trace(err)
+		candidates = append(candidates, r)
+	}
+
+	picked := b.scheduler.pick(candidates, maxRunAmount)
+	b.metrics.scheduled(candidates, picked)
+	if b.asyncFlag {
+		for _, r := range picked {
+			r.asyncRunOnce(ctx, b.wp, b.scheduler.done)
 		}
+		picked = nil
+	}
+	if len(picked) == 0 {
+		b.removeTerminatedLocked()
 	}
+	return runners, picked, nil
+}
+
+func (b *batchRunner) removeTerminated() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.removeTerminatedLocked()
+}
 
+func (b *batchRunner) removeTerminatedLocked() {
 	keyToRemoved := make([]string, 0, len(b.runners))
 	for key, r := range b.runners {
 		if r.tryCheckCanRemove() {
@@ -131,14 +210,60 @@ func (b *batchRunner) runOnce(ctx context.Context, maxRunAmount int) error {
 		}
 	}
 	for _, key := range keyToRemoved {
+		b.scheduler.leave(b.runners[key].group)
+		b.metrics.requestRemoved(b.runners[key])
 		delete(b.runners, key)
 	}
-	return nil
+}
+
+/**
+ * requestMeta is the information of a request given on RunDAG,
+ * it is saved along with the rerun context.
+ */
+type requestMeta struct {
+	DAGName        string            `json:",omitempty"`
+	Tenant         string            `json:",omitempty"`
+	Labels         map[string]string `json:",omitempty"`
+	IdempotencyKey string            `json:",omitempty"`
+	CreateTime     time.Time         `json:",omitempty"`
+	// the spans open of the request, nil if it is not traced
+	Trace *traceState `json:",omitempty"`
+}
+
+func newRequestMeta(dagName string, opts *types.RunOptions) *requestMeta {
+	return &requestMeta{
+		DAGName:        dagName,
+		Tenant:         opts.Tenant,
+		Labels:         opts.Labels,
+		IdempotencyKey: opts.IdempotencyKey,
+		CreateTime:     time.Now(),
+	}
+}
+
+/**
+ * runnerObserver gets notified on the lifecycle of contextRunner
+ */
+type runnerObserver interface {
+	// onTerminal is invoked once the request comes to a terminal status
+	onTerminal(ctx context.Context, r *contextRunner)
 }
 
 type contextRunner struct {
-	mu    sync.Mutex
-	store store.Store
+	mu     sync.Mutex
+	store  store.Store
+	codec  types.DataCodec
+	blobs  *blobOffloader
+	events *eventDispatcher
+	// nil if the requests are not traced
+	tracer trace.Tracer
+	logger types.Logger
+	// nil if the metrics are not collected, assigned by batchRunner
+	metrics *flowMetrics
+
+	meta     *requestMeta
+	observer runnerObserver
+	// scheduling group key, assigned by batchRunner
+	group string
 
 	errMu   sync.Mutex
 	errCh   chan error
@@ -148,20 +273,43 @@ type contextRunner struct {
 
 	nextStatusMu sync.Mutex
 	nextStatus   types.StatusType
+	// the operator set the next status
+	nextOperator string
 
 	createTime  time.Time
 	lastRunTime time.Time
 	nextRunTime time.Time
+	// since when the request is ready to run, for the scheduler lag
+	readyTime time.Time
 
 	runningRC   runContext
 	fc          *flowContext
 	currentData types.Data
+	// the current data has not changed since offloaded, see offloadCurrentData
+	dataOffloaded bool
+
+	// the events queued under mu, see flushEvents
+	eventsMu      sync.Mutex
+	pendingEvents []*types.LifecycleEvent
+	flushing      bool
+
+	// set once the request is taken over by another instance, then it never runs or saves
+	leaseLost atomic.Bool
+	// paused by the engine closing rather than the operator
+	suspended bool
+	// the node is running, mu is released meanwhile to emit the started events, see runOnce
+	nodeRunning bool
 }
 
 type flowRerunContext struct {
 	Status     types.StatusType `json:",omitempty"`
 	Entrypoint utils.Path       `json:",omitempty"`
 	Data       types.Data       `json:",omitempty"`
+	Meta       *requestMeta     `json:",omitempty"`
+	// the override not applied yet
+	Override *types.VertexOverride `json:",omitempty"`
+	// the request is paused by the engine closing, it is resumed once reloaded
+	Suspended bool `json:",omitempty"`
 }
 
 func (r *contextRunner) exportRerunContext() *flowRerunContext {
@@ -172,36 +320,93 @@ func (r *contextRunner) exportRerunContext() *flowRerunContext {
 		Status:     r.runningStatus,
 		Entrypoint: r.runningRC.getPath(),
 		Data:       r.currentData,
+		Meta:       r.meta,
+		Override:   r.fc.override,
+		Suspended:  r.suspended,
 	}
 }
 
-func (r *contextRunner) saveContext(ctx context.Context) error {
-	rerunC := r.exportRerunContext()
-	if rerunC == nil {
-		return errors.Trace(r.store.Remove(ctx, RunContextPath, r.fc.requestID))
+/**
+ * saveContext saves the run context along with the request index entry,
+ * the ops given are committed in the same batch, which is atomic if the store is a store.TxStore.
+ * The buffered writes of the store are flushed once the request is paused.
+ */
+func (r *contextRunner) saveContext(ctx context.Context, ops ...store.Op) error {
+	if r.leaseLost.Load() {
+		return nil
+	}
+
+	r.offloadCurrentData(ctx)
+	if rerunC := r.exportRerunContext(); rerunC == nil {
+		ops = append(ops, store.RemoveOp(RunContextPath, r.fc.requestID))
+	} else {
+		encoded, err := encodeRerunContext(r.codec, rerunC)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		b, err := utils.Serialize(encoded)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		ops = append(ops, store.SetOp(RunContextPath, r.fc.requestID, b))
 	}
 
-	b, err := utils.Serialize(rerunC)
+	b, err := utils.Serialize(r.exportRequestInfo())
 	if err != nil {
 		return errors.Trace(err)
 	}
+	ops = append(ops, store.SetOp(RequestInfoPath, r.fc.requestID, b))
+	if err := store.Batch(ctx, r.store, ops); err != nil {
+		return errors.Trace(err)
+	}
+	if r.runningStatus == types.Paused {
+		// a paused request may wait long, make sure it is persisted
+		return errors.Trace(store.Flush(ctx, r.store))
+	}
+	return nil
+}
 
-	return errors.Trace(r.store.Set(ctx, RunContextPath, r.fc.requestID, b))
+/**
+ * exportRequestInfo returns the index entry of the request, which is used by ListRequests
+ */
+func (r *contextRunner) exportRequestInfo() *types.RequestInfo {
+	info := &types.RequestInfo{
+		RequestID:  r.fc.requestID,
+		DAGName:    r.meta.DAGName,
+		Tenant:     r.meta.Tenant,
+		Labels:     r.meta.Labels,
+		Status:     r.runningStatus,
+		CreateTime: r.meta.CreateTime,
+		UpdateTime: time.Now(),
+
+		IdempotencyKey: r.meta.IdempotencyKey,
+	}
+	if r.runningRC != nil {
+		info.CurrentVertex = strings.Join(r.runningRC.getPath(), ".")
+	} else if r.fc.rcRecord != nil {
+		info.CurrentVertex = strings.Join(r.fc.rcRecord.Path, ".")
+	}
+	return info
 }
 
-func newContextRunner(store store.Store, requestID string, rc runContext, input types.Data) *contextRunner {
+func newContextRunner(store store.Store, codec types.DataCodec, requestID string, meta *requestMeta, observer runnerObserver, rc runContext, input types.Data) *contextRunner {
 	cr := &contextRunner{}
 	cr.store = store
+	cr.codec = codec
+	cr.meta = meta
+	cr.observer = observer
 	cr.runningStatus = types.Pending
 	cr.currentData = input
 	cr.runningRC = rc
-	cr.createTime = time.Now()
-	cr.fc = newFlowContext(store, requestID)
+	cr.createTime = meta.CreateTime
+	cr.readyTime = time.Now()
+	cr.fc = newFlowContext(store, codec, requestID)
+	cr.logger = cr.fc.logger
 
 	return cr
 }
 
-func (r *contextRunner) setNextStatus(status types.StatusType) error {
+func (r *contextRunner) setNextStatus(status types.StatusType, operator string) error {
 	r.nextStatusMu.Lock()
 	defer r.nextStatusMu.Unlock()
 
@@ -211,6 +416,7 @@ func (r *contextRunner) setNextStatus(status types.StatusType) error {
 			currentStatus, status)
 	}
 	r.nextStatus = status
+	r.nextOperator = operator
 	return nil
 }
 
@@ -230,27 +436,89 @@ func (r *contextRunner) canSetStatus(currentStatus, status types.StatusType) boo
 	}
 }
 
-func (r *contextRunner) assignNextStatus() {
+/**
+ * assignNextStatus assigns the status set by setNextStatus if it is still allowed,
+ * the change is recorded in the history only once it is assigned.
+ */
+func (r *contextRunner) assignNextStatus(ctx context.Context) {
+	r.nextStatusMu.Lock()
+	if r.nextStatus == types.None {
+		r.nextStatusMu.Unlock()
+		return
+	}
+	currentStatus, operator := r.runningStatus, r.nextOperator
+	assigned := r.canSetStatus(currentStatus, r.nextStatus)
+	if assigned {
+		r.runningStatus = r.nextStatus
+		if r.runningStatus == types.Retrying {
+			// resumed by the caller, no need to wait for the backoff
+			r.nextRunTime = time.Time{}
+			r.readyTime = time.Now()
+		}
+		r.emitStatusChanged(currentStatus, operator)
+	} else {
+		r.logger.Errorf("failed to set status from %v to %v", currentStatus, r.nextStatus)
+	}
+	r.nextStatus = types.None
+	r.nextOperator = ""
+	r.nextStatusMu.Unlock()
+
+	if assigned {
+		appendHistory(ctx, r.store, r.logger, r.fc.requestID, &types.HistoryEvent{
+			Type:     types.EventStatusChanged,
+			Status:   r.runningStatus,
+			Operator: operator,
+		})
+	}
+}
+
+func (r *contextRunner) hasNextStatus() bool {
 	r.nextStatusMu.Lock()
 	defer r.nextStatusMu.Unlock()
 
-	if r.nextStatus != types.None {
-		currentStatus := r.runningStatus
-		if r.canSetStatus(currentStatus, r.nextStatus) {
-			r.runningStatus = r.nextStatus
-		} else {
-			log.Errorf("%s failed to set status from %v to %v", r.fc.requestID, currentStatus, r.nextStatus)
-		}
-		r.nextStatus = types.None
+	return r.nextStatus != types.None
+}
+
+/**
+ * applyNextStatus assigns the status set by setNextStatus if the request is not running,
+ * a running one assigns it by itself after the node finished.
+ */
+func (r *contextRunner) applyNextStatus(ctx context.Context) error {
+	if !r.hasNextStatus() || !r.tryLockIdle() {
+		return nil
 	}
+	defer r.mu.Unlock()
+
+	r.assignNextStatus(ctx)
+	err := errors.Trace(r.saveContext(ctx))
+	r.checkTerminal(ctx)
+	return err
 }
 
-func (r *contextRunner) canRun() bool {
+/**
+ * tryLockIdle locks mu unless it is held or the node is running with mu released
+ */
+func (r *contextRunner) tryLockIdle() bool {
 	if !r.mu.TryLock() {
 		return false
 	}
+	if r.nodeRunning {
+		r.mu.Unlock()
+		return false
+	}
+	return true
+}
+
+func (r *contextRunner) canRun() bool {
+	if r.leaseLost.Load() || !r.tryLockIdle() {
+		return false
+	}
 	defer r.mu.Unlock()
 
+	return r.runnable()
+}
+
+func (r *contextRunner) runnable() bool {
 	if r.runningStatus == types.Pending ||
 		r.runningStatus == types.Running ||
 		r.runningStatus == types.Retrying {
@@ -259,100 +527,205 @@ func (r *contextRunner) canRun() bool {
 	return false
 }
 
+/**
+ * tryCheckCanRemove tells whether the runner can leave the memory, which is once the request is terminated.
+ */
 func (r *contextRunner) tryCheckCanRemove() bool {
-	if !r.mu.TryLock() {
+	if !r.tryLockIdle() {
 		return false
 	}
 	defer r.mu.Unlock()
 
-	if r.runningStatus == types.Failed ||
-		r.runningStatus == types.Finished {
-		return true
-	}
-	return false
+	return r.runningStatus.IsTerminal()
+}
+
+/**
+ * asyncRunOnce submits runOnce to the worker pool,
+ * the result would be fetched by collectAsyncResult.
+ */
+func (r *contextRunner) asyncRunOnce(ctx context.Context, wp *workerpool.WorkerPool, done func(group string)) {
+	r.errMu.Lock()
+	defer r.errMu.Unlock()
+
+	errCh := make(chan error, 1)
+	r.errCh = errCh
+	wp.Submit(func() {
+		err := r.runOnce(ctx, r.fc.requestID)
+		r.flushEvents()
+		done(r.group)
+		errCh <- err
+	})
 }
 
-func (r *contextRunner) tryAsyncRunOnce(ctx context.Context, wp *workerpool.WorkerPool, logPrefix string) error {
+/**
+ * collectAsyncResult returns pending as true if the submitted runOnce has not finished yet,
+ * otherwise it returns the error of the finished one.
+ */
+func (r *contextRunner) collectAsyncResult() (pending bool, err error) {
 	r.errMu.Lock()
 	defer r.errMu.Unlock()
 
 	if r.errCh == nil {
-		r.errCh = make(chan error, 1)
-		wp.Submit(func() {
-			r.errCh <- r.runOnce(ctx, logPrefix)
-		})
+		return false, nil
 	}
 
 	select {
 	case err := <-r.errCh:
 		close(r.errCh)
 		r.errCh = nil
-		return errors.Trace(err)
+		return false, errors.Trace(err)
 	default:
-		return nil
+		return true, nil
 	}
 }
 
-func (r *contextRunner) setStatus(ctx context.Context, status types.StatusType) error {
+/**
+ * suspend pauses the request on closing, the suspended request is resumed once reloaded,
+ * while the one paused by the operator stays paused.
+ */
+func (r *contextRunner) suspend(ctx context.Context) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.runningStatus = status
+	if r.runningStatus == types.Paused || r.runningStatus.IsTerminal() {
+		return nil
+	}
+	r.runningStatus = types.Paused
+	r.suspended = true
 	return errors.Trace(r.saveContext(ctx))
 }
 
+/**
+ * runOnce runs the current node of the request, mu is released while the started events are emitted
+ * so that the listeners see them before the node runs and may query the request meanwhile.
+ */
 func (r *contextRunner) runOnce(ctx context.Context, logPrefix string) error {
-	if !r.canRun() {
+	r.mu.Lock()
+	if r.leaseLost.Load() || r.nodeRunning || !r.runnable() {
+		r.mu.Unlock()
 		return nil
 	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
+	if r.runningStatus == types.Pending {
+		r.runningStatus = types.Running
+		r.queueEvent(r.newEvent(types.LifecycleStarted))
+	}
 	r.runningStatus = types.Running
 	r.lastRunTime = time.Now()
 
 	r.fc.startRecord(ctx, r.runningRC.getPath(), r.currentData)
+	r.emitVertexEvent(types.LifecycleVertexStarted, r.fc.rcRecord, nil)
+	r.nodeRunning = true
+	r.mu.Unlock()
+	r.flushEvents()
+	r.mu.Lock()
+	defer func() {
+		r.nodeRunning = false
+		r.mu.Unlock()
+	}()
+
 	r.fc.Context = ctx
+	span := r.startVertexSpan(r.runningRC.getPath())
+	if span != nil {
+		// the node propagates the span to the calls it makes
+		r.fc.Context = trace.ContextWithSpanContext(ctx, span.SpanContext())
+	}
+	vertexPath := r.fc.rcRecord.Path
+	r.metrics.vertexRunningAdd(1, r, vertexPath)
 	nextRC, output, err := r.runningRC.runOnce(r.fc, r.currentData)
+	r.metrics.vertexRunningAdd(-1, r, vertexPath)
+	// the node may change the current data in place even if it fails
+	r.dataOffloaded = false
+	r.readyTime = time.Now()
+	endVertexSpan(span, err)
+	output, outputOffloaded := r.tryOffloadData(ctx, output)
 	r.fc.endRecord(ctx, output, err)
+	// the node may set the large values to its input in place
+	r.fc.rcRecord.Input = r.offloadData(ctx, r.fc.rcRecord.Input)
+	if err != nil {
+		r.emitVertexEvent(types.LifecycleVertexFailed, r.fc.rcRecord, err)
+	} else {
+		r.emitVertexEvent(types.LifecycleVertexFinished, r.fc.rcRecord, nil)
+	}
+
+	// the record is committed along with the run context
+	ops := make([]store.Op, 0, 1)
+	if op, rerr := r.fc.recordOp(r.redactedRecord(ctx)); rerr != nil {
+		r.fc.Logger().Errorf("failed to save record: %v", rerr)
+	} else {
+		ops = append(ops, op)
+	}
 
 	if err != nil {
-		return r.checkOnError(err)
+		err = r.checkOnError(ctx, err)
+		r.assignNextStatus(ctx)
+		if serr := r.saveContext(ctx, ops...); serr != nil {
+			err = errors.Trace(serr)
+		}
+		r.checkTerminal(ctx)
+		return err
 	}
 
 	r.runningRC = nextRC
-	r.currentData = output
+	r.currentData, r.dataOffloaded = output, outputOffloaded
 
 	if nextRC == Termination {
 		r.runningStatus = types.Finished
+	} else if span != nil {
+		r.endSpans(nextRC.getPath())
 	}
 
-	r.assignNextStatus()
-	return errors.Trace(r.saveContext(ctx))
+	r.assignNextStatus(ctx)
+	err = errors.Trace(r.saveContext(ctx, ops...))
+	r.checkTerminal(ctx)
+	return err
+}
+
+func (r *contextRunner) checkTerminal(ctx context.Context) {
+	if !r.runningStatus.IsTerminal() || r.leaseLost.Load() {
+		return
+	}
+	if r.observer != nil {
+		r.observer.onTerminal(ctx, r)
+	}
+	r.emitTerminal()
+	r.endTrace()
 }
 
-func (r *contextRunner) checkOnError(err error) error {
+func (r *contextRunner) checkOnError(ctx context.Context, err error) error {
 	r.lastErr = err
 
-	switch e := errors.Unwrap(err).(type) {
-	case *types.FatalError:
+	// the error may be traced by each level of the sub DAGs
+	if _, ok := errors.AsType[*types.FatalError](err); ok {
 		r.runningStatus = types.Fatal
 		return nil
-
-	case *types.RetryError:
+	}
+	if e, ok := errors.AsType[*types.RetryError](err); ok {
 		r.nextRunTime = time.Now().Add(e.Backoff)
+		r.readyTime = r.nextRunTime
 		r.runningStatus = types.Retrying
+		appendHistory(ctx, r.store, r.logger, r.fc.requestID, &types.HistoryEvent{
+			Type:    types.EventRetryScheduled,
+			Vertex:  r.fc.executePath.String(),
+			Status:  types.Retrying,
+			Message: fmt.Sprintf("retry after %v", e.Backoff),
+		})
+		if r.events != nil {
+			event := r.newEvent(types.LifecycleRetryScheduled)
+			event.Path, event.Err, event.RetryAt = r.fc.executePath.Export(), err, r.nextRunTime
+			r.queueEvent(event)
+		}
 		return nil
-
-	case *types.PauseError:
+	}
+	if _, ok := errors.AsType[*types.PauseError](err); ok {
+		from := r.runningStatus
 		r.runningStatus = types.Paused
-		return nil
-
-	default:
-		r.runningStatus = types.Failed
+		r.emitStatusChanged(from, "")
 		return nil
 	}
+
+	r.runningStatus = types.Failed
+	return nil
 }
 
 func (r *contextRunner) getStatus() (*types.RequestStatus, error) {
@@ -367,6 +740,120 @@ func (r *contextRunner) getStatus() (*types.RequestStatus, error) {
 	if r.lastErr != nil {
 		status.LastError = r.lastErr.Error()
 	}
+	if r.runningStatus == types.Finished {
+		status.Result = r.currentData
+	}
 
 	return status, nil
 }
+
+/**
+ * normalizeData converts the data to the form decoded by the codec from JSON,
+ * which is the same as the one reloaded from store.
+ */
+func normalizeData(codec types.DataCodec, data types.Data) (types.Data, error) {
+	if data == nil {
+		return nil, nil
+	}
+	encoded, err := codec.Encode(data)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	b, err := utils.Serialize(encoded)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	normalized := types.Data{}
+	if err := utils.Unserialize(b, &normalized); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return codec.Decode(normalized)
+}
+
+func (r *contextRunner) getData() (types.Data, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return normalizeData(r.codec, r.currentData)
+}
+
+/**
+ * patchData applies the merge patch on the data of the paused request and saves it along with the run context
+ */
+func (r *contextRunner) patchData(ctx context.Context, patch types.Data) error {
+	if !r.tryLockIdle() {
+		return errors.NotYetAvailablef("request %s is running", r.fc.requestID)
+	}
+	defer r.mu.Unlock()
+
+	if r.runningStatus != types.Paused || r.hasNextStatus() {
+		return errors.Forbiddenf("request %s is %v, only paused one can be patched", r.fc.requestID, r.runningStatus)
+	}
+
+	current, err := normalizeData(r.codec, r.currentData)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	normalizedPatch, err := normalizeData(r.codec, patch)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	patched, _ := utils.MergePatch(map[string]any(current), map[string]any(normalizedPatch)).(map[string]any)
+
+	r.currentData, r.dataOffloaded = patched, false
+	return errors.Trace(r.saveContext(ctx))
+}
+
+/**
+ * currentNode returns the node to run next in the nested DAGs
+ */
+func currentNode(rc runContext) *nodeRuntime {
+	for {
+		switch v := rc.(type) {
+		case *dagRuntime:
+			rc = v.runningRC
+		case *nodeRuntime:
+			return v
+		default:
+			return nil
+		}
+	}
+}
+
+/**
+ * prepareOverride binds the override to the current node of rc
+ */
+func prepareOverride(rc runContext, o *types.VertexOverride) error {
+	n := currentNode(rc)
+	if n == nil {
+		return errors.NotFoundf("current vertex")
+	}
+	if err := n.checkOverride(o); err != nil {
+		return errors.Trace(err)
+	}
+	o.Vertex = n.path.String()
+	return nil
+}
+
+/**
+ * setOverride makes the paused or retrying request run the current vertex with the override right away
+ */
+func (r *contextRunner) setOverride(ctx context.Context, o *types.VertexOverride) error {
+	if !r.tryLockIdle() {
+		return errors.NotYetAvailablef("request %s is running", r.fc.requestID)
+	}
+	defer r.mu.Unlock()
+
+	if (r.runningStatus != types.Paused && r.runningStatus != types.Retrying) || r.hasNextStatus() {
+		return errors.Forbiddenf("request %s is %v", r.fc.requestID, r.runningStatus)
+	}
+	if err := prepareOverride(r.runningRC, o); err != nil {
+		return errors.Trace(err)
+	}
+
+	r.fc.override = o
+	r.runningStatus = types.Retrying
+	r.nextRunTime = time.Time{}
+	r.readyTime = time.Now()
+	return errors.Trace(r.saveContext(ctx))
+}
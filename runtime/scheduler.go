@@ -0,0 +1,211 @@
+package runtime
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/types"
+)
+
+type schedGroup struct {
+	types.GroupStats
+
+	// picked in the current round, it is reset after each round
+	picked int
+}
+
+func (g *schedGroup) weight() int {
+	if g.Quota.Weight <= 0 {
+		return 1
+	}
+	return g.Quota.Weight
+}
+
+func (g *schedGroup) load() int {
+	return g.RunningNodes + g.picked
+}
+
+func (g *schedGroup) reachNodeLimit() bool {
+	return g.Quota.MaxConcurrentNodes > 0 && g.load() >= g.Quota.MaxConcurrentNodes
+}
+
+/**
+ * lessLoaded compares the load of 2 groups in proportion to their weight,
+ * load(a)/weight(a) < load(b)/weight(b)
+ */
+func (g *schedGroup) lessLoaded(o *schedGroup) bool {
+	l, r := g.load()*o.weight(), o.load()*g.weight()
+	if l != r {
+		return l < r
+	}
+	return g.Group < o.Group
+}
+
+/**
+ * fairScheduler shares the node slots between groups of requests by their weights,
+ * so that a single busy DAG (or tenant) could not take all of the MaxNodeConcurrency slots.
+ * Inside a group, the request which waits the longest runs first.
+ */
+type fairScheduler struct {
+	mu sync.Mutex
+
+	groupBy      types.GroupByType
+	quotas       map[string]types.GroupQuota
+	defaultQuota types.GroupQuota
+
+	groups  map[string]*schedGroup
+	running int
+}
+
+func newFairScheduler(opts *types.FlowOptions) *fairScheduler {
+	return &fairScheduler{
+		groupBy:      opts.SchedulingGroupBy,
+		quotas:       opts.GroupQuotas,
+		defaultQuota: opts.DefaultGroupQuota,
+		groups:       make(map[string]*schedGroup),
+	}
+}
+
+func (s *fairScheduler) groupKey(meta *requestMeta) string {
+	switch s.groupBy {
+	case types.GroupByTenant:
+		return meta.Tenant
+	case types.GroupByDAGAndTenant:
+		return meta.DAGName + "/" + meta.Tenant
+	default:
+		return meta.DAGName
+	}
+}
+
+func (s *fairScheduler) getGroup(key string) *schedGroup {
+	g, exists := s.groups[key]
+	if !exists {
+		g = &schedGroup{}
+		g.Group = key
+		g.Quota = s.defaultQuota
+		if quota, exists := s.quotas[key]; exists {
+			g.Quota = quota
+		}
+		s.groups[key] = g
+	}
+	return g
+}
+
+/**
+ * admit takes an inflight request slot of the group
+ */
+func (s *fairScheduler) admit(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := s.getGroup(key)
+	if limit := g.Quota.MaxInflightRequests; limit > 0 && g.InflightRequests >= limit {
+		g.RejectedRequests++
+		return errors.QuotaLimitExceededf("group %s reached max inflight requests %d", key, limit)
+	}
+	g.InflightRequests++
+	return nil
+}
+
+/**
+ * leave gives back the inflight request slot taken by admit
+ */
+func (s *fairScheduler) leave(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g := s.getGroup(key); g.InflightRequests > 0 {
+		g.InflightRequests--
+	}
+}
+
+/**
+ * pick chooses the runners to run in this round from candidates,
+ * the picked ones are counted as running until done is invoked.
+ */
+func (s *fairScheduler) pick(candidates []*contextRunner, maxRunning int) []*contextRunner {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	byGroup := make(map[string][]*contextRunner)
+	for _, r := range candidates {
+		byGroup[r.group] = append(byGroup[r.group], r)
+	}
+	for key, g := range s.groups {
+		g.RunnableRequests = len(byGroup[key])
+	}
+	for key, runners := range byGroup {
+		s.getGroup(key).RunnableRequests = len(runners)
+		sort.SliceStable(runners, func(i, j int) bool {
+			if !runners[i].lastRunTime.Equal(runners[j].lastRunTime) {
+				return runners[i].lastRunTime.Before(runners[j].lastRunTime)
+			}
+			return runners[i].createTime.Before(runners[j].createTime)
+		})
+	}
+
+	picked := make([]*contextRunner, 0)
+	for slots := maxRunning - s.running; slots > 0; slots-- {
+		var best *schedGroup
+		for key, runners := range byGroup {
+			g := s.groups[key]
+			if len(runners) == 0 {
+				delete(byGroup, key)
+				continue
+			}
+			if g.reachNodeLimit() {
+				g.ThrottledTimes++
+				delete(byGroup, key)
+				continue
+			}
+			if best == nil || g.lessLoaded(best) {
+				best = g
+			}
+		}
+		if best == nil {
+			break
+		}
+
+		runners := byGroup[best.Group]
+		picked = append(picked, runners[0])
+		byGroup[best.Group] = runners[1:]
+		best.picked++
+	}
+
+	for _, g := range s.groups {
+		g.RunningNodes += g.picked
+		g.DispatchedNodes += int64(g.picked)
+		s.running += g.picked
+		g.picked = 0
+	}
+	return picked
+}
+
+/**
+ * done gives back the node slot taken by pick
+ */
+func (s *fairScheduler) done(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g := s.getGroup(key); g.RunningNodes > 0 {
+		g.RunningNodes--
+		s.running--
+	}
+}
+
+func (s *fairScheduler) stats() []*types.GroupStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]*types.GroupStats, 0, len(s.groups))
+	for _, g := range s.groups {
+		gs := g.GroupStats
+		stats = append(stats, &gs)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Group < stats[j].Group
+	})
+	return stats
+}
@@ -0,0 +1,495 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+)
+
+var (
+	_ store.Store   = &cachedStore{}
+	_ store.Scanner = &cachedStore{}
+	_ store.TxStore = &cachedTxStore{}
+	_ store.Flusher = &cachedStore{}
+)
+
+/**
+ * Mode decides when the writes reach the underlying store.
+ *
+ * WriteThrough: every write reaches the underlying store before it returns, the durability is the same as
+ * the underlying store, only the reads are saved by the cache.
+ *
+ * WriteBack: the writes are buffered, the repeated writes to the same key are coalesced, and the buffer
+ * is flushed every FlushInterval, once MaxPending writes are buffered, and on Flush, which the engine calls
+ * when a request is paused and when it is closed. A crash loses the writes buffered, at most a FlushInterval
+ * of them, the requests rerun from the last flushed state after the restart. The writes of a flush are applied
+ * in a single batch, which is atomic if the underlying store is a store.TxStore, so the flushed state is always
+ * consistent. The appended values are flushed after the batch.
+ *
+ * In both modes the cache assumes the engine is the only writer of the store, do NOT use it along with
+ * the engines sharing the store, e.g. EnableLease.
+ */
+type Mode string
+
+const (
+	WriteThrough Mode = "write-through"
+	WriteBack    Mode = "write-back"
+)
+
+// Config holds the cache configuration
+type Config struct {
+	Mode Mode
+	// Capacity is the amount of the values kept in the read cache, 0 disables the read cache
+	Capacity int
+	// FlushInterval is the flush window of WriteBack mode
+	FlushInterval time.Duration
+	// MaxPending is the amount of the buffered writes triggering a flush right away in WriteBack mode
+	MaxPending int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Mode:          WriteThrough,
+		Capacity:      10000,
+		FlushInterval: 100 * time.Millisecond,
+		MaxPending:    1000,
+	}
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	switch c.Mode {
+	case WriteThrough, WriteBack:
+	default:
+		return errors.Errorf("invalid mode: %s", c.Mode)
+	}
+	if c.Capacity < 0 {
+		return errors.New("capacity cannot be negative")
+	}
+	if c.Mode == WriteBack && (c.FlushInterval <= 0 || c.MaxPending <= 0) {
+		return errors.New("flush interval and max pending must be positive in write-back mode")
+	}
+	return nil
+}
+
+type Stats struct {
+	// Hits and Misses are counted by Get
+	Hits   int64
+	Misses int64
+	// Coalesced is the amount of the buffered writes replaced by the later ones
+	Coalesced int64
+	// Flushes is the amount of the successful flushes
+	Flushes int64
+}
+
+/**
+ * pendingWrite is the buffered write of a key, removeFirst indicates a Remove was coalesced into the Set,
+ * which still has to remove the appended values of the key.
+ */
+type pendingWrite struct {
+	op          store.Op
+	removeFirst bool
+}
+
+type cachedStore struct {
+	store  store.Store
+	config *Config
+
+	mu  sync.Mutex
+	lru *lru
+	// pending and appends are the writes buffered, flushing is the ones being flushed
+	pending  map[cacheKey]*pendingWrite
+	appends  map[cacheKey][][]byte
+	flushing map[cacheKey]*pendingWrite
+	stats    Stats
+
+	// flushMu serializes the flushes
+	flushMu  sync.Mutex
+	exitCh   chan struct{}
+	stopOnce sync.Once
+	loopWg   sync.WaitGroup
+}
+
+/**
+ * cachedTxStore passes the version checks to the underlying store.TxStore after flushing,
+ * the values written are cached once the checks passed.
+ */
+type cachedTxStore struct {
+	*cachedStore
+	txStore store.TxStore
+}
+
+// NewCachedStore wraps s with the read cache and the write buffer, config is nil for the defaults
+func NewCachedStore(s store.Store, config *Config) (store.Store, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	cs := &cachedStore{
+		store:   s,
+		config:  config,
+		lru:     newLRU(config.Capacity),
+		pending: make(map[cacheKey]*pendingWrite),
+		appends: make(map[cacheKey][][]byte),
+		exitCh:  make(chan struct{}),
+	}
+	if config.Mode == WriteBack {
+		cs.loopWg.Add(1)
+		go cs.loop()
+	}
+	if txStore, ok := s.(store.TxStore); ok {
+		return &cachedTxStore{cachedStore: cs, txStore: txStore}, nil
+	}
+	return cs, nil
+}
+
+func (s *cachedStore) writeBack() bool {
+	return s.config.Mode == WriteBack
+}
+
+// Stats returns the counters since the store was created
+func (s *cachedStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
+
+/**
+ * buffered returns the value of the buffered write of the key, the caller holds s.mu
+ */
+func (s *cachedStore) buffered(key cacheKey) ([]byte, bool) {
+	for _, writes := range []map[cacheKey]*pendingWrite{s.pending, s.flushing} {
+		if pw, found := writes[key]; found {
+			if pw.op.Type == store.OpRemove {
+				return nil, true
+			}
+			return pw.op.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (s *cachedStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	ck := cacheKey{prefix, key}
+	s.mu.Lock()
+	if value, found := s.buffered(ck); found {
+		s.stats.Hits++
+		s.mu.Unlock()
+		return value, nil
+	}
+	if value, found := s.lru.get(ck); found {
+		s.stats.Hits++
+		s.mu.Unlock()
+		return value, nil
+	}
+	s.stats.Misses++
+	s.mu.Unlock()
+
+	value, err := s.store.Get(ctx, prefix, key)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.mu.Lock()
+	s.lru.add(ck, value)
+	s.mu.Unlock()
+	return value, nil
+}
+
+/**
+ * buffer adds the write to the buffer, the caller holds s.mu
+ */
+func (s *cachedStore) buffer(op store.Op) {
+	ck := cacheKey{op.Prefix, op.Key}
+	pw := &pendingWrite{op: op}
+	if old, found := s.pending[ck]; found {
+		s.stats.Coalesced++
+		pw.removeFirst = old.op.Type == store.OpRemove || old.removeFirst
+	}
+	s.pending[ck] = pw
+
+	if op.Type == store.OpRemove {
+		// the appended values are removed along with the key
+		delete(s.appends, ck)
+		s.lru.put(ck, nil)
+		return
+	}
+	s.lru.put(ck, op.Value)
+}
+
+func (s *cachedStore) pendingCount() int {
+	n := len(s.pending)
+	for _, values := range s.appends {
+		n += len(values)
+	}
+	return n
+}
+
+// cacheOps puts the values written to the read cache, the caller holds s.mu
+func (s *cachedStore) cacheOps(ops []store.Op) {
+	for _, op := range ops {
+		if op.Type == store.OpRemove {
+			s.lru.put(cacheKey{op.Prefix, op.Key}, nil)
+		} else {
+			s.lru.put(cacheKey{op.Prefix, op.Key}, op.Value)
+		}
+	}
+}
+
+/**
+ * write buffers the ops in WriteBack mode, or applies them to the underlying store
+ */
+func (s *cachedStore) write(ctx context.Context, ops []store.Op) error {
+	if !s.writeBack() {
+		if err := store.Batch(ctx, s.store, ops); err != nil {
+			return errors.Trace(err)
+		}
+		s.mu.Lock()
+		s.cacheOps(ops)
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.mu.Lock()
+	for _, op := range ops {
+		s.buffer(op)
+	}
+	full := s.pendingCount() >= s.config.MaxPending
+	s.mu.Unlock()
+
+	if full {
+		return errors.Trace(s.Flush(ctx))
+	}
+	return nil
+}
+
+func copyBytes(p []byte) []byte {
+	if p == nil {
+		return nil
+	}
+	return append([]byte{}, p...)
+}
+
+func (s *cachedStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	// the caller may reuse the value after Set returns
+	return errors.Trace(s.write(ctx, []store.Op{store.SetOp(prefix, key, copyBytes(value))}))
+}
+
+func (s *cachedStore) Remove(ctx context.Context, prefix, key string) error {
+	return errors.Trace(s.write(ctx, []store.Op{store.RemoveOp(prefix, key)}))
+}
+
+func (s *cachedStore) List(ctx context.Context, prefix string, iterator func(key string) bool) error {
+	if err := s.Flush(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.List(ctx, prefix, iterator))
+}
+
+func (s *cachedStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	if err := s.Flush(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(store.Scan(ctx, s.store, prefix, afterKey, func(key string, value []byte) bool {
+		s.mu.Lock()
+		s.lru.add(cacheKey{prefix, key}, value)
+		s.mu.Unlock()
+		return iterator(key, value)
+	}))
+}
+
+func (s *cachedStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	if !s.writeBack() {
+		return errors.Trace(s.store.Append(ctx, prefix, key, value))
+	}
+
+	s.mu.Lock()
+	ck := cacheKey{prefix, key}
+	s.appends[ck] = append(s.appends[ck], copyBytes(value))
+	full := s.pendingCount() >= s.config.MaxPending
+	s.mu.Unlock()
+
+	if full {
+		return errors.Trace(s.Flush(ctx))
+	}
+	return nil
+}
+
+func (s *cachedStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	if err := s.Flush(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.ListAppend(ctx, prefix, key, iterator))
+}
+
+/**
+ * GetVersion and CompareAndSet work on the underlying store directly after flushing,
+ * the versions are only known by it.
+ */
+func (s *cachedTxStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	value, version, err := s.txStore.GetVersion(ctx, prefix, key)
+	return value, version, errors.Trace(err)
+}
+
+func (s *cachedTxStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	if err := s.Flush(ctx); err != nil {
+		return 0, errors.Trace(err)
+	}
+	newVersion, err := s.txStore.CompareAndSet(ctx, prefix, key, value, version)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	s.mu.Lock()
+	s.lru.put(cacheKey{prefix, key}, copyBytes(value))
+	s.mu.Unlock()
+	return newVersion, nil
+}
+
+/**
+ * Batch buffers the ops in WriteBack mode unless any of them checks the version,
+ * the buffered ops are flushed in a single batch later, so they are still applied all or none.
+ */
+func (s *cachedTxStore) Batch(ctx context.Context, ops []store.Op) error {
+	copied := make([]store.Op, len(ops))
+	checked := false
+	for i, op := range ops {
+		copied[i] = op
+		copied[i].Value = copyBytes(op.Value)
+		checked = checked || op.Version != 0
+	}
+	if !checked {
+		return errors.Trace(s.write(ctx, copied))
+	}
+
+	if err := s.Flush(ctx); err != nil {
+		return errors.Trace(err)
+	}
+	if err := s.txStore.Batch(ctx, copied); err != nil {
+		return errors.Trace(err)
+	}
+	s.mu.Lock()
+	s.cacheOps(copied)
+	s.mu.Unlock()
+	return nil
+}
+
+/**
+ * Flush writes the buffered writes to the underlying store, the ones failed are kept to retry.
+ */
+func (s *cachedStore) Flush(ctx context.Context) error {
+	if !s.writeBack() {
+		return nil
+	}
+
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+
+	s.mu.Lock()
+	writes, appends := s.pending, s.appends
+	if len(writes) == 0 && len(appends) == 0 {
+		s.mu.Unlock()
+		return nil
+	}
+	s.pending = make(map[cacheKey]*pendingWrite)
+	s.appends = make(map[cacheKey][][]byte)
+	s.flushing = writes
+	s.mu.Unlock()
+
+	ops := make([]store.Op, 0, len(writes))
+	for _, pw := range writes {
+		if pw.removeFirst {
+			ops = append(ops, store.RemoveOp(pw.op.Prefix, pw.op.Key))
+		}
+		ops = append(ops, pw.op)
+	}
+	if len(ops) > 0 {
+		if err := store.Batch(ctx, s.store, ops); err != nil {
+			s.requeue(writes, appends)
+			return errors.Annotatef(err, "failed to flush")
+		}
+	}
+
+	for ck, values := range appends {
+		for i, value := range values {
+			if err := s.store.Append(ctx, ck.prefix, ck.key, value); err != nil {
+				appends[ck] = values[i:]
+				s.requeue(nil, appends)
+				return errors.Annotatef(err, "failed to flush")
+			}
+		}
+		delete(appends, ck)
+	}
+
+	s.mu.Lock()
+	s.flushing = nil
+	s.stats.Flushes++
+	s.mu.Unlock()
+	return nil
+}
+
+/**
+ * requeue puts the writes failed to flush back in front of the ones buffered in the meantime
+ */
+func (s *cachedStore) requeue(writes map[cacheKey]*pendingWrite, appends map[cacheKey][][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ck, values := range appends {
+		if newer, found := s.pending[ck]; found && (newer.op.Type == store.OpRemove || newer.removeFirst) {
+			// removed after appending
+			continue
+		}
+		s.appends[ck] = append(values, s.appends[ck]...)
+	}
+	for ck, pw := range writes {
+		newer, found := s.pending[ck]
+		if !found {
+			s.pending[ck] = pw
+			continue
+		}
+		newer.removeFirst = newer.removeFirst || pw.removeFirst || pw.op.Type == store.OpRemove
+	}
+	s.flushing = nil
+}
+
+func (s *cachedStore) loop() {
+	defer s.loopWg.Done()
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exitCh:
+			return
+		case <-ticker.C:
+			// the writes failed are kept, and retried by the next flush
+			s.Flush(context.Background())
+		}
+	}
+}
+
+// Close flushes the buffered writes and closes the underlying store if it is closable
+func (s *cachedStore) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.exitCh)
+	})
+	s.loopWg.Wait()
+
+	if err := s.Flush(context.Background()); err != nil {
+		return errors.Trace(err)
+	}
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/mem"
+)
+
+/**
+ * countStore counts the calls reaching the underlying store
+ */
+type countStore struct {
+	store.Store
+	gets   int
+	writes int
+}
+
+func (s *countStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	s.gets++
+	return s.Store.Get(ctx, prefix, key)
+}
+
+func (s *countStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	s.writes++
+	return s.Store.Set(ctx, prefix, key, value)
+}
+
+func (s *countStore) Remove(ctx context.Context, prefix, key string) error {
+	s.writes++
+	return s.Store.Remove(ctx, prefix, key)
+}
+
+func newWriteBackConfig() *Config {
+	config := DefaultConfig()
+	config.Mode = WriteBack
+	// flushed by the tests explicitly
+	config.FlushInterval = time.Hour
+	return config
+}
+
+func TestLRU(t *testing.T) {
+	c := newLRU(2)
+	c.put(cacheKey{"p", "1"}, []byte("1"))
+	c.put(cacheKey{"p", "2"}, []byte("2"))
+	_, found := c.get(cacheKey{"p", "1"})
+	assert.True(t, found)
+	c.put(cacheKey{"p", "3"}, []byte("3"))
+
+	// 2 is the least recently used
+	_, found = c.get(cacheKey{"p", "2"})
+	assert.False(t, found)
+	assert.Equal(t, 2, c.len())
+
+	c.add(cacheKey{"p", "1"}, []byte("stale"))
+	value, _ := c.get(cacheKey{"p", "1"})
+	assert.Equal(t, []byte("1"), value)
+}
+
+func TestCachedStore_WriteThrough(t *testing.T) {
+	ctx := context.Background()
+	inner := &countStore{Store: mem.NewMemStore()}
+	s, err := NewCachedStore(inner, nil)
+	assert.Nil(t, err)
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v1")))
+	assert.Equal(t, 1, inner.writes)
+	for i := 0; i < 3; i++ {
+		value, err := s.Get(ctx, "/test/", "key1")
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), value)
+	}
+	assert.Equal(t, 0, inner.gets)
+
+	// the missing key is cached as well
+	for i := 0; i < 3; i++ {
+		value, err := s.Get(ctx, "/test/", "none")
+		assert.Nil(t, err)
+		assert.Nil(t, value)
+	}
+	assert.Equal(t, 1, inner.gets)
+	assert.Equal(t, int64(1), s.(*cachedStore).Stats().Misses)
+}
+
+func TestCachedStore_WriteBack(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s, err := NewCachedStore(inner, newWriteBackConfig())
+	assert.Nil(t, err)
+	cs := s.(*cachedTxStore)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte{byte(i)}))
+	}
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{9}, value)
+
+	// not written yet
+	value, err = inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	assert.Equal(t, int64(9), cs.Stats().Coalesced)
+
+	assert.Nil(t, cs.Flush(ctx))
+	value, err = inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{9}, value)
+	values := make([]string, 0)
+	assert.Nil(t, inner.ListAppend(ctx, "/history/", "req", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"a"}, values)
+
+	// the removal of the appended values survives the coalescing
+	assert.Nil(t, s.Remove(ctx, "/history/", "req"))
+	assert.Nil(t, s.Set(ctx, "/history/", "req", []byte("v")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("b")))
+	values = values[:0]
+	assert.Nil(t, s.ListAppend(ctx, "/history/", "req", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"b"}, values)
+
+	// written on close
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("v2")))
+	assert.Nil(t, cs.Close())
+	value, err = inner.Get(ctx, "/test/", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+}
+
+func TestCachedStore_MaxPending(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	config := newWriteBackConfig()
+	config.MaxPending = 3
+	s, err := NewCachedStore(inner, config)
+	assert.Nil(t, err)
+	defer s.(*cachedTxStore).Close()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, s.Set(ctx, "/test/", string(rune('a'+i)), []byte("v")))
+	}
+	value, err := inner.Get(ctx, "/test/", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), value)
+}
+
+func TestCachedStore_FlushFailure(t *testing.T) {
+	ctx := context.Background()
+	failing := false
+	inner := mem.NewMemStoreWithErrHandler(func() error {
+		if failing {
+			return errors.New("store failed")
+		}
+		return nil
+	})
+	s, err := NewCachedStore(inner, newWriteBackConfig())
+	assert.Nil(t, err)
+	cs := s.(*cachedTxStore)
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v1")))
+	failing = true
+	assert.NotNil(t, cs.Flush(ctx))
+	failing = false
+
+	// kept to retry, and a later write wins
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v2")))
+	assert.Nil(t, cs.Flush(ctx))
+	value, err := inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+}
+
+func TestCachedStore_Versions(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s, err := NewCachedStore(inner, newWriteBackConfig())
+	assert.Nil(t, err)
+	cs := s.(*cachedTxStore)
+	defer cs.Close()
+
+	// the buffered write is flushed ahead of the version check
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v1")))
+	_, version, err := cs.GetVersion(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), version)
+
+	_, err = cs.CompareAndSet(ctx, "/test/", "key1", []byte("v2"), version+100)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+	_, err = cs.CompareAndSet(ctx, "/test/", "key1", []byte("v2"), version)
+	assert.Nil(t, err)
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+
+	// the store not versioned is not a TxStore
+	s, err = NewCachedStore(&countStore{Store: mem.NewMemStore()}, nil)
+	assert.Nil(t, err)
+	_, ok := s.(store.TxStore)
+	assert.False(t, ok)
+}
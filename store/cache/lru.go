@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"container/list"
+)
+
+type cacheKey struct {
+	prefix string
+	key    string
+}
+
+type lruEntry struct {
+	key   cacheKey
+	value []byte
+}
+
+/**
+ * lru keeps the recent values, a nil value means the key is known not to exist.
+ * It is not safe for concurrent use.
+ */
+type lru struct {
+	capacity int
+	ll       *list.List
+	m        map[cacheKey]*list.Element
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{capacity: capacity, ll: list.New(), m: make(map[cacheKey]*list.Element)}
+}
+
+func (c *lru) get(key cacheKey) ([]byte, bool) {
+	e, found := c.m[key]
+	if !found {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lru) put(key cacheKey, value []byte) {
+	if c.capacity <= 0 {
+		return
+	}
+	if e, found := c.m[key]; found {
+		e.Value.(*lruEntry).value = value
+		c.ll.MoveToFront(e)
+		return
+	}
+	c.m[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	for c.ll.Len() > c.capacity {
+		last := c.ll.Back()
+		c.ll.Remove(last)
+		delete(c.m, last.Value.(*lruEntry).key)
+	}
+}
+
+// add puts the value only if the key is absent, so a value read earlier never overwrites a later write
+func (c *lru) add(key cacheKey, value []byte) {
+	if _, found := c.m[key]; !found {
+		c.put(key, value)
+	}
+}
+
+func (c *lru) len() int {
+	return c.ll.Len()
+}
@@ -0,0 +1,339 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+)
+
+var (
+	_ store.Store   = &compressedStore{}
+	_ store.Scanner = &compressedStore{}
+	_ store.Flusher = &compressedStore{}
+	_ store.TxStore = &compressedTxStore{}
+	_ Reporter      = &compressedStore{}
+)
+
+const (
+	codecGzip = 1
+)
+
+var (
+	// magic starts every compressed value, the values kept uncompressed are the JSON of the engine, which never starts with NUL
+	magic = []byte{0x00, 'W', 'F', 'Z'}
+)
+
+// Config holds the compression configuration
+type Config struct {
+	// Threshold is the minimal size in bytes of the values to compress
+	Threshold int
+	// Level is the gzip compression level
+	Level int
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Threshold: 512,
+		Level:     gzip.DefaultCompression,
+	}
+}
+
+// Validate validates the configuration
+func (c *Config) Validate() error {
+	if c.Threshold < 0 {
+		return errors.New("threshold cannot be negative")
+	}
+	if c.Level < gzip.HuffmanOnly || c.Level > gzip.BestCompression {
+		return errors.Errorf("invalid gzip level: %d", c.Level)
+	}
+	return nil
+}
+
+/**
+ * Reporter is implemented by the compressed store to report the compression ratio
+ */
+type Reporter interface {
+	Stats() *Stats
+}
+
+type Stats struct {
+	// Written is the amount of the values written
+	Written int64
+	// Compressed is the amount of the values stored compressed
+	Compressed int64
+	// RawBytes is the size of the values written
+	RawBytes int64
+	// StoredBytes is the size of the values passed to the underlying store
+	StoredBytes int64
+	// Prefixes breaks the stats down by the first segment of the prefixes, e.g. `/record/`
+	Prefixes map[string]*Stats `json:",omitempty"`
+}
+
+// Ratio returns StoredBytes / RawBytes, the lower the better
+func (s *Stats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 1
+	}
+	return float64(s.StoredBytes) / float64(s.RawBytes)
+}
+
+func (s *Stats) add(raw, stored int, compressed bool) {
+	s.Written++
+	s.RawBytes += int64(raw)
+	s.StoredBytes += int64(stored)
+	if compressed {
+		s.Compressed++
+	}
+}
+
+/**
+ * compressedStore compresses the values over the threshold with gzip before passing them to the underlying store,
+ * a compressed value starts with a marker, so the values not compressed coexist and are returned as they are.
+ * A value is kept uncompressed if compressing does not make it smaller.
+ * Wrap the encrypted store with it rather than the other way round, the ciphertext does not compress.
+ */
+type compressedStore struct {
+	store  store.Store
+	config *Config
+
+	writers sync.Pool
+
+	mu    sync.Mutex
+	stats *Stats
+}
+
+/**
+ * compressedTxStore compresses the values of the versioned writes and the batches as well,
+ * the stats count them the same as Set.
+ */
+type compressedTxStore struct {
+	*compressedStore
+	txStore store.TxStore
+}
+
+// NewCompressedStore wraps s to compress the values, config is nil for the defaults
+func NewCompressedStore(s store.Store, config *Config) (store.Store, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	cs := &compressedStore{
+		store:  s,
+		config: config,
+		stats:  &Stats{Prefixes: make(map[string]*Stats)},
+	}
+	if txStore, ok := s.(store.TxStore); ok {
+		return &compressedTxStore{compressedStore: cs, txStore: txStore}, nil
+	}
+	return cs, nil
+}
+
+/**
+ * prefixRoot returns the first segment of the prefix, so the prefixes per request are counted together
+ */
+func prefixRoot(prefix string) string {
+	if i := strings.Index(strings.TrimPrefix(prefix, "/"), "/"); i >= 0 {
+		return prefix[:i+2]
+	}
+	return prefix
+}
+
+func (s *compressedStore) compress(prefix string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	stored := value
+	if len(value) >= s.config.Threshold {
+		buf := bytes.NewBuffer(make([]byte, 0, len(value)/2))
+		buf.Write(magic)
+		buf.WriteByte(codecGzip)
+
+		w, ok := s.writers.Get().(*gzip.Writer)
+		if ok {
+			w.Reset(buf)
+		} else {
+			var err error
+			if w, err = gzip.NewWriterLevel(buf, s.config.Level); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		if _, err := w.Write(value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if err := w.Close(); err != nil {
+			return nil, errors.Trace(err)
+		}
+		s.writers.Put(w)
+
+		if buf.Len() < len(value) {
+			stored = buf.Bytes()
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	compressed := len(stored) != len(value)
+	s.stats.add(len(value), len(stored), compressed)
+	root := prefixRoot(prefix)
+	if s.stats.Prefixes[root] == nil {
+		s.stats.Prefixes[root] = &Stats{}
+	}
+	s.stats.Prefixes[root].add(len(value), len(stored), compressed)
+	return stored, nil
+}
+
+func decompress(value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, magic) {
+		return value, nil
+	}
+	if len(value) <= len(magic) || value[len(magic)] != codecGzip {
+		return nil, errors.NotSupportedf("compressed value codec")
+	}
+	r, err := gzip.NewReader(bytes.NewReader(value[len(magic)+1:]))
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	return b, errors.Trace(err)
+}
+
+// Stats returns a copy of the stats since the store was created
+func (s *compressedStore) Stats() *Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := *s.stats
+	stats.Prefixes = make(map[string]*Stats, len(s.stats.Prefixes))
+	for root, ps := range s.stats.Prefixes {
+		c := *ps
+		stats.Prefixes[root] = &c
+	}
+	return &stats
+}
+
+func (s *compressedStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	value, err := s.store.Get(ctx, prefix, key)
+	if err != nil || value == nil {
+		return value, errors.Trace(err)
+	}
+	b, err := decompress(value)
+	return b, errors.Annotatef(err, "%s %s", prefix, key)
+}
+
+func (s *compressedStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	stored, err := s.compress(prefix, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.Set(ctx, prefix, key, stored))
+}
+
+func (s *compressedStore) Remove(ctx context.Context, prefix, key string) error {
+	return errors.Trace(s.store.Remove(ctx, prefix, key))
+}
+
+func (s *compressedStore) List(ctx context.Context, prefix string, iterator func(key string) bool) error {
+	return errors.Trace(s.store.List(ctx, prefix, iterator))
+}
+
+func (s *compressedStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	var decompressErr error
+	err := store.Scan(ctx, s.store, prefix, afterKey, func(key string, value []byte) bool {
+		b, err := decompress(value)
+		if err != nil {
+			decompressErr = errors.Annotatef(err, "%s %s", prefix, key)
+			return false
+		}
+		return iterator(key, b)
+	})
+	if decompressErr != nil {
+		return decompressErr
+	}
+	return errors.Trace(err)
+}
+
+func (s *compressedStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	stored, err := s.compress(prefix, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.Append(ctx, prefix, key, stored))
+}
+
+func (s *compressedStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	var decompressErr error
+	err := s.store.ListAppend(ctx, prefix, key, func(value []byte) bool {
+		b, err := decompress(value)
+		if err != nil {
+			decompressErr = errors.Annotatef(err, "%s %s", prefix, key)
+			return false
+		}
+		return iterator(b)
+	})
+	if decompressErr != nil {
+		return decompressErr
+	}
+	return errors.Trace(err)
+}
+
+// Flush flushes the underlying store if it buffers the writes, e.g. the write-back cache
+func (s *compressedStore) Flush(ctx context.Context) error {
+	return errors.Trace(store.Flush(ctx, s.store))
+}
+
+// Close closes the underlying store if it is closable
+func (s *compressedStore) Close() error {
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *compressedTxStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	value, version, err := s.txStore.GetVersion(ctx, prefix, key)
+	if err != nil || value == nil {
+		return value, version, errors.Trace(err)
+	}
+	b, err := decompress(value)
+	if err != nil {
+		return nil, 0, errors.Annotatef(err, "%s %s", prefix, key)
+	}
+	return b, version, nil
+}
+
+func (s *compressedTxStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	stored, err := s.compress(prefix, value)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	newVersion, err := s.txStore.CompareAndSet(ctx, prefix, key, stored, version)
+	return newVersion, errors.Trace(err)
+}
+
+func (s *compressedTxStore) Batch(ctx context.Context, ops []store.Op) error {
+	storedOps := make([]store.Op, len(ops))
+	for i, op := range ops {
+		storedOps[i] = op
+		if op.Type != store.OpSet {
+			continue
+		}
+		stored, err := s.compress(op.Prefix, op.Value)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		storedOps[i].Value = stored
+	}
+	return errors.Trace(s.txStore.Batch(ctx, storedOps))
+}
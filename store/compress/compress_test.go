@@ -0,0 +1,131 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/cache"
+	"github.com/warriorguo/workflow/store/mem"
+)
+
+func newTestStore(t *testing.T, inner store.Store) store.Store {
+	s, err := NewCompressedStore(inner, &Config{Threshold: 64, Level: 6})
+	assert.Nil(t, err)
+	return s
+}
+
+func TestCompressedStore(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s := newTestStore(t, inner)
+
+	large := bytes.Repeat([]byte(`{"k":"v"},`), 100)
+	assert.Nil(t, s.Set(ctx, "/record/req-1", "node1", large))
+	assert.Nil(t, s.Set(ctx, "/record/req-2", "node1", []byte("small")))
+
+	value, err := s.Get(ctx, "/record/req-1", "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, large, value)
+	raw, err := inner.Get(ctx, "/record/req-1", "node1")
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(raw, magic))
+	assert.True(t, len(raw) < len(large))
+
+	// below the threshold
+	raw, err = inner.Get(ctx, "/record/req-2", "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("small"), raw)
+
+	// written before the compression
+	assert.Nil(t, inner.Set(ctx, "/dag/", "req-0", large))
+	value, err = s.Get(ctx, "/dag/", "req-0")
+	assert.Nil(t, err)
+	assert.Equal(t, large, value)
+
+	scanned := make([][]byte, 0)
+	assert.Nil(t, s.(store.Scanner).Scan(ctx, "/record/req-1", "", func(key string, value []byte) bool {
+		scanned = append(scanned, value)
+		return true
+	}))
+	assert.Equal(t, [][]byte{large}, scanned)
+
+	assert.Nil(t, s.Append(ctx, "/history/", "req-1", large))
+	values := make([][]byte, 0)
+	assert.Nil(t, s.ListAppend(ctx, "/history/", "req-1", func(value []byte) bool {
+		values = append(values, value)
+		return true
+	}))
+	assert.Equal(t, [][]byte{large}, values)
+
+	stats := s.(Reporter).Stats()
+	assert.Equal(t, int64(3), stats.Written)
+	assert.Equal(t, int64(2), stats.Compressed)
+	assert.True(t, stats.Ratio() < 0.5)
+	assert.Equal(t, int64(2), stats.Prefixes["/record/"].Written)
+	assert.Equal(t, int64(1), stats.Prefixes["/history/"].Compressed)
+}
+
+func TestCompressedStore_Incompressible(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s := newTestStore(t, inner)
+
+	// random-looking bytes grow by the gzip header
+	value := make([]byte, 100)
+	for i := range value {
+		value[i] = byte(i*73 + i*i*31)
+	}
+	assert.Nil(t, s.Set(ctx, "/test/", "key", value))
+	raw, err := inner.Get(ctx, "/test/", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, value, raw)
+	assert.Equal(t, int64(0), s.(Reporter).Stats().Compressed)
+}
+
+func TestCompressedStore_TxStore(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, mem.NewMemStore()).(store.TxStore)
+
+	large := bytes.Repeat([]byte("a"), 1000)
+	version, err := s.CompareAndSet(ctx, "/test/", "key1", large, 0)
+	assert.Nil(t, err)
+	value, v, err := s.GetVersion(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, large, value)
+	assert.Equal(t, version, v)
+
+	assert.Nil(t, s.Batch(ctx, []store.Op{store.SetOp("/test/", "key2", large)}))
+	value, err = s.(store.Store).Get(ctx, "/test/", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, large, value)
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.Nil(t, DefaultConfig().Validate())
+	assert.NotNil(t, (&Config{Threshold: -1}).Validate())
+	assert.NotNil(t, (&Config{Level: 10}).Validate())
+}
+
+func TestCompressedStore_Flush(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	cached, err := cache.NewCachedStore(inner, &cache.Config{Mode: cache.WriteBack, FlushInterval: time.Hour, MaxPending: 100})
+	assert.Nil(t, err)
+	s := newTestStore(t, cached)
+
+	large := bytes.Repeat([]byte("a"), 1000)
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", large))
+	value, err := inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	// the buffered writes of the cache are flushed through the compressed store
+	assert.Nil(t, store.Flush(ctx, s))
+	value, err = inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.True(t, bytes.HasPrefix(value, magic))
+}
@@ -0,0 +1,292 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+)
+
+var (
+	_ store.Store   = &encryptedStore{}
+	_ store.Scanner = &encryptedStore{}
+	_ store.Flusher = &encryptedStore{}
+	_ store.TxStore = &encryptedTxStore{}
+)
+
+const (
+	headerVersion = 1
+	maxKeyIDSize  = 255
+)
+
+var (
+	// magic starts every ciphertext, its zero byte tells it from the plaintext written before the encryption enabled
+	magic = []byte{0x00, 'W', 'F', 'E'}
+)
+
+/**
+ * encryptedStore encrypts the values with AES-GCM before passing them to the underlying store,
+ * the prefixes and the keys stay plaintext so that List works as usual.
+ * A ciphertext is laid out as:
+ *
+ *	magic(4) | version(1) | key ID size(1) | key ID | nonce(12) | sealed value
+ *
+ * The header, the prefix and the key are authenticated as additional data,
+ * so a value moved to another key fails to decrypt.
+ * Values without the magic are returned as they are, so an existing store can be encrypted
+ * progressively by the writes or at once by Reencrypt.
+ */
+type encryptedStore struct {
+	store    store.Store
+	provider KeyProvider
+
+	mu    sync.Mutex
+	aeads map[string]cipher.AEAD
+}
+
+/**
+ * encryptedTxStore seals the values of the versioned writes and the batches as well,
+ * the versions are the ones of the ciphertexts kept by the underlying store.
+ */
+type encryptedTxStore struct {
+	*encryptedStore
+	txStore store.TxStore
+}
+
+// NewEncryptedStore wraps s to encrypt the values under the keys of provider
+func NewEncryptedStore(s store.Store, provider KeyProvider) store.Store {
+	es := newEncryptedStore(s, provider)
+	if txStore, ok := s.(store.TxStore); ok {
+		return &encryptedTxStore{encryptedStore: es, txStore: txStore}
+	}
+	return es
+}
+
+func newEncryptedStore(s store.Store, provider KeyProvider) *encryptedStore {
+	return &encryptedStore{store: s, provider: provider, aeads: make(map[string]cipher.AEAD)}
+}
+
+func (s *encryptedStore) aead(keyID string, key []byte) (cipher.AEAD, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if aead, found := s.aeads[keyID]; found {
+		return aead, nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Annotatef(err, "key %s", keyID)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	s.aeads[keyID] = aead
+	return aead, nil
+}
+
+func additionalData(header []byte, prefix, key string) []byte {
+	ad := make([]byte, 0, len(header)+len(prefix)+len(key)+1)
+	ad = append(ad, header...)
+	ad = append(ad, prefix...)
+	ad = append(ad, 0)
+	return append(ad, key...)
+}
+
+func (s *encryptedStore) seal(ctx context.Context, prefix, key string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	keyID, k, err := s.provider.CurrentKey(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := validateKeyID(keyID); err != nil {
+		return nil, errors.Trace(err)
+	}
+	aead, err := s.aead(keyID, k)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	b := make([]byte, 0, len(magic)+2+len(keyID)+aead.NonceSize()+len(value)+aead.Overhead())
+	b = append(b, magic...)
+	b = append(b, headerVersion, byte(len(keyID)))
+	b = append(b, keyID...)
+	header := b
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Trace(err)
+	}
+	b = append(b, nonce...)
+	return aead.Seal(b, nonce, value, additionalData(header, prefix, key)), nil
+}
+
+/**
+ * parseHeader returns the key ID and the size of the header, found is false for the plaintext
+ */
+func parseHeader(value []byte) (keyID string, size int, found bool, err error) {
+	if !bytes.HasPrefix(value, magic) {
+		return "", 0, false, nil
+	}
+	if len(value) < len(magic)+2 {
+		return "", 0, true, errors.NotValidf("ciphertext header")
+	}
+	if value[len(magic)] != headerVersion {
+		return "", 0, true, errors.NotSupportedf("ciphertext version %d", value[len(magic)])
+	}
+	size = len(magic) + 2 + int(value[len(magic)+1])
+	if len(value) < size {
+		return "", 0, true, errors.NotValidf("ciphertext header")
+	}
+	return string(value[len(magic)+2 : size]), size, true, nil
+}
+
+func (s *encryptedStore) open(ctx context.Context, prefix, key string, value []byte) ([]byte, error) {
+	keyID, size, found, err := parseHeader(value)
+	if err != nil {
+		return nil, errors.Annotatef(err, "%s %s", prefix, key)
+	}
+	if !found {
+		return value, nil
+	}
+
+	k, err := s.provider.Key(ctx, keyID)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	aead, err := s.aead(keyID, k)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(value) < size+aead.NonceSize() {
+		return nil, errors.NotValidf("ciphertext of %s %s", prefix, key)
+	}
+	nonce := value[size : size+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, value[size+aead.NonceSize():], additionalData(value[:size], prefix, key))
+	if err != nil {
+		return nil, errors.Annotatef(err, "failed to decrypt %s %s", prefix, key)
+	}
+	return plaintext, nil
+}
+
+func (s *encryptedStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	value, err := s.store.Get(ctx, prefix, key)
+	if err != nil || value == nil {
+		return value, errors.Trace(err)
+	}
+	return s.open(ctx, prefix, key, value)
+}
+
+func (s *encryptedStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	sealed, err := s.seal(ctx, prefix, key, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.Set(ctx, prefix, key, sealed))
+}
+
+func (s *encryptedStore) Remove(ctx context.Context, prefix, key string) error {
+	return errors.Trace(s.store.Remove(ctx, prefix, key))
+}
+
+func (s *encryptedStore) List(ctx context.Context, prefix string, iterator func(key string) bool) error {
+	return errors.Trace(s.store.List(ctx, prefix, iterator))
+}
+
+func (s *encryptedStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	var openErr error
+	err := store.Scan(ctx, s.store, prefix, afterKey, func(key string, value []byte) bool {
+		plaintext, err := s.open(ctx, prefix, key, value)
+		if err != nil {
+			openErr = err
+			return false
+		}
+		return iterator(key, plaintext)
+	})
+	if openErr != nil {
+		return errors.Trace(openErr)
+	}
+	return errors.Trace(err)
+}
+
+func (s *encryptedStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	sealed, err := s.seal(ctx, prefix, key, value)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(s.store.Append(ctx, prefix, key, sealed))
+}
+
+func (s *encryptedStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	var openErr error
+	err := s.store.ListAppend(ctx, prefix, key, func(value []byte) bool {
+		plaintext, err := s.open(ctx, prefix, key, value)
+		if err != nil {
+			openErr = err
+			return false
+		}
+		return iterator(plaintext)
+	})
+	if openErr != nil {
+		return errors.Trace(openErr)
+	}
+	return errors.Trace(err)
+}
+
+// Flush flushes the underlying store if it buffers the writes, e.g. the write-back cache
+func (s *encryptedStore) Flush(ctx context.Context) error {
+	return errors.Trace(store.Flush(ctx, s.store))
+}
+
+// Close closes the underlying store if it is closable
+func (s *encryptedStore) Close() error {
+	if closer, ok := s.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *encryptedTxStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	value, version, err := s.txStore.GetVersion(ctx, prefix, key)
+	if err != nil || value == nil {
+		return value, version, errors.Trace(err)
+	}
+	plaintext, err := s.open(ctx, prefix, key, value)
+	if err != nil {
+		return nil, 0, errors.Trace(err)
+	}
+	return plaintext, version, nil
+}
+
+func (s *encryptedTxStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	sealed, err := s.seal(ctx, prefix, key, value)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	newVersion, err := s.txStore.CompareAndSet(ctx, prefix, key, sealed, version)
+	return newVersion, errors.Trace(err)
+}
+
+func (s *encryptedTxStore) Batch(ctx context.Context, ops []store.Op) error {
+	sealedOps := make([]store.Op, len(ops))
+	for i, op := range ops {
+		sealedOps[i] = op
+		if op.Type != store.OpSet {
+			continue
+		}
+		sealed, err := s.seal(ctx, op.Prefix, op.Key, op.Value)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		sealedOps[i].Value = sealed
+	}
+	return errors.Trace(s.txStore.Batch(ctx, sealedOps))
+}
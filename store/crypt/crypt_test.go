@@ -0,0 +1,260 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/cache"
+	"github.com/warriorguo/workflow/store/mem"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, 32)
+	key2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func newProvider(t *testing.T, currentKeyID string, keys map[string][]byte) KeyProvider {
+	provider, err := NewStaticKeyProvider(currentKeyID, keys)
+	assert.Nil(t, err)
+	return provider
+}
+
+func keyIDOf(t *testing.T, s store.Store, prefix, key string) string {
+	value, err := s.Get(context.Background(), prefix, key)
+	assert.Nil(t, err)
+	keyID, _, found, err := parseHeader(value)
+	assert.Nil(t, err)
+	if !found {
+		return ""
+	}
+	return keyID
+}
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+	_, ok := s.(store.TxStore)
+	assert.True(t, ok)
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte(`{"account":"123"}`)))
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"account":"123"}`), value)
+
+	raw, err := inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(raw, []byte("account")))
+	assert.Equal(t, "k1", keyIDOf(t, inner, "/test/", "key1"))
+
+	// keys stay plaintext
+	keys := make([]string, 0)
+	assert.Nil(t, s.List(ctx, "/test/", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	}))
+	assert.Equal(t, []string{"key1"}, keys)
+
+	scanned := make([]string, 0)
+	assert.Nil(t, s.(store.Scanner).Scan(ctx, "/test/", "", func(key string, value []byte) bool {
+		scanned = append(scanned, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{`{"account":"123"}`}, scanned)
+
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	values := make([]string, 0)
+	assert.Nil(t, s.ListAppend(ctx, "/history/", "req", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"a"}, values)
+
+	value, err = s.Get(ctx, "/test/", "non-existent")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+}
+
+func TestEncryptedStore_Tamper(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+
+	// a value moved to another key fails to decrypt
+	raw, err := inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Nil(t, inner.Set(ctx, "/test/", "key2", raw))
+	_, err = s.Get(ctx, "/test/", "key2")
+	assert.NotNil(t, err)
+
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1] ^= 0xff
+	assert.Nil(t, inner.Set(ctx, "/test/", "key1", tampered))
+	_, err = s.Get(ctx, "/test/", "key1")
+	assert.NotNil(t, err)
+}
+
+func TestEncryptedStore_Plaintext(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	assert.Nil(t, inner.Set(ctx, "/test/", "key1", []byte(`{"k":"v"}`)))
+
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(`{"k":"v"}`), value)
+}
+
+func TestEncryptedStore_TxStore(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1})).(store.TxStore)
+
+	version, err := s.CompareAndSet(ctx, "/test/", "key1", []byte("v1"), 0)
+	assert.Nil(t, err)
+	_, err = s.CompareAndSet(ctx, "/test/", "key1", []byte("v2"), 0)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+
+	value, v, err := s.GetVersion(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	assert.Equal(t, version, v)
+
+	assert.Nil(t, s.Batch(ctx, []store.Op{
+		store.SetOp("/test/", "key2", []byte("v2")),
+		store.RemoveOp("/test/", "key1"),
+	}))
+	value, err = s.(store.Store).Get(ctx, "/test/", "key2")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), value)
+	assert.Equal(t, "k1", keyIDOf(t, inner, "/test/", "key2"))
+}
+
+func TestReencrypt(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	assert.Nil(t, inner.Set(ctx, "/test/", "plain", []byte("p")))
+
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v1")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("b")))
+
+	// rotate to k2, the values under k1 are still readable
+	rotated := newProvider(t, "k2", map[string][]byte{"k1": key1, "k2": key2})
+	s = NewEncryptedStore(inner, rotated)
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("v2")))
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+
+	report, err := Reencrypt(ctx, inner, rotated, []string{"/test/"})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, report.Scanned)
+	assert.Equal(t, 2, report.Reencrypted)
+	report, err = ReencryptAppended(ctx, inner, rotated, "/history/", "req")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Reencrypted)
+
+	// k1 can be dropped now
+	s = NewEncryptedStore(inner, newProvider(t, "k2", map[string][]byte{"k2": key2}))
+	for key, expected := range map[string]string{"plain": "p", "key1": "v1", "key2": "v2"} {
+		value, err := s.Get(ctx, "/test/", key)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(value))
+		assert.Equal(t, "k2", keyIDOf(t, inner, "/test/", key))
+	}
+	values := make([]string, 0)
+	assert.Nil(t, s.ListAppend(ctx, "/history/", "req", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"a", "b"}, values)
+}
+
+func TestNewStaticKeyProvider(t *testing.T) {
+	_, err := NewStaticKeyProvider("k1", map[string][]byte{"k2": key2})
+	assert.True(t, errors.Is(err, errors.NotFound))
+	_, err = NewStaticKeyProvider("k1", map[string][]byte{"k1": []byte("short")})
+	assert.True(t, errors.Is(err, errors.NotValid))
+}
+
+func TestEncryptedStore_Flush(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	cached, err := cache.NewCachedStore(inner, &cache.Config{Mode: cache.WriteBack, FlushInterval: time.Hour, MaxPending: 100})
+	assert.Nil(t, err)
+	s := NewEncryptedStore(cached, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("v1")))
+	value, err := inner.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	// the buffered writes of the cache are flushed through the encrypted store
+	assert.Nil(t, store.Flush(ctx, s))
+	assert.Equal(t, "k1", keyIDOf(t, inner, "/test/", "key1"))
+	assert.Nil(t, s.(io.Closer).Close())
+}
+
+// appendFailStore fails the appends to the prefix until fail is reset
+type appendFailStore struct {
+	store.Store
+	prefix string
+	fail   bool
+}
+
+func (s *appendFailStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	if s.fail && prefix == s.prefix {
+		return errors.New("append failed")
+	}
+	return s.Store.Append(ctx, prefix, key, value)
+}
+
+func TestReencryptAppended_Resume(t *testing.T) {
+	ctx := context.Background()
+	inner := &appendFailStore{Store: mem.NewMemStore(), prefix: "/history/"}
+	s := NewEncryptedStore(inner, newProvider(t, "k1", map[string][]byte{"k1": key1}))
+	assert.Nil(t, s.Set(ctx, "/history/", "req", []byte("v")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("b")))
+
+	// fails after the original list removed
+	rotated := newProvider(t, "k2", map[string][]byte{"k1": key1, "k2": key2})
+	inner.fail = true
+	_, err := ReencryptAppended(ctx, inner, rotated, "/history/", "req")
+	assert.NotNil(t, err)
+
+	// finished from the staged copy
+	inner.fail = false
+	report, err := ReencryptAppended(ctx, inner, rotated, "/history/", "req")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Reencrypted)
+
+	// the value set is kept as it is
+	value, err := NewEncryptedStore(inner, rotated).Get(ctx, "/history/", "req")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", string(value))
+	s = NewEncryptedStore(inner, newProvider(t, "k2", map[string][]byte{"k2": key2}))
+	values := make([]string, 0)
+	assert.Nil(t, s.ListAppend(ctx, "/history/", "req", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"a", "b"}, values)
+
+	// the staged copy is removed
+	staged, err := inner.Get(ctx, ReencryptStagingPrefix+"/history/", "req")
+	assert.Nil(t, err)
+	assert.Nil(t, staged)
+	report, err = ReencryptAppended(ctx, inner, rotated, "/history/", "req")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Reencrypted)
+}
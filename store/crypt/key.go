@@ -0,0 +1,65 @@
+package crypt
+
+import (
+	"context"
+
+	"github.com/juju/errors"
+)
+
+/**
+ * KeyProvider supplies the AES keys, the key ID is saved in the header of every ciphertext,
+ * so that the values encrypted by the retired keys are still readable after the rotation.
+ */
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting the new values
+	CurrentKey(ctx context.Context) (keyID string, key []byte, err error)
+	// Key returns the key by its ID, or NotFound if the key is unknown
+	Key(ctx context.Context, keyID string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+/**
+ * NewStaticKeyProvider returns the provider holding the keys in memory, the keys should be 16, 24 or 32 bytes
+ * for AES-128, AES-192 or AES-256. Keep the retired keys in keys until the values are re-encrypted.
+ */
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) (KeyProvider, error) {
+	if _, found := keys[currentKeyID]; !found {
+		return nil, errors.NotFoundf("current key %s", currentKeyID)
+	}
+	p := &staticKeyProvider{currentKeyID: currentKeyID, keys: make(map[string][]byte, len(keys))}
+	for keyID, key := range keys {
+		if err := validateKeyID(keyID); err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, errors.NotValidf("key %s of %d bytes", keyID, len(key))
+		}
+		p.keys[keyID] = append([]byte(nil), key...)
+	}
+	return p, nil
+}
+
+func validateKeyID(keyID string) error {
+	if keyID == "" || len(keyID) > maxKeyIDSize {
+		return errors.NotValidf("key id %q", keyID)
+	}
+	return nil
+}
+
+func (p *staticKeyProvider) CurrentKey(ctx context.Context) (string, []byte, error) {
+	return p.currentKeyID, p.keys[p.currentKeyID], nil
+}
+
+func (p *staticKeyProvider) Key(ctx context.Context, keyID string) ([]byte, error) {
+	key, found := p.keys[keyID]
+	if !found {
+		return nil, errors.NotFoundf("key %s", keyID)
+	}
+	return key, nil
+}
@@ -0,0 +1,266 @@
+package crypt
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+)
+
+const (
+	maxReencryptRetry = 3
+	// ReencryptStagingPrefix followed by the prefix keeps the list re-encrypted by ReencryptAppended before it replaces the original
+	ReencryptStagingPrefix = "/reencrypt"
+)
+
+type ReencryptReport struct {
+	// Scanned is the amount of the values read
+	Scanned int
+	// Reencrypted is the amount of the values rewritten under the current key
+	Reencrypted int
+}
+
+/**
+ * needReencrypt tells whether the value is plaintext or encrypted by a key other than the current one
+ */
+func needReencrypt(value []byte, currentKeyID string) (bool, error) {
+	keyID, _, found, err := parseHeader(value)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return !found || keyID != currentKeyID, nil
+}
+
+/**
+ * Reencrypt rewrites the values under the prefixes with the current key of provider, including the plaintext ones,
+ * so that the retired keys can be dropped afterwards. s is the underlying store, NOT the encrypted one.
+ * The values are rewritten by CompareAndSet if s is a store.TxStore, so it is safe to run with the engines
+ * working, otherwise the engines should be stopped.
+ * The values appended are not listed by the prefixes, see ReencryptAppended.
+ */
+func Reencrypt(ctx context.Context, s store.Store, provider KeyProvider, prefixes []string) (*ReencryptReport, error) {
+	es := newEncryptedStore(s, provider)
+	report := &ReencryptReport{}
+	for _, prefix := range prefixes {
+		keys := make([]string, 0)
+		if err := s.List(ctx, prefix, func(key string) bool {
+			keys = append(keys, key)
+			return true
+		}); err != nil {
+			return report, errors.Trace(err)
+		}
+
+		for _, key := range keys {
+			if err := ctx.Err(); err != nil {
+				return report, errors.Trace(err)
+			}
+			reencrypted, err := es.reencrypt(ctx, prefix, key)
+			if err != nil {
+				return report, errors.Annotatef(err, "failed to re-encrypt %s %s", prefix, key)
+			}
+			report.Scanned++
+			if reencrypted {
+				report.Reencrypted++
+			}
+		}
+	}
+	return report, nil
+}
+
+func (s *encryptedStore) reencrypt(ctx context.Context, prefix, key string) (bool, error) {
+	currentKeyID, _, err := s.provider.CurrentKey(ctx)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+
+	txStore, ok := s.store.(store.TxStore)
+	if !ok {
+		value, err := s.store.Get(ctx, prefix, key)
+		if err != nil || value == nil {
+			return false, errors.Trace(err)
+		}
+		if need, err := needReencrypt(value, currentKeyID); err != nil || !need {
+			return false, errors.Trace(err)
+		}
+		plaintext, err := s.open(ctx, prefix, key, value)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		return true, errors.Trace(s.Set(ctx, prefix, key, plaintext))
+	}
+
+	for i := 0; i < maxReencryptRetry; i++ {
+		value, version, err := txStore.GetVersion(ctx, prefix, key)
+		if err != nil || value == nil {
+			return false, errors.Trace(err)
+		}
+		if need, err := needReencrypt(value, currentKeyID); err != nil || !need {
+			return false, errors.Trace(err)
+		}
+		plaintext, err := s.open(ctx, prefix, key, value)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		sealed, err := s.seal(ctx, prefix, key, plaintext)
+		if err != nil {
+			return false, errors.Trace(err)
+		}
+		_, err = txStore.CompareAndSet(ctx, prefix, key, sealed, version)
+		if errors.Is(err, store.ErrVersionConflict) {
+			// rewritten in the meantime, check it again
+			continue
+		}
+		return err == nil, errors.Trace(err)
+	}
+	return false, errors.Trace(store.ErrVersionConflict)
+}
+
+/**
+ * stagedList is set to the staging key once the list re-encrypted is appended to it completely
+ */
+type stagedList struct {
+	// the value set to the key along with the list, nil if none
+	Value []byte `json:",omitempty"`
+	Count int
+}
+
+func stagingPrefix(prefix string) string {
+	return ReencryptStagingPrefix + prefix
+}
+
+/**
+ * ReencryptAppended rewrites the values appended to the prefix and key with the current key of provider.
+ * The store has no way to replace the appended values in place, so the list re-encrypted is staged
+ * under ReencryptStagingPrefix first, then it replaces the original list along with the value set to the same key.
+ * If it fails in the middle of replacing, the next call with the same prefix and key finishes it from the staged copy,
+ * so nothing is lost. The engines must be stopped during it.
+ */
+func ReencryptAppended(ctx context.Context, s store.Store, provider KeyProvider, prefix, key string) (*ReencryptReport, error) {
+	es := newEncryptedStore(s, provider)
+	currentKeyID, _, err := provider.CurrentKey(ctx)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+
+	report := &ReencryptReport{}
+	staged, err := loadStagedList(ctx, s, prefix, key)
+	if err != nil {
+		return report, errors.Trace(err)
+	}
+	if staged != nil {
+		// the previous call failed while replacing
+		err = replaceWithStaged(ctx, s, prefix, key, staged)
+		if err == nil {
+			report.Scanned, report.Reencrypted = staged.Count, staged.Count
+		}
+		return report, errors.Trace(err)
+	}
+
+	values := make([][]byte, 0)
+	need := false
+	var iterErr error
+	if err := s.ListAppend(ctx, prefix, key, func(value []byte) bool {
+		report.Scanned++
+		n, err := needReencrypt(value, currentKeyID)
+		if err != nil {
+			iterErr = err
+			return false
+		}
+		need = need || n
+		values = append(values, value)
+		return true
+	}); err != nil {
+		return report, errors.Trace(err)
+	}
+	if iterErr != nil {
+		return report, errors.Trace(iterErr)
+	}
+	if !need {
+		return report, nil
+	}
+
+	// re-encrypt all ahead so that nothing is touched if any value is unreadable
+	sealed := make([][]byte, len(values))
+	for i, value := range values {
+		plaintext, err := es.open(ctx, prefix, key, value)
+		if err != nil {
+			return report, errors.Trace(err)
+		}
+		if sealed[i], err = es.seal(ctx, prefix, key, plaintext); err != nil {
+			return report, errors.Trace(err)
+		}
+	}
+	setValue, err := s.Get(ctx, prefix, key)
+	if err != nil {
+		return report, errors.Trace(err)
+	}
+
+	// the values staged by a call failed before completing are dropped
+	if err := s.Remove(ctx, stagingPrefix(prefix), key); err != nil {
+		return report, errors.Trace(err)
+	}
+	for _, value := range sealed {
+		if err := s.Append(ctx, stagingPrefix(prefix), key, value); err != nil {
+			return report, errors.Trace(err)
+		}
+	}
+	staged = &stagedList{Value: setValue, Count: len(sealed)}
+	b, err := json.Marshal(staged)
+	if err != nil {
+		return report, errors.Trace(err)
+	}
+	if err := s.Set(ctx, stagingPrefix(prefix), key, b); err != nil {
+		return report, errors.Trace(err)
+	}
+
+	if err := replaceWithStaged(ctx, s, prefix, key, staged); err != nil {
+		return report, errors.Trace(err)
+	}
+	report.Reencrypted = len(sealed)
+	return report, nil
+}
+
+func loadStagedList(ctx context.Context, s store.Store, prefix, key string) (*stagedList, error) {
+	b, err := s.Get(ctx, stagingPrefix(prefix), key)
+	if err != nil || b == nil {
+		return nil, errors.Trace(err)
+	}
+	staged := &stagedList{}
+	if err := json.Unmarshal(b, staged); err != nil {
+		return nil, errors.Annotatef(err, "staged list of %s %s", prefix, key)
+	}
+	return staged, nil
+}
+
+/**
+ * replaceWithStaged replaces the list and the value set of the key with the staged ones, then removes the staged,
+ * it can be called again until it succeeds.
+ */
+func replaceWithStaged(ctx context.Context, s store.Store, prefix, key string, staged *stagedList) error {
+	values := make([][]byte, 0, staged.Count)
+	if err := s.ListAppend(ctx, stagingPrefix(prefix), key, func(value []byte) bool {
+		values = append(values, value)
+		return true
+	}); err != nil {
+		return errors.Trace(err)
+	}
+	if len(values) != staged.Count {
+		return errors.NotValidf("staged list of %s %s has %d values, expected %d", prefix, key, len(values), staged.Count)
+	}
+
+	if err := s.Remove(ctx, prefix, key); err != nil {
+		return errors.Trace(err)
+	}
+	if staged.Value != nil {
+		if err := s.Set(ctx, prefix, key, staged.Value); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for _, value := range values {
+		if err := s.Append(ctx, prefix, key, value); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return errors.Trace(s.Remove(ctx, stagingPrefix(prefix), key))
+}
@@ -0,0 +1,698 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+)
+
+var (
+	_ store.Store   = &fileStore{}
+	_ store.Scanner = &fileStore{}
+	_ store.TxStore = &fileStore{}
+)
+
+const (
+	ErrClosed = errors.ConstError("file store closed")
+)
+
+const (
+	snapshotFile    = "snapshot"
+	snapshotTmpFile = "snapshot.tmp"
+	walFilePrefix   = "wal-"
+	walFileSuffix   = ".log"
+)
+
+// SyncPolicy decides when the log is flushed to the disk
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes the log before every write returns, nothing acknowledged is lost on a crash
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes the log every SyncInterval, the writes within the interval may be lost on a crash
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves the flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+// Config holds the file store configuration
+type Config struct {
+	// Dir is the directory of the snapshot and the log files, it is created if not exists
+	Dir        string
+	SyncPolicy SyncPolicy
+	// SyncInterval only works with SyncInterval policy
+	SyncInterval time.Duration
+	// CompactThreshold is the log size in bytes triggering a snapshot
+	CompactThreshold int64
+	// SnapshotInterval is the interval of the periodic snapshot, 0 disables it
+	SnapshotInterval time.Duration
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Dir:              "workflow-data",
+		SyncPolicy:       SyncAlways,
+		SyncInterval:     time.Second,
+		CompactThreshold: 64 << 20,
+		SnapshotInterval: 10 * time.Minute,
+	}
+}
+
+// Validate validates the configuration, the zero values are set to the defaults
+func (c *Config) Validate() error {
+	if c.Dir == "" {
+		return errors.New("dir cannot be empty")
+	}
+	defaults := DefaultConfig()
+	if c.SyncPolicy == "" {
+		c.SyncPolicy = defaults.SyncPolicy
+	}
+	switch c.SyncPolicy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return errors.Errorf("invalid sync policy: %s", c.SyncPolicy)
+	}
+	if c.SyncInterval <= 0 {
+		c.SyncInterval = defaults.SyncInterval
+	}
+	if c.CompactThreshold <= 0 {
+		c.CompactThreshold = defaults.CompactThreshold
+	}
+	if c.SnapshotInterval < 0 {
+		return errors.New("snapshot interval cannot be negative")
+	}
+	return nil
+}
+
+/**
+ * fileStore is the store implementation on the local files for the single node deployments.
+ * The whole content is kept in memory, every write is appended to the write-ahead log before
+ * taking effect, and the log is compacted into a snapshot once it grows over the threshold.
+ * The log is split into generations, a snapshot covers the generations before the one it records,
+ * so a crash during the compaction never applies a log twice.
+ */
+type fileStore struct {
+	config *Config
+
+	mu    sync.Mutex
+	state *state
+
+	wal     *os.File
+	walGen  int64
+	walSize int64
+	// dirty indicates the log has writes not flushed
+	dirty bool
+	// broken is the failure leaving the log in an unknown state, the store refuses to write after it
+	broken error
+	closed bool
+
+	// compactMu serializes the compactions
+	compactMu sync.Mutex
+	compactCh chan struct{}
+	exitCh    chan struct{}
+	stopOnce  sync.Once
+	loopWg    sync.WaitGroup
+}
+
+// NewFileStore opens the file store in config.Dir, recovering the content from the snapshot and the log
+func NewFileStore(config *Config) (store.Store, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	c := *config
+	if err := c.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return nil, errors.Annotatef(err, "failed to create dir %s", c.Dir)
+	}
+
+	s := &fileStore{
+		config:    &c,
+		state:     newState(),
+		compactCh: make(chan struct{}, 1),
+		exitCh:    make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		return nil, errors.Annotatef(err, "failed to recover from %s", c.Dir)
+	}
+
+	s.loopWg.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+func walFileName(gen int64) string {
+	return fmt.Sprintf("%s%016d%s", walFilePrefix, gen, walFileSuffix)
+}
+
+/**
+ * walGens returns the generations of the log files in dir in order
+ */
+func walGens(dir string) ([]int64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	gens := make([]int64, 0)
+	for _, e := range entries {
+		name, found := strings.CutPrefix(e.Name(), walFilePrefix)
+		if !found || !strings.HasSuffix(name, walFileSuffix) {
+			continue
+		}
+		var gen int64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name, walFileSuffix), "%d", &gen); err != nil {
+			continue
+		}
+		gens = append(gens, gen)
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+	return gens, nil
+}
+
+/**
+ * recover loads the snapshot and replays the logs of the later generations,
+ * a torn write at the end of the last log is truncated, while a broken frame
+ * anywhere else means corruption and fails the recovery.
+ */
+func (s *fileStore) recover() error {
+	gen, err := s.loadSnapshot()
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	gens, err := walGens(s.config.Dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	replay := make([]int64, 0, len(gens))
+	for _, g := range gens {
+		if g < gen {
+			// left by a compaction interrupted after the snapshot was saved
+			if err := os.Remove(filepath.Join(s.config.Dir, walFileName(g))); err != nil {
+				return errors.Trace(err)
+			}
+			continue
+		}
+		replay = append(replay, g)
+	}
+
+	for i, g := range replay {
+		last := i == len(replay)-1
+		if err := s.replayWAL(g, last); err != nil {
+			return errors.Annotatef(err, "failed to replay %s", walFileName(g))
+		}
+	}
+
+	if len(replay) > 0 {
+		gen = replay[len(replay)-1]
+	}
+	return errors.Trace(s.openWAL(gen))
+}
+
+/**
+ * loadSnapshot returns the first log generation not covered by the snapshot, 0 if no snapshot
+ */
+func (s *fileStore) loadSnapshot() (int64, error) {
+	f, err := os.Open(filepath.Join(s.config.Dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	defer f.Close()
+
+	var gen int64
+	first := true
+	_, broken, err := readFrames(f, func(r *record) error {
+		if first {
+			if r.Type != recordSnapshot {
+				return errors.NotValidf("snapshot header type %d", r.Type)
+			}
+			first = false
+			gen = r.Gen
+		}
+		s.state.apply(r)
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	// the snapshot is flushed before being renamed into place, so it is never torn
+	if broken || first {
+		return 0, errors.NotValidf("snapshot %s", filepath.Join(s.config.Dir, snapshotFile))
+	}
+	return gen, nil
+}
+
+func (s *fileStore) replayWAL(gen int64, last bool) error {
+	path := filepath.Join(s.config.Dir, walFileName(gen))
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	size, broken, err := readFrames(f, func(r *record) error {
+		s.state.apply(r)
+		return nil
+	})
+	f.Close()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if !broken {
+		return nil
+	}
+	if !last {
+		return errors.NotValidf("broken frame at %d of %s", size, path)
+	}
+	return errors.Trace(os.Truncate(path, size))
+}
+
+func (s *fileStore) openWAL(gen int64) error {
+	f, err := os.OpenFile(filepath.Join(s.config.Dir, walFileName(gen)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	if err := syncDir(s.config.Dir); err != nil {
+		f.Close()
+		return errors.Trace(err)
+	}
+	s.wal, s.walGen, s.walSize = f, gen, info.Size()
+	return nil
+}
+
+/**
+ * syncDir flushes the directory so that the created and renamed files survive a crash
+ */
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer d.Close()
+	return errors.Trace(d.Sync())
+}
+
+/**
+ * write appends the record to the log and applies it, the caller holds s.mu
+ */
+func (s *fileStore) write(r *record) error {
+	if s.closed {
+		return ErrClosed
+	}
+	if s.broken != nil {
+		return errors.Annotatef(s.broken, "file store is broken")
+	}
+
+	frame := appendFrame(nil, r)
+	if _, err := s.wal.Write(frame); err != nil {
+		// drop the partial frame, otherwise the later writes are lost with it on recovery
+		if terr := s.wal.Truncate(s.walSize); terr != nil {
+			s.broken = terr
+		}
+		return errors.Annotatef(err, "failed to write log")
+	}
+	s.walSize += int64(len(frame))
+
+	if s.config.SyncPolicy == SyncAlways {
+		if err := s.wal.Sync(); err != nil {
+			// the written pages may be dropped, nothing is known about the log any more
+			s.broken = err
+			return errors.Annotatef(err, "failed to sync log")
+		}
+	} else {
+		s.dirty = true
+	}
+	s.state.apply(r)
+
+	if s.walSize >= s.config.CompactThreshold {
+		select {
+		case s.compactCh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrClosed
+	}
+	if e := s.state.get(prefix, key); e != nil {
+		return e.value, nil
+	}
+	return nil, nil
+}
+
+func (s *fileStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(&record{Type: recordSet, Prefix: prefix, Key: key, Value: copyBytes(value), Version: s.state.seq + 1})
+}
+
+func copyBytes(p []byte) []byte {
+	if p == nil {
+		return nil
+	}
+	c := make([]byte, len(p))
+	copy(c, p)
+	return c
+}
+
+func (s *fileStore) Remove(ctx context.Context, prefix, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if !s.state.exists(prefix, key) {
+		return nil
+	}
+	return s.write(&record{Type: recordRemove, Prefix: prefix, Key: key})
+}
+
+func (s *fileStore) List(ctx context.Context, prefix string, iterator func(key string) bool) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	keys := make([]string, 0, len(s.state.kv[prefix]))
+	for key := range s.state.kv[prefix] {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range keys {
+		if !iterator(key) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	keys := s.state.sortedKeys(prefix, afterKey)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = s.state.get(prefix, key).value
+	}
+	s.mu.Unlock()
+
+	for i, key := range keys {
+		if !iterator(key, values[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.write(&record{Type: recordAppend, Prefix: prefix, Key: key, Value: copyBytes(value)})
+}
+
+func (s *fileStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	values := s.state.appended[appendKey{prefix, key}]
+	s.mu.Unlock()
+
+	// appending never modifies the existing elements, so it is safe to iterate without lock
+	for _, value := range values {
+		if !iterator(value) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *fileStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, 0, ErrClosed
+	}
+	if e := s.state.get(prefix, key); e != nil {
+		return e.value, e.version, nil
+	}
+	return nil, 0, nil
+}
+
+func (s *fileStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	if s.state.version(prefix, key) != version {
+		return 0, store.ErrVersionConflict
+	}
+	r := &record{Type: recordSet, Prefix: prefix, Key: key, Value: copyBytes(value), Version: s.state.seq + 1}
+	if err := s.write(r); err != nil {
+		return 0, errors.Trace(err)
+	}
+	return r.Version, nil
+}
+
+/**
+ * Batch writes the ops as a single record, so that they are recovered all or none
+ */
+func (s *fileStore) Batch(ctx context.Context, ops []store.Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	batch := &record{Type: recordBatch, Ops: make([]*record, 0, len(ops))}
+	seq := s.state.seq
+	for _, op := range ops {
+		if op.Version != 0 && s.state.version(op.Prefix, op.Key) != op.Version {
+			return store.ErrVersionConflict
+		}
+		switch op.Type {
+		case store.OpSet:
+			seq++
+			batch.Ops = append(batch.Ops, &record{Type: recordSet, Prefix: op.Prefix, Key: op.Key, Value: copyBytes(op.Value), Version: seq})
+		case store.OpRemove:
+			batch.Ops = append(batch.Ops, &record{Type: recordRemove, Prefix: op.Prefix, Key: op.Key})
+		default:
+			return errors.NotSupportedf("op type %d", op.Type)
+		}
+	}
+	return errors.Trace(s.write(batch))
+}
+
+/**
+ * Compact saves the content into a new snapshot and removes the logs it covers.
+ * The writes go on during the snapshot, they are logged into the next generation.
+ */
+func (s *fileStore) Compact() error {
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	gen := s.walGen + 1
+	if err := s.rotate(gen); err != nil {
+		s.mu.Unlock()
+		return errors.Trace(err)
+	}
+	snapshot := s.state.clone()
+	s.mu.Unlock()
+
+	if err := s.saveSnapshot(snapshot, gen); err != nil {
+		return errors.Trace(err)
+	}
+
+	gens, err := walGens(s.config.Dir)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, g := range gens {
+		if g >= gen {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.config.Dir, walFileName(g))); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+/**
+ * rotate switches the writes to the log of gen, the caller holds s.mu
+ */
+func (s *fileStore) rotate(gen int64) error {
+	old := s.wal
+	if err := old.Sync(); err != nil {
+		s.broken = err
+		return errors.Annotatef(err, "failed to sync log")
+	}
+	if err := s.openWAL(gen); err != nil {
+		return errors.Trace(err)
+	}
+	s.dirty = false
+	return errors.Trace(old.Close())
+}
+
+func (s *fileStore) saveSnapshot(snapshot *state, gen int64) error {
+	tmpPath := filepath.Join(s.config.Dir, snapshotTmpFile)
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	buf := make([]byte, 0, 64<<10)
+	err = snapshot.records(gen, func(r *record) error {
+		buf = appendFrame(buf, r)
+		if len(buf) < 64<<10 {
+			return nil
+		}
+		_, err := f.Write(buf)
+		buf = buf[:0]
+		return err
+	})
+	if err == nil {
+		_, err = f.Write(buf)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return errors.Annotatef(err, "failed to write snapshot")
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(s.config.Dir, snapshotFile)); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(syncDir(s.config.Dir))
+}
+
+// Sync flushes the log to the disk
+func (s *fileStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+	return errors.Trace(s.sync())
+}
+
+// sync assumes the caller holds s.mu
+func (s *fileStore) sync() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.wal.Sync(); err != nil {
+		s.broken = err
+		return errors.Annotatef(err, "failed to sync log")
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *fileStore) loop() {
+	defer s.loopWg.Done()
+
+	var syncC <-chan time.Time
+	if s.config.SyncPolicy == SyncInterval {
+		ticker := time.NewTicker(s.config.SyncInterval)
+		defer ticker.Stop()
+		syncC = ticker.C
+	}
+	var snapshotC <-chan time.Time
+	if s.config.SnapshotInterval > 0 {
+		ticker := time.NewTicker(s.config.SnapshotInterval)
+		defer ticker.Stop()
+		snapshotC = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.exitCh:
+			return
+		case <-syncC:
+			// the error is kept in s.broken and returned by the next write
+			s.Sync()
+		case <-snapshotC:
+			s.mu.Lock()
+			grown := s.walSize > 0
+			s.mu.Unlock()
+			if grown {
+				s.Compact()
+			}
+		case <-s.compactCh:
+			s.Compact()
+		}
+	}
+}
+
+// Close stops the background flushing and compaction, and flushes the log
+func (s *fileStore) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.exitCh)
+	})
+	s.loopWg.Wait()
+
+	// wait for the compaction called by others
+	s.compactMu.Lock()
+	defer s.compactMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	err := s.sync()
+	if cerr := s.wal.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Trace(err)
+}
@@ -0,0 +1,263 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+)
+
+func openTestStore(t *testing.T, dir string) *fileStore {
+	config := DefaultConfig()
+	config.Dir = dir
+	s, err := NewFileStore(config)
+	assert.Nil(t, err)
+	return s.(*fileStore)
+}
+
+func listKeys(t *testing.T, s store.Store, prefix string) []string {
+	keys := make([]string, 0)
+	assert.Nil(t, s.List(context.Background(), prefix, func(key string) bool {
+		keys = append(keys, key)
+		return true
+	}))
+	sort.Strings(keys)
+	return keys
+}
+
+func listAppended(t *testing.T, s store.Store, prefix, key string) []string {
+	values := make([]string, 0)
+	assert.Nil(t, s.ListAppend(context.Background(), prefix, key, func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	}))
+	return values
+}
+
+func TestFileStore_Operations(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t, t.TempDir())
+	defer s.Close()
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("value2")))
+	assert.Nil(t, s.Set(ctx, "/test/sub/", "key3", []byte("value3")))
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("updated")))
+
+	value, err := s.Get(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("updated"), value)
+	value, err = s.Get(ctx, "/test/", "non-existent")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	// the prefix matches exactly
+	assert.Equal(t, []string{"key1", "key2"}, listKeys(t, s, "/test/"))
+	assert.Equal(t, []string{"key3"}, listKeys(t, s, "/test/sub/"))
+	assert.Equal(t, []string{}, listKeys(t, s, "/none/"))
+
+	scanned := make([]string, 0)
+	assert.Nil(t, s.Scan(ctx, "/test/", "key1", func(key string, value []byte) bool {
+		scanned = append(scanned, key+"="+string(value))
+		return true
+	}))
+	assert.Equal(t, []string{"key2=value2"}, scanned)
+
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("b")))
+	assert.Equal(t, []string{"a", "b"}, listAppended(t, s, "/history/", "req"))
+
+	assert.Nil(t, s.Remove(ctx, "/test/", "key1"))
+	assert.Nil(t, s.Remove(ctx, "/test/", "non-existent"))
+	assert.Nil(t, s.Remove(ctx, "/history/", "req"))
+	assert.Equal(t, []string{"key2"}, listKeys(t, s, "/test/"))
+	assert.Equal(t, []string{}, listAppended(t, s, "/history/", "req"))
+}
+
+func TestFileStore_Recover(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStore(t, dir)
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("value2")))
+	assert.Nil(t, s.Remove(ctx, "/test/", "key2"))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	_, version, err := s.GetVersion(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Nil(t, s.Close())
+
+	_, err = s.Get(ctx, "/test/", "key1")
+	assert.Equal(t, ErrClosed, err)
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	value, v, err := s.GetVersion(ctx, "/test/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	assert.Equal(t, version, v)
+	assert.Equal(t, []string{"key1"}, listKeys(t, s, "/test/"))
+	assert.Equal(t, []string{"a"}, listAppended(t, s, "/history/", "req"))
+
+	// the version of the removed key is not reused
+	newVersion, err := s.CompareAndSet(ctx, "/test/", "key2", []byte("again"), 0)
+	assert.Nil(t, err)
+	assert.True(t, newVersion > version+1)
+}
+
+func TestFileStore_TornWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStore(t, dir)
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+	assert.Nil(t, s.Batch(ctx, []store.Op{
+		store.SetOp("/test/", "key2", []byte("value2")),
+		store.RemoveOp("/test/", "key1"),
+	}))
+	walPath := filepath.Join(dir, walFileName(s.walGen))
+	assert.Nil(t, s.Close())
+
+	// cut the batch in the middle, as if the machine crashed during writing
+	info, err := os.Stat(walPath)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(walPath, info.Size()-5))
+
+	s = openTestStore(t, dir)
+	assert.Equal(t, []string{"key1"}, listKeys(t, s, "/test/"))
+
+	// the torn frame is dropped, so the later writes are recovered
+	assert.Nil(t, s.Set(ctx, "/test/", "key3", []byte("value3")))
+	assert.Nil(t, s.Close())
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	assert.Equal(t, []string{"key1", "key3"}, listKeys(t, s, "/test/"))
+}
+
+func TestFileStore_CorruptedFrame(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStore(t, dir)
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("value2")))
+	walPath := filepath.Join(dir, walFileName(s.walGen))
+	assert.Nil(t, s.Close())
+
+	b, err := os.ReadFile(walPath)
+	assert.Nil(t, err)
+	b[len(b)-1] ^= 0xff
+	assert.Nil(t, os.WriteFile(walPath, b, 0o644))
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	assert.Equal(t, []string{"key1"}, listKeys(t, s, "/test/"))
+}
+
+func TestFileStore_Compact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStore(t, dir)
+	assert.Nil(t, s.Set(ctx, "/test/", "key1", []byte("value1")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	assert.Nil(t, s.Compact())
+
+	gens, err := walGens(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{s.walGen}, gens)
+
+	assert.Nil(t, s.Set(ctx, "/test/", "key2", []byte("value2")))
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("b")))
+	assert.Nil(t, s.Close())
+
+	s = openTestStore(t, dir)
+	assert.Equal(t, []string{"key1", "key2"}, listKeys(t, s, "/test/"))
+	assert.Equal(t, []string{"a", "b"}, listAppended(t, s, "/history/", "req"))
+	assert.Nil(t, s.Close())
+}
+
+func TestFileStore_InterruptedCompact(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := openTestStore(t, dir)
+	assert.Nil(t, s.Append(ctx, "/history/", "req", []byte("a")))
+	oldWAL := filepath.Join(dir, walFileName(s.walGen))
+	b, err := os.ReadFile(oldWAL)
+	assert.Nil(t, err)
+	assert.Nil(t, s.Compact())
+	assert.Nil(t, s.Close())
+
+	// the old log is left as if the compaction crashed before removing it
+	assert.Nil(t, os.WriteFile(oldWAL, b, 0o644))
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	assert.Equal(t, []string{"a"}, listAppended(t, s, "/history/", "req"))
+	_, err = os.Stat(oldWAL)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileStore_CompactThreshold(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	config := DefaultConfig()
+	config.Dir = dir
+	config.SyncPolicy = SyncNever
+	config.CompactThreshold = 1024
+	fs, err := NewFileStore(config)
+	assert.Nil(t, err)
+	s := fs.(*fileStore)
+
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, s.Set(ctx, "/test/", "key", make([]byte, 100)))
+	}
+	// compacted in the background
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, snapshotFile))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, s.Close())
+
+	s = openTestStore(t, dir)
+	defer s.Close()
+	assert.Equal(t, []string{"key"}, listKeys(t, s, "/test/"))
+}
+
+func TestFileStore_CompareAndSet(t *testing.T) {
+	ctx := context.Background()
+	s := openTestStore(t, t.TempDir())
+	defer s.Close()
+
+	version, err := s.CompareAndSet(ctx, "/test/", "key", []byte("v1"), 0)
+	assert.Nil(t, err)
+	_, err = s.CompareAndSet(ctx, "/test/", "key", []byte("v2"), 0)
+	assert.Equal(t, store.ErrVersionConflict, err)
+	_, err = s.CompareAndSet(ctx, "/test/", "key", []byte("v2"), version)
+	assert.Nil(t, err)
+
+	err = s.Batch(ctx, []store.Op{
+		store.SetOp("/test/", "other", []byte("v")),
+		{Type: store.OpRemove, Prefix: "/test/", Key: "key", Version: version},
+	})
+	assert.Equal(t, store.ErrVersionConflict, err)
+	assert.Equal(t, []string{"key"}, listKeys(t, s, "/test/"))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := &Config{Dir: "data"}
+	assert.Nil(t, config.Validate())
+	assert.Equal(t, SyncAlways, config.SyncPolicy)
+	assert.Equal(t, DefaultConfig().CompactThreshold, config.CompactThreshold)
+
+	assert.NotNil(t, (&Config{}).Validate())
+	assert.NotNil(t, (&Config{Dir: "data", SyncPolicy: "sometimes"}).Validate())
+}
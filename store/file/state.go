@@ -0,0 +1,139 @@
+package file
+
+import (
+	"sort"
+)
+
+type entry struct {
+	value   []byte
+	version int64
+}
+
+type appendKey struct {
+	prefix string
+	key    string
+}
+
+/**
+ * state is the content of the store in memory, it is rebuilt from the snapshot and the log on open.
+ * The values are never modified in place, so a shallow copy is enough to snapshot it.
+ */
+type state struct {
+	kv       map[string]map[string]*entry
+	appended map[appendKey][][]byte
+	// seq is the last assigned version, versions are never reused
+	seq int64
+}
+
+func newState() *state {
+	return &state{
+		kv:       make(map[string]map[string]*entry),
+		appended: make(map[appendKey][][]byte),
+	}
+}
+
+func (s *state) get(prefix, key string) *entry {
+	return s.kv[prefix][key]
+}
+
+func (s *state) exists(prefix, key string) bool {
+	if s.get(prefix, key) != nil {
+		return true
+	}
+	_, ok := s.appended[appendKey{prefix, key}]
+	return ok
+}
+
+func (s *state) version(prefix, key string) int64 {
+	if e := s.get(prefix, key); e != nil {
+		return e.version
+	}
+	return 0
+}
+
+func (s *state) apply(r *record) {
+	switch r.Type {
+	case recordSet:
+		keys, ok := s.kv[r.Prefix]
+		if !ok {
+			keys = make(map[string]*entry)
+			s.kv[r.Prefix] = keys
+		}
+		keys[r.Key] = &entry{value: r.Value, version: r.Version}
+		if r.Version > s.seq {
+			s.seq = r.Version
+		}
+	case recordRemove:
+		if keys, ok := s.kv[r.Prefix]; ok {
+			delete(keys, r.Key)
+			if len(keys) == 0 {
+				delete(s.kv, r.Prefix)
+			}
+		}
+		delete(s.appended, appendKey{r.Prefix, r.Key})
+	case recordAppend:
+		k := appendKey{r.Prefix, r.Key}
+		s.appended[k] = append(s.appended[k], r.Value)
+	case recordBatch:
+		for _, op := range r.Ops {
+			s.apply(op)
+		}
+	case recordSnapshot:
+		s.seq = r.Seq
+	}
+}
+
+func (s *state) clone() *state {
+	c := &state{
+		kv:       make(map[string]map[string]*entry, len(s.kv)),
+		appended: make(map[appendKey][][]byte, len(s.appended)),
+		seq:      s.seq,
+	}
+	for prefix, keys := range s.kv {
+		ck := make(map[string]*entry, len(keys))
+		for key, e := range keys {
+			ck[key] = e
+		}
+		c.kv[prefix] = ck
+	}
+	for k, values := range s.appended {
+		// appending later never changes the elements within the length
+		c.appended[k] = values[:len(values):len(values)]
+	}
+	return c
+}
+
+/**
+ * records returns the records rebuilding the state, headed by the snapshot record of gen.
+ */
+func (s *state) records(gen int64, fn func(r *record) error) error {
+	if err := fn(&record{Type: recordSnapshot, Gen: gen, Seq: s.seq}); err != nil {
+		return err
+	}
+	for prefix, keys := range s.kv {
+		for key, e := range keys {
+			if err := fn(&record{Type: recordSet, Prefix: prefix, Key: key, Value: e.value, Version: e.version}); err != nil {
+				return err
+			}
+		}
+	}
+	for k, values := range s.appended {
+		for _, value := range values {
+			if err := fn(&record{Type: recordAppend, Prefix: k.prefix, Key: k.key, Value: value}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *state) sortedKeys(prefix, afterKey string) []string {
+	keys := make([]string, 0, len(s.kv[prefix]))
+	for key := range s.kv[prefix] {
+		if key > afterKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,247 @@
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/juju/errors"
+)
+
+type recordType byte
+
+const (
+	recordSet      recordType = 1
+	recordRemove   recordType = 2
+	recordAppend   recordType = 3
+	recordBatch    recordType = 4
+	recordSnapshot recordType = 5
+)
+
+const (
+	// frameHeaderSize is the size of the payload length and the checksum ahead of every payload
+	frameHeaderSize = 8
+	// maxPayloadSize guards the recovery from allocating by a corrupted length
+	maxPayloadSize = 1 << 30
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+/**
+ * record is the unit of the log and the snapshot.
+ * A batch record carries its ops in Ops, it is applied entirely or not at all.
+ * A snapshot record heads the snapshot file, Gen is the first log generation not included in it.
+ */
+type record struct {
+	Type    recordType
+	Prefix  string
+	Key     string
+	Value   []byte
+	Version int64
+
+	Ops []*record
+
+	Gen int64
+	Seq int64
+}
+
+func (r *record) encode(b []byte) []byte {
+	b = append(b, byte(r.Type))
+	switch r.Type {
+	case recordSet:
+		b = binary.AppendVarint(b, r.Version)
+		b = appendBytes(b, []byte(r.Prefix))
+		b = appendBytes(b, []byte(r.Key))
+		b = appendBytes(b, r.Value)
+	case recordRemove:
+		b = appendBytes(b, []byte(r.Prefix))
+		b = appendBytes(b, []byte(r.Key))
+	case recordAppend:
+		b = appendBytes(b, []byte(r.Prefix))
+		b = appendBytes(b, []byte(r.Key))
+		b = appendBytes(b, r.Value)
+	case recordBatch:
+		b = binary.AppendUvarint(b, uint64(len(r.Ops)))
+		for _, op := range r.Ops {
+			b = op.encode(b)
+		}
+	case recordSnapshot:
+		b = binary.AppendVarint(b, r.Gen)
+		b = binary.AppendVarint(b, r.Seq)
+	}
+	return b
+}
+
+func appendBytes(b []byte, p []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(p)))
+	return append(b, p...)
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	if len(d.b) == 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	c := d.b[0]
+	d.b = d.b[1:]
+	return c
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) bytes() []byte {
+	size := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.b)) < size {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	// copy so that the record does not pin the whole payload
+	p := make([]byte, size)
+	copy(p, d.b)
+	d.b = d.b[size:]
+	return p
+}
+
+func (d *decoder) record() *record {
+	r := &record{Type: recordType(d.byte())}
+	switch r.Type {
+	case recordSet:
+		r.Version = d.varint()
+		r.Prefix = string(d.bytes())
+		r.Key = string(d.bytes())
+		r.Value = d.bytes()
+	case recordRemove:
+		r.Prefix = string(d.bytes())
+		r.Key = string(d.bytes())
+	case recordAppend:
+		r.Prefix = string(d.bytes())
+		r.Key = string(d.bytes())
+		r.Value = d.bytes()
+	case recordBatch:
+		count := d.uvarint()
+		for i := uint64(0); i < count && d.err == nil; i++ {
+			op := d.record()
+			if op.Type != recordSet && op.Type != recordRemove {
+				d.err = errors.NotValidf("op type %d in batch", op.Type)
+			}
+			r.Ops = append(r.Ops, op)
+		}
+	case recordSnapshot:
+		r.Gen = d.varint()
+		r.Seq = d.varint()
+	default:
+		if d.err == nil {
+			d.err = errors.NotValidf("record type %d", r.Type)
+		}
+	}
+	return r
+}
+
+func decodeRecord(payload []byte) (*record, error) {
+	d := &decoder{b: payload}
+	r := d.record()
+	if d.err != nil {
+		return nil, errors.Trace(d.err)
+	}
+	if len(d.b) != 0 {
+		return nil, errors.NotValidf("%d trailing bytes of record", len(d.b))
+	}
+	return r, nil
+}
+
+/**
+ * appendFrame frames the encoded record with its length and checksum,
+ * so that a torn or corrupted tail is detected on recovery.
+ */
+func appendFrame(b []byte, r *record) []byte {
+	start := len(b)
+	b = append(b, make([]byte, frameHeaderSize)...)
+	b = r.encode(b)
+
+	payload := b[start+frameHeaderSize:]
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[start+4:], crc32.Checksum(payload, crcTable))
+	return b
+}
+
+/**
+ * readFrames calls fn with the records of r in order until the end or the first broken frame,
+ * it returns the size of the intact frames and whether a broken frame is met.
+ */
+func readFrames(r io.Reader, fn func(r *record) error) (int64, bool, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, frameHeaderSize)
+	offset := int64(0)
+	for {
+		if _, err := io.ReadFull(br, header); err != nil {
+			if err == io.EOF {
+				return offset, false, nil
+			}
+			if err == io.ErrUnexpectedEOF {
+				return offset, true, nil
+			}
+			return offset, false, errors.Trace(err)
+		}
+
+		size := binary.LittleEndian.Uint32(header)
+		if size > maxPayloadSize {
+			return offset, true, nil
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return offset, true, nil
+			}
+			return offset, false, errors.Trace(err)
+		}
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:]) {
+			return offset, true, nil
+		}
+		rec, err := decodeRecord(payload)
+		if err != nil {
+			return offset, true, nil
+		}
+		if err := fn(rec); err != nil {
+			return offset, false, errors.Trace(err)
+		}
+		offset += int64(frameHeaderSize + len(payload))
+	}
+}
@@ -3,6 +3,7 @@ package mem
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -10,12 +11,16 @@ import (
 )
 
 var (
-	_ store.Store = &memStore{}
+	_ store.Store   = &memStore{}
+	_ store.Scanner = &memStore{}
+	_ store.TxStore = &memStore{}
 )
 
 func NewMemStore() store.Store {
 	return &memStore{
 		m: make(map[string][]byte),
+		a: make(map[string][][]byte),
+		v: make(map[string]int64),
 		// setup no error as default
 		mockErrHandler: defaultNoErr,
 	}
@@ -24,6 +29,8 @@ func NewMemStore() store.Store {
 func NewMemStoreWithErrHandler(errHandler func() error) store.Store {
 	return &memStore{
 		m: make(map[string][]byte),
+		a: make(map[string][][]byte),
+		v: make(map[string]int64),
 		// .
 		mockErrHandler: errHandler,
 	}
@@ -43,6 +50,11 @@ type memStore struct {
 	mockErrHandler func() error
 
 	m map[string][]byte
+	// appended values
+	a map[string][][]byte
+	// versions of m, assigned from seq so that never reused
+	v   map[string]int64
+	seq int64
 }
 
 func (m *memStore) String() string {
@@ -65,15 +77,25 @@ func (m *memStore) Set(ctx context.Context, prefix, key string, value []byte) er
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.m[prefix+"|"+key] = value
+	m.set(prefix+"|"+key, value)
 	return m.mockErrHandler()
 }
 
+// set assumes the caller holds m.mu
+func (m *memStore) set(key string, value []byte) int64 {
+	m.seq++
+	m.m[key] = value
+	m.v[key] = m.seq
+	return m.seq
+}
+
 func (m *memStore) Remove(ctx context.Context, prefix, key string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	delete(m.m, prefix+"|"+key)
+	delete(m.v, prefix+"|"+key)
+	delete(m.a, prefix+"|"+key)
 	return m.mockErrHandler()
 }
 
@@ -98,3 +120,98 @@ func (m *memStore) List(ctx context.Context, prefix string, iterator func(key st
 	}
 	return m.mockErrHandler()
 }
+
+func (m *memStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	m.mu.Lock()
+
+	prefix += "|"
+	matched := make(map[string][]byte)
+	matchedKeys := make([]string, 0)
+	for key, value := range m.m {
+		key, found := strings.CutPrefix(key, prefix)
+		if !found || key <= afterKey {
+			continue
+		}
+		matched[key] = value
+		matchedKeys = append(matchedKeys, key)
+	}
+	m.mu.Unlock()
+
+	sort.Strings(matchedKeys)
+	for _, key := range matchedKeys {
+		if !iterator(key, matched[key]) {
+			break
+		}
+	}
+	return m.mockErrHandler()
+}
+
+func (m *memStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.a[prefix+"|"+key] = append(m.a[prefix+"|"+key], value)
+	return m.mockErrHandler()
+}
+
+func (m *memStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	m.mu.Lock()
+	values := m.a[prefix+"|"+key]
+	m.mu.Unlock()
+
+	// appending never modifies the existing elements, so it is safe to iterate without lock
+	for _, value := range values {
+		if !iterator(value) {
+			break
+		}
+	}
+	return m.mockErrHandler()
+}
+
+func (m *memStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.m[prefix+"|"+key], m.v[prefix+"|"+key], m.mockErrHandler()
+}
+
+func (m *memStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.mockErrHandler(); err != nil {
+		return 0, err
+	}
+	if m.v[prefix+"|"+key] != version {
+		return 0, store.ErrVersionConflict
+	}
+	return m.set(prefix+"|"+key, value), nil
+}
+
+func (m *memStore) Batch(ctx context.Context, ops []store.Op) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.mockErrHandler(); err != nil {
+		return err
+	}
+	for _, op := range ops {
+		if op.Type != store.OpSet && op.Type != store.OpRemove {
+			return fmt.Errorf("unknown op type %d", op.Type)
+		}
+		if op.Version != 0 && m.v[op.Prefix+"|"+op.Key] != op.Version {
+			return store.ErrVersionConflict
+		}
+	}
+	for _, op := range ops {
+		key := op.Prefix + "|" + op.Key
+		if op.Type == store.OpSet {
+			m.set(key, op.Value)
+			continue
+		}
+		delete(m.m, key)
+		delete(m.v, key)
+		delete(m.a, key)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/juju/errors"
+)
+
+// migrationLockID is the key of the advisory lock serializing the instances migrating the schema together
+const migrationLockID = 0x77666d67
+
+// migration is one step of the schema, applied once in its own transaction
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// execMigration returns a migration step running the statements
+func execMigration(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return errors.Trace(err)
+	}
+}
+
+// migrations are applied in order, never edit a released step but append a new one.
+// The first steps use IF NOT EXISTS, so the tables created before the migrations were tracked are adopted as they are.
+var migrations = []migration{
+	{1, "create key-value tables", execMigration(`
+		CREATE SEQUENCE IF NOT EXISTS workflow_store_version_seq;
+
+		CREATE TABLE IF NOT EXISTS workflow_store (
+			prefix VARCHAR(255) NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			value BYTEA,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (prefix, key)
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_workflow_store_prefix ON workflow_store(prefix);
+
+		CREATE TABLE IF NOT EXISTS workflow_store_append (
+			prefix VARCHAR(255) NOT NULL,
+			key VARCHAR(255) NOT NULL,
+			seq BIGSERIAL NOT NULL,
+			value BYTEA,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (prefix, key, seq)
+		);
+	`)},
+	{2, "add versions to key-value table", execMigration(`
+		ALTER TABLE workflow_store ADD COLUMN IF NOT EXISTS
+			version BIGINT NOT NULL DEFAULT nextval('workflow_store_version_seq');
+	`)},
+	{3, "widen key-value keys", execMigration(`
+		ALTER TABLE workflow_store ALTER COLUMN prefix TYPE TEXT, ALTER COLUMN key TYPE TEXT;
+		ALTER TABLE workflow_store_append ALTER COLUMN prefix TYPE TEXT, ALTER COLUMN key TYPE TEXT;
+	`)},
+	{4, "create request, plan and record tables", execMigration(`
+		CREATE TABLE IF NOT EXISTS workflow_requests (
+			request_id TEXT NOT NULL PRIMARY KEY,
+			dag_name TEXT,
+			tenant TEXT,
+			status INTEGER,
+			current_vertex TEXT,
+			labels JSONB,
+			create_time TIMESTAMPTZ,
+			update_time TIMESTAMPTZ,
+			data JSONB,
+			value BYTEA,
+			version BIGINT NOT NULL DEFAULT nextval('workflow_store_version_seq'),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_dag_status ON workflow_requests(dag_name, status);
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_tenant_status ON workflow_requests(tenant, status);
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_status_update ON workflow_requests(status, update_time);
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_create_time ON workflow_requests(create_time);
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_update_time ON workflow_requests(update_time);
+		CREATE INDEX IF NOT EXISTS idx_workflow_requests_labels ON workflow_requests USING GIN (labels jsonb_path_ops);
+
+		CREATE TABLE IF NOT EXISTS workflow_plans (
+			request_id TEXT NOT NULL PRIMARY KEY,
+			dag_name TEXT,
+			data JSONB,
+			value BYTEA,
+			version BIGINT NOT NULL DEFAULT nextval('workflow_store_version_seq'),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS workflow_records (
+			request_id TEXT NOT NULL,
+			vertex TEXT NOT NULL,
+			start_time TIMESTAMPTZ,
+			end_time TIMESTAMPTZ,
+			error TEXT,
+			data JSONB,
+			value BYTEA,
+			version BIGINT NOT NULL DEFAULT nextval('workflow_store_version_seq'),
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (request_id, vertex)
+		);
+	`)},
+	{5, "move key-value rows to request, plan and record tables", moveKVRows},
+}
+
+// latestVersion is the schema version this package works with
+func latestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// moveBatchSize is the amount of the key-value rows moved at a time
+const moveBatchSize = 500
+
+// moveKVRows moves the rows written by the key-value layout into the typed tables
+func moveKVRows(ctx context.Context, tx *sql.Tx) error {
+	type kvRow struct {
+		prefix, key string
+		value       []byte
+		version     int64
+	}
+
+	for _, t := range typedTables {
+		query := `SELECT prefix, key, value, version FROM workflow_store WHERE ` + t.kvMatch + ` ORDER BY prefix, key LIMIT $1`
+		for {
+			rows, err := tx.QueryContext(ctx, query, moveBatchSize)
+			if err != nil {
+				return errors.Annotatef(err, "failed to select rows for %s", t.name)
+			}
+			batch := make([]kvRow, 0, moveBatchSize)
+			for rows.Next() {
+				var row kvRow
+				if err := rows.Scan(&row.prefix, &row.key, &row.value, &row.version); err != nil {
+					rows.Close()
+					return errors.Annotatef(err, "failed to scan row")
+				}
+				batch = append(batch, row)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return errors.Annotatef(err, "error iterating rows")
+			}
+			if len(batch) == 0 {
+				break
+			}
+
+			for _, row := range batch {
+				// the versions are kept, so a version read before the migration still compares
+				if err := t.insert(ctx, tx, row.prefix, row.key, row.value, row.version); err != nil {
+					return errors.Trace(err)
+				}
+				_, err := tx.ExecContext(ctx, `DELETE FROM workflow_store WHERE prefix = $1 AND key = $2`, row.prefix, row.key)
+				if err != nil {
+					return errors.Annotatef(err, "failed to remove moved row prefix=%s, key=%s", row.prefix, row.key)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ensureMigrationTable creates the table tracking the applied migrations
+func ensureMigrationTable(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Annotatef(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	// the concurrent CREATE TABLE IF NOT EXISTS may fail on the unique constraint of the catalog
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return errors.Annotatef(err, "failed to lock migrations")
+	}
+	query := `
+		CREATE TABLE IF NOT EXISTS workflow_schema_migrations (
+			version INTEGER NOT NULL PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return errors.Annotatef(err, "failed to create migrations table")
+	}
+	return errors.Annotatef(tx.Commit(), "failed to commit transaction")
+}
+
+// applyMigration applies m unless it was applied by another instance
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Annotatef(err, "failed to begin transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return errors.Annotatef(err, "failed to lock migrations")
+	}
+	var applied bool
+	query := `SELECT EXISTS (SELECT 1 FROM workflow_schema_migrations WHERE version = $1)`
+	if err := tx.QueryRowContext(ctx, query, m.version).Scan(&applied); err != nil {
+		return errors.Annotatef(err, "failed to check migration")
+	}
+	if applied {
+		return nil
+	}
+
+	if err := m.up(ctx, tx); err != nil {
+		return errors.Trace(err)
+	}
+	query = `INSERT INTO workflow_schema_migrations (version, name) VALUES ($1, $2)`
+	if _, err := tx.ExecContext(ctx, query, m.version, m.name); err != nil {
+		return errors.Annotatef(err, "failed to record migration")
+	}
+	return errors.Annotatef(tx.Commit(), "failed to commit transaction")
+}
+
+// SchemaVersion returns the latest migration applied to the database, 0 if none
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM workflow_schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, errors.Annotatef(err, "failed to get schema version")
+	}
+	return int(version.Int64), nil
+}
+
+// Migrate applies the pending migrations to the database, it is called by the constructors of the store.
+// A database migrated by a newer version of this package is refused rather than written in an older layout.
+func Migrate(ctx context.Context, db *sql.DB) error {
+	if err := ensureMigrationTable(ctx, db); err != nil {
+		return errors.Trace(err)
+	}
+	version, err := SchemaVersion(ctx, db)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if version > latestVersion() {
+		return errors.NotSupportedf("schema version %d newer than %d", version, latestVersion())
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := applyMigration(ctx, db, m); err != nil {
+			return errors.Annotatef(err, "failed to apply migration %d %q", m.version, m.name)
+		}
+	}
+	return nil
+}
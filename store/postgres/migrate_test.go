@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations_Order(t *testing.T) {
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.version)
+		assert.NotEmpty(t, m.name)
+	}
+	assert.Equal(t, len(migrations), latestVersion())
+}
+
+func TestMigrate(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	p := s.(*pgStore)
+	defer p.Close()
+
+	ctx := context.Background()
+	version, err := SchemaVersion(ctx, p.db)
+	assert.Nil(t, err)
+	assert.Equal(t, latestVersion(), version)
+
+	// applied once
+	assert.Nil(t, Migrate(ctx, p.db))
+	var count int
+	assert.Nil(t, p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_schema_migrations`).Scan(&count))
+	assert.Equal(t, len(migrations), count)
+}
+
+func TestMigrate_KVRows(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	p := s.(*pgStore)
+	defer p.Close()
+
+	ctx := context.Background()
+	defer s.Remove(ctx, RequestPrefix, "kv-req")
+	defer s.Remove(ctx, RecordPrefix+"kv-req", "dag.node1")
+	defer s.Remove(ctx, PlanPrefix, "kv-req")
+
+	// rows written by the key-value layout
+	rows := map[string][]byte{
+		RequestPrefix:           []byte(`{"RequestID":"kv-req","DAGName":"dag","Status":1}`),
+		RecordPrefix + "kv-req": []byte(`{"Vertex":["dag","node1"],"Error":"failed"}`),
+		PlanPrefix:              {0x00, 0x01},
+	}
+	keys := map[string]string{RequestPrefix: "kv-req", RecordPrefix + "kv-req": "dag.node1", PlanPrefix: "kv-req"}
+	for prefix, value := range rows {
+		_, err := p.db.ExecContext(ctx, `INSERT INTO workflow_store (prefix, key, value) VALUES ($1, $2, $3)`,
+			prefix, keys[prefix], value)
+		assert.Nil(t, err)
+	}
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, moveKVRows(ctx, tx))
+	assert.Nil(t, tx.Commit())
+
+	var count int
+	assert.Nil(t, p.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM workflow_store WHERE key IN ('kv-req', 'dag.node1')`).Scan(&count))
+	assert.Equal(t, 0, count)
+	for prefix, value := range rows {
+		stored, err := s.Get(ctx, prefix, keys[prefix])
+		assert.Nil(t, err)
+		if prefix == PlanPrefix {
+			assert.Equal(t, value, stored)
+		} else {
+			assert.JSONEq(t, string(value), string(stored))
+		}
+	}
+
+	var recordErr string
+	query := `SELECT error FROM workflow_records WHERE request_id = $1 AND vertex = $2`
+	assert.Nil(t, p.db.QueryRowContext(ctx, query, "kv-req", "dag.node1").Scan(&recordErr))
+	assert.Equal(t, "failed", recordErr)
+}
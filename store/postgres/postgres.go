@@ -12,7 +12,9 @@ import (
 )
 
 var (
-	_ store.Store = &pgStore{}
+	_ store.Store   = &pgStore{}
+	_ store.Scanner = &pgStore{}
+	_ store.TxStore = &pgStore{}
 )
 
 // Config holds PostgreSQL connection configuration
@@ -66,10 +68,9 @@ func NewPostgresStore(config *Config) (store.Store, error) {
 
 	s := &pgStore{db: db}
 
-	// Initialize table
-	if err := s.initTable(context.Background()); err != nil {
+	if err := Migrate(context.Background(), db); err != nil {
 		db.Close()
-		return nil, errors.Annotatef(err, "failed to initialize table")
+		return nil, errors.Annotatef(err, "failed to migrate schema")
 	}
 
 	return s, nil
@@ -83,39 +84,20 @@ func NewPostgresStoreWithDB(db *sql.DB) (store.Store, error) {
 
 	s := &pgStore{db: db}
 
-	// Initialize table
-	if err := s.initTable(context.Background()); err != nil {
-		return nil, errors.Annotatef(err, "failed to initialize table")
+	if err := Migrate(context.Background(), db); err != nil {
+		return nil, errors.Annotatef(err, "failed to migrate schema")
 	}
 
 	return s, nil
 }
 
-// initTable creates the workflow_store table if it doesn't exist
-func (p *pgStore) initTable(ctx context.Context) error {
-	query := `
-		CREATE TABLE IF NOT EXISTS workflow_store (
-			prefix VARCHAR(255) NOT NULL,
-			key VARCHAR(255) NOT NULL,
-			value BYTEA,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (prefix, key)
-		);
-
-		CREATE INDEX IF NOT EXISTS idx_workflow_store_prefix ON workflow_store(prefix);
-	`
-
-	_, err := p.db.ExecContext(ctx, query)
-	if err != nil {
-		return errors.Annotatef(err, "failed to create table")
-	}
-
-	return nil
-}
-
 // Get retrieves a value by prefix and key
 func (p *pgStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
+	if t, scope := routeTable(prefix); t != nil {
+		value, _, err := t.get(ctx, p.db, scope, key)
+		return value, err
+	}
+
 	query := `SELECT value FROM workflow_store WHERE prefix = $1 AND key = $2`
 
 	var value []byte
@@ -132,11 +114,16 @@ func (p *pgStore) Get(ctx context.Context, prefix, key string) ([]byte, error) {
 
 // Set stores a value with the given prefix and key
 func (p *pgStore) Set(ctx context.Context, prefix, key string, value []byte) error {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.set(ctx, p.db, scope, key, value)
+	}
+
 	query := `
 		INSERT INTO workflow_store (prefix, key, value, updated_at)
 		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
 		ON CONFLICT (prefix, key)
-		DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP
+		DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP,
+			version = nextval('workflow_store_version_seq')
 	`
 
 	_, err := p.db.ExecContext(ctx, query, prefix, key, value)
@@ -147,13 +134,17 @@ func (p *pgStore) Set(ctx context.Context, prefix, key string, value []byte) err
 	return nil
 }
 
-// Remove deletes a value by prefix and key
+// Remove deletes a value and the appended values by prefix and key
 func (p *pgStore) Remove(ctx context.Context, prefix, key string) error {
-	query := `DELETE FROM workflow_store WHERE prefix = $1 AND key = $2`
+	if _, err := removeVersion(ctx, p.db, prefix, key, 0); err != nil {
+		return err
+	}
+
+	query := `DELETE FROM workflow_store_append WHERE prefix = $1 AND key = $2`
 
 	_, err := p.db.ExecContext(ctx, query, prefix, key)
 	if err != nil {
-		return errors.Annotatef(err, "failed to remove value for prefix=%s, key=%s", prefix, key)
+		return errors.Annotatef(err, "failed to remove appended values for prefix=%s, key=%s", prefix, key)
 	}
 
 	return nil
@@ -161,6 +152,10 @@ func (p *pgStore) Remove(ctx context.Context, prefix, key string) error {
 
 // List retrieves all keys with the given prefix and calls the iterator for each
 func (p *pgStore) List(ctx context.Context, prefix string, iterator func(key string) bool) error {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.list(ctx, p.db, scope, iterator)
+	}
+
 	query := `SELECT key FROM workflow_store WHERE prefix = $1 ORDER BY key`
 
 	rows, err := p.db.QueryContext(ctx, query, prefix)
@@ -187,6 +182,222 @@ func (p *pgStore) List(ctx context.Context, prefix string, iterator func(key str
 	return nil
 }
 
+// Scan retrieves keys along with values with the given prefix in one query and calls the iterator for each
+func (p *pgStore) Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.scan(ctx, p.db, scope, afterKey, iterator)
+	}
+
+	// keys are compared in byte order, the same as the other stores
+	query := `SELECT key, value FROM workflow_store WHERE prefix = $1 AND key COLLATE "C" > $2 ORDER BY key COLLATE "C"`
+
+	rows, err := p.db.QueryContext(ctx, query, prefix, afterKey)
+	if err != nil {
+		return errors.Annotatef(err, "failed to scan prefix=%s", prefix)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return errors.Annotatef(err, "failed to scan row")
+		}
+
+		if !iterator(key, value) {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Annotatef(err, "error iterating rows")
+	}
+
+	return nil
+}
+
+// Append adds a value to the list of prefix and key
+func (p *pgStore) Append(ctx context.Context, prefix, key string, value []byte) error {
+	query := `INSERT INTO workflow_store_append (prefix, key, value) VALUES ($1, $2, $3)`
+
+	_, err := p.db.ExecContext(ctx, query, prefix, key, value)
+	if err != nil {
+		return errors.Annotatef(err, "failed to append value for prefix=%s, key=%s", prefix, key)
+	}
+
+	return nil
+}
+
+// ListAppend retrieves the appended values of prefix and key in appending order and calls the iterator for each
+func (p *pgStore) ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error {
+	query := `SELECT value FROM workflow_store_append WHERE prefix = $1 AND key = $2 ORDER BY seq`
+
+	rows, err := p.db.QueryContext(ctx, query, prefix, key)
+	if err != nil {
+		return errors.Annotatef(err, "failed to list appended values for prefix=%s, key=%s", prefix, key)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value []byte
+		if err := rows.Scan(&value); err != nil {
+			return errors.Annotatef(err, "failed to scan value")
+		}
+
+		if !iterator(value) {
+			break
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return errors.Annotatef(err, "error iterating rows")
+	}
+
+	return nil
+}
+
+// GetVersion retrieves a value along with its version by prefix and key
+func (p *pgStore) GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error) {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.get(ctx, p.db, scope, key)
+	}
+
+	query := `SELECT value, version FROM workflow_store WHERE prefix = $1 AND key = $2`
+
+	var value []byte
+	var version int64
+	err := p.db.QueryRowContext(ctx, query, prefix, key).Scan(&value, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, nil
+		}
+		return nil, 0, errors.Annotatef(err, "failed to get value for prefix=%s, key=%s", prefix, key)
+	}
+
+	return value, version, nil
+}
+
+// execer is either *sql.DB or *sql.Tx
+type execer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func compareAndSet(ctx context.Context, db execer, prefix, key string, value []byte, version int64) (int64, error) {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.compareAndSet(ctx, db, scope, key, value, version)
+	}
+
+	query := `
+		UPDATE workflow_store SET value = $3, updated_at = CURRENT_TIMESTAMP,
+			version = nextval('workflow_store_version_seq')
+		WHERE prefix = $1 AND key = $2 AND version = $4
+		RETURNING version
+	`
+	args := []any{prefix, key, value, version}
+	if version == 0 {
+		query = `
+			INSERT INTO workflow_store (prefix, key, value, updated_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (prefix, key) DO NOTHING
+			RETURNING version
+		`
+		args = args[:3]
+	}
+
+	var newVersion int64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&newVersion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, store.ErrVersionConflict
+		}
+		return 0, errors.Annotatef(err, "failed to compare and set value for prefix=%s, key=%s", prefix, key)
+	}
+	return newVersion, nil
+}
+
+// CompareAndSet stores a value only if the current version of prefix and key equals the version
+func (p *pgStore) CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error) {
+	return compareAndSet(ctx, p.db, prefix, key, value, version)
+}
+
+// removeVersion deletes the value only if its version equals version unless it is 0
+func removeVersion(ctx context.Context, db execer, prefix, key string, version int64) (bool, error) {
+	if t, scope := routeTable(prefix); t != nil {
+		return t.remove(ctx, db, scope, key, version)
+	}
+
+	query := `DELETE FROM workflow_store WHERE prefix = $1 AND key = $2`
+	args := []any{prefix, key}
+	if version != 0 {
+		query += ` AND version = $3`
+		args = append(args, version)
+	}
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Annotatef(err, "failed to remove value for prefix=%s, key=%s", prefix, key)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return n > 0, nil
+}
+
+func applyOp(ctx context.Context, tx *sql.Tx, op store.Op) error {
+	switch op.Type {
+	case store.OpSet:
+		if op.Version != 0 {
+			_, err := compareAndSet(ctx, tx, op.Prefix, op.Key, op.Value, op.Version)
+			return err
+		}
+		if t, scope := routeTable(op.Prefix); t != nil {
+			return t.set(ctx, tx, scope, op.Key, op.Value)
+		}
+		query := `
+			INSERT INTO workflow_store (prefix, key, value, updated_at)
+			VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+			ON CONFLICT (prefix, key)
+			DO UPDATE SET value = EXCLUDED.value, updated_at = CURRENT_TIMESTAMP,
+				version = nextval('workflow_store_version_seq')
+		`
+		_, err := tx.ExecContext(ctx, query, op.Prefix, op.Key, op.Value)
+		return errors.Annotatef(err, "failed to set value for prefix=%s, key=%s", op.Prefix, op.Key)
+
+	case store.OpRemove:
+		removed, err := removeVersion(ctx, tx, op.Prefix, op.Key, op.Version)
+		if err != nil {
+			return err
+		}
+		if op.Version != 0 && !removed {
+			return store.ErrVersionConflict
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM workflow_store_append WHERE prefix = $1 AND key = $2`, op.Prefix, op.Key)
+		return errors.Annotatef(err, "failed to remove appended values for prefix=%s, key=%s", op.Prefix, op.Key)
+	}
+	return errors.NotSupportedf("op type %d", op.Type)
+}
+
+// Batch applies the ops in one transaction
+func (p *pgStore) Batch(ctx context.Context, ops []store.Op) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Annotatef(err, "failed to begin transaction")
+	}
+
+	for _, op := range ops {
+		if err := applyOp(ctx, tx, op); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.Annotatef(err, "failed to commit transaction")
+	}
+	return nil
+}
+
 // Close closes the database connection
 func (p *pgStore) Close() error {
 	if p.db != nil {
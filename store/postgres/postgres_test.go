@@ -6,6 +6,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/juju/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/warriorguo/workflow/store"
 )
@@ -304,3 +305,150 @@ func TestPostgresStore_BinaryData(t *testing.T) {
 	err = s.Remove(ctx, "/test/", "binary")
 	assert.Nil(t, err)
 }
+
+func TestPostgresStore_Scan(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	if closer, ok := s.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+
+	// Set multiple values with same prefix
+	assert.Nil(t, s.Set(ctx, "/scan/", "key1", []byte("value1")))
+	assert.Nil(t, s.Set(ctx, "/scan/", "key2", []byte("value2")))
+	assert.Nil(t, s.Set(ctx, "/scan/", "key3", []byte("value3")))
+
+	// Scan keys after key1 along with values
+	values := make(map[string]string)
+	err := s.(store.Scanner).Scan(ctx, "/scan/", "key1", func(key string, value []byte) bool {
+		values[key] = string(value)
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"key2": "value2", "key3": "value3"}, values)
+
+	// Cleanup
+	s.Remove(ctx, "/scan/", "key1")
+	s.Remove(ctx, "/scan/", "key2")
+	s.Remove(ctx, "/scan/", "key3")
+}
+
+func TestPostgresStore_Append(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	if closer, ok := s.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+
+	// Append values in order
+	assert.Nil(t, s.Append(ctx, "/append/", "key1", []byte("value1")))
+	assert.Nil(t, s.Append(ctx, "/append/", "key1", []byte("value2")))
+	assert.Nil(t, s.Append(ctx, "/append/", "key1", []byte("value3")))
+
+	values := make([]string, 0)
+	err := s.ListAppend(ctx, "/append/", "key1", func(value []byte) bool {
+		values = append(values, string(value))
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"value1", "value2", "value3"}, values)
+
+	// Remove drops the appended values as well
+	assert.Nil(t, s.Remove(ctx, "/append/", "key1"))
+	count := 0
+	err = s.ListAppend(ctx, "/append/", "key1", func(value []byte) bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestPostgresStore_CompareAndSet(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	if closer, ok := s.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+	txStore := s.(store.TxStore)
+	defer s.Remove(ctx, "/cas/", "key1")
+
+	// Version 0 means not exists
+	_, version, err := txStore.GetVersion(ctx, "/cas/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), version)
+
+	version, err = txStore.CompareAndSet(ctx, "/cas/", "key1", []byte("value1"), 0)
+	assert.Nil(t, err)
+	_, err = txStore.CompareAndSet(ctx, "/cas/", "key1", []byte("value2"), 0)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+
+	newVersion, err := txStore.CompareAndSet(ctx, "/cas/", "key1", []byte("value2"), version)
+	assert.Nil(t, err)
+	assert.NotEqual(t, version, newVersion)
+	_, err = txStore.CompareAndSet(ctx, "/cas/", "key1", []byte("value3"), version)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+
+	value, current, err := txStore.GetVersion(ctx, "/cas/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value2"), value)
+	assert.Equal(t, newVersion, current)
+
+	// Set changes the version as well
+	assert.Nil(t, s.Set(ctx, "/cas/", "key1", []byte("value4")))
+	_, err = txStore.CompareAndSet(ctx, "/cas/", "key1", []byte("value5"), newVersion)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+}
+
+func TestPostgresStore_Batch(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	if closer, ok := s.(interface{ Close() error }); ok {
+		defer closer.Close()
+	}
+
+	ctx := context.Background()
+	txStore := s.(store.TxStore)
+	defer s.Remove(ctx, "/batch/", "key1")
+	defer s.Remove(ctx, "/batch/", "key2")
+
+	assert.Nil(t, s.Set(ctx, "/batch/", "key2", []byte("value2")))
+	assert.Nil(t, txStore.Batch(ctx, []store.Op{
+		store.SetOp("/batch/", "key1", []byte("value1")),
+		store.RemoveOp("/batch/", "key2"),
+	}))
+
+	value, version, err := txStore.GetVersion(ctx, "/batch/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+	value, err = s.Get(ctx, "/batch/", "key2")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+
+	// none of the ops applied if any version check failed
+	err = txStore.Batch(ctx, []store.Op{
+		store.SetOp("/batch/", "key2", []byte("value2")),
+		{Type: store.OpSet, Prefix: "/batch/", Key: "key1", Value: []byte("value3"), Version: version + 1000},
+	})
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+	value, err = s.Get(ctx, "/batch/", "key2")
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	value, err = s.Get(ctx, "/batch/", "key1")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value1"), value)
+}
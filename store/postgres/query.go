@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/lib/pq"
+	"github.com/warriorguo/workflow/types"
+)
+
+// requestQuery builds the query selecting the request index entries by the filter with the indexes of workflow_requests.
+// The times are stored in microseconds, so the bounds are inclusive and the caller checks the entries again.
+// The page, if any, is selected by the keyset of the sort column and request_id rather than an offset.
+func requestQuery(filter *types.RequestFilter, page *types.RequestPage) (string, []any, error) {
+	conds := []string{"data IS NOT NULL"}
+	args := make([]any, 0)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.DAGName != "" {
+		add("dag_name = $%d", filter.DAGName)
+	}
+	if filter.Tenant != "" {
+		add("tenant = $%d", filter.Tenant)
+	}
+	if filter.CurrentVertex != "" {
+		add("current_vertex = $%d", filter.CurrentVertex)
+	}
+	if len(filter.Statuses) > 0 {
+		statuses := make([]int64, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			statuses[i] = int64(status)
+		}
+		add("status = ANY($%d)", pq.Array(statuses))
+	}
+	if len(filter.Labels) > 0 {
+		b, err := json.Marshal(filter.Labels)
+		if err != nil {
+			return "", nil, errors.Trace(err)
+		}
+		add("labels @> $%d::jsonb", string(b))
+	}
+	if !filter.CreatedAfter.IsZero() {
+		add("create_time >= $%d", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		add("create_time <= $%d", filter.CreatedBefore)
+	}
+	if !filter.UpdatedAfter.IsZero() {
+		add("update_time >= $%d", filter.UpdatedAfter)
+	}
+	if !filter.UpdatedBefore.IsZero() {
+		add("update_time <= $%d", filter.UpdatedBefore)
+	}
+
+	if page == nil {
+		query := `SELECT request_id, data FROM workflow_requests WHERE ` + strings.Join(conds, " AND ")
+		return query, args, nil
+	}
+
+	column := pageColumn(page.SortBy)
+	// the zero times are stored as NULL, which are listed first as the zero times are
+	order, nulls, cmp := "ASC", "NULLS FIRST", ">"
+	if page.Descending {
+		order, nulls, cmp = "DESC", "NULLS LAST", "<"
+	}
+	if page.AfterRequestID != "" {
+		switch {
+		case column == "":
+			add("request_id "+cmp+" $%d", page.AfterRequestID)
+		case page.AfterTime.IsZero() && !page.Descending:
+			add(fmt.Sprintf("(%s IS NOT NULL OR request_id > $%%d)", column), page.AfterRequestID)
+		case page.AfterTime.IsZero():
+			add(fmt.Sprintf("(%s IS NULL AND request_id < $%%d)", column), page.AfterRequestID)
+		default:
+			args = append(args, page.AfterTime, page.AfterRequestID)
+			cond := fmt.Sprintf("(%s, request_id) %s ($%d, $%d)", column, cmp, len(args)-1, len(args))
+			if page.Descending {
+				cond = fmt.Sprintf("(%s OR %s IS NULL)", cond, column)
+			}
+			conds = append(conds, cond)
+		}
+	}
+
+	orderBy := "request_id " + order
+	if column != "" {
+		orderBy = fmt.Sprintf("%s %s %s, %s", column, order, nulls, orderBy)
+	}
+	query := `SELECT request_id, data FROM workflow_requests WHERE ` + strings.Join(conds, " AND ") + ` ORDER BY ` + orderBy
+	if page.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", page.Limit)
+	}
+	return query, args, nil
+}
+
+// pageColumn returns the time column sorted by, empty if sorted by request_id only
+func pageColumn(sortBy types.RequestSortField) string {
+	switch sortBy {
+	case types.SortByUpdateTime:
+		return "update_time"
+	case types.SortByRequestID:
+		return ""
+	default:
+		return "create_time"
+	}
+}
+
+// QueryRequests selects the request index entries matching the filter in the database rather than scanning all of them,
+// the entries may include a few not matching the time bounds exactly, they are sorted and limited by the page if any.
+func (p *pgStore) QueryRequests(ctx context.Context, filter *types.RequestFilter, page *types.RequestPage,
+	iterator func(requestID string, value []byte) bool) error {
+	query, args, err := requestQuery(filter, page)
+	if err != nil {
+		return errors.Trace(err)
+	}
+
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return errors.Annotatef(err, "failed to query requests")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var requestID string
+		var data sql.NullString
+		if err := rows.Scan(&requestID, &data); err != nil {
+			return errors.Annotatef(err, "failed to scan row")
+		}
+		if !iterator(requestID, []byte(data.String)) {
+			break
+		}
+	}
+	return errors.Annotatef(rows.Err(), "error iterating rows")
+}
@@ -0,0 +1,365 @@
+package postgres
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+)
+
+// the prefixes written by the runtime which are stored in the typed tables rather than workflow_store
+const (
+	// RequestPrefix is the prefix of the request index, stored in workflow_requests
+	RequestPrefix = "/request/"
+	// PlanPrefix is the prefix of the execute plans, stored in workflow_plans
+	PlanPrefix = "/dag/"
+	// RecordPrefix followed by the request id is the prefix of the trace records, stored in workflow_records
+	RecordPrefix = "/record/"
+)
+
+// queryer is either *sql.DB or *sql.Tx
+type queryer interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// typedTable stores the values of a prefix in a table of its own, the JSON values are kept in the data column
+// along with the columns extracted for filtering, the other values are kept as bytes in the value column.
+type typedTable struct {
+	name string
+	// kvMatch selects the rows of the table from workflow_store while migrating
+	kvMatch string
+	// keyColumns identify a row, the last one is the key within the prefix
+	keyColumns []string
+	// columns are extracted from the JSON values
+	columns []string
+	// scope returns the values of the leading key columns for prefix, false if prefix is not stored in the table
+	scope func(prefix string) ([]any, bool)
+	// extract returns the values of the columns, nil if the value is not the expected JSON
+	extract func(value []byte) []any
+}
+
+var (
+	requestTable = &typedTable{
+		name:       "workflow_requests",
+		kvMatch:    fmt.Sprintf("prefix = '%s'", RequestPrefix),
+		keyColumns: []string{"request_id"},
+		columns:    []string{"dag_name", "tenant", "status", "current_vertex", "labels", "create_time", "update_time"},
+		scope:      exactScope(RequestPrefix),
+		extract:    extractRequest,
+	}
+	planTable = &typedTable{
+		name:       "workflow_plans",
+		kvMatch:    fmt.Sprintf("prefix = '%s'", PlanPrefix),
+		keyColumns: []string{"request_id"},
+		columns:    []string{"dag_name"},
+		scope:      exactScope(PlanPrefix),
+		extract:    extractPlan,
+	}
+	recordTable = &typedTable{
+		name:       "workflow_records",
+		kvMatch:    fmt.Sprintf("prefix LIKE '%s%%'", RecordPrefix),
+		keyColumns: []string{"request_id", "vertex"},
+		columns:    []string{"start_time", "end_time", "error"},
+		scope: func(prefix string) ([]any, bool) {
+			if !strings.HasPrefix(prefix, RecordPrefix) {
+				return nil, false
+			}
+			return []any{strings.TrimPrefix(prefix, RecordPrefix)}, true
+		},
+		extract: extractRecord,
+	}
+
+	typedTables = []*typedTable{requestTable, planTable, recordTable}
+)
+
+func exactScope(tablePrefix string) func(prefix string) ([]any, bool) {
+	return func(prefix string) ([]any, bool) {
+		return nil, prefix == tablePrefix
+	}
+}
+
+// routeTable returns the typed table storing prefix along with the values of its leading key columns,
+// nil if prefix is stored in workflow_store
+func routeTable(prefix string) (*typedTable, []any) {
+	for _, t := range typedTables {
+		if scope, ok := t.scope(prefix); ok {
+			return t, scope
+		}
+	}
+	return nil, nil
+}
+
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+func extractRequest(value []byte) []any {
+	info := &types.RequestInfo{}
+	if err := json.Unmarshal(value, info); err != nil {
+		return nil
+	}
+	var labels any
+	if len(info.Labels) > 0 {
+		b, err := json.Marshal(info.Labels)
+		if err != nil {
+			return nil
+		}
+		labels = string(b)
+	}
+	return []any{info.DAGName, info.Tenant, int64(info.Status), info.CurrentVertex, labels,
+		nullTime(info.CreateTime), nullTime(info.UpdateTime)}
+}
+
+func extractPlan(value []byte) []any {
+	plan := &struct{ Name string }{}
+	if err := json.Unmarshal(value, plan); err != nil {
+		return nil
+	}
+	return []any{plan.Name}
+}
+
+func extractRecord(value []byte) []any {
+	record := &struct {
+		StartTime time.Time
+		EndTime   time.Time
+		Error     string
+	}{}
+	if err := json.Unmarshal(value, record); err != nil {
+		return nil
+	}
+	var recordErr any
+	if record.Error != "" {
+		recordErr = record.Error
+	}
+	return []any{nullTime(record.StartTime), nullTime(record.EndTime), recordErr}
+}
+
+// splitValue returns the value for the data column if it is JSON, otherwise for the value column
+func splitValue(value []byte) (any, []byte) {
+	// JSONB refuses the NUL character, such values are kept as bytes
+	if value != nil && json.Valid(value) && !bytes.Contains(value, []byte(`\u0000`)) {
+		return string(value), nil
+	}
+	return nil, value
+}
+
+// joinValue returns the value stored in either the data or the value column
+func joinValue(data sql.NullString, value []byte) []byte {
+	if data.Valid {
+		return []byte(data.String)
+	}
+	return value
+}
+
+// where returns the condition on the key columns, the placeholders start from $first
+func (t *typedTable) where(first int) string {
+	conds := make([]string, len(t.keyColumns))
+	for i, column := range t.keyColumns {
+		conds[i] = fmt.Sprintf("%s = $%d", column, first+i)
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// scopeWhere returns the condition on the leading key columns, the placeholders start from $1
+func (t *typedTable) scopeWhere() string {
+	conds := []string{"TRUE"}
+	for i, column := range t.keyColumns[:len(t.keyColumns)-1] {
+		conds = append(conds, fmt.Sprintf("%s = $%d", column, i+1))
+	}
+	return strings.Join(conds, " AND ")
+}
+
+func (t *typedTable) keyColumn() string {
+	return t.keyColumns[len(t.keyColumns)-1]
+}
+
+// valueColumns returns the written columns and their values, starting with the key columns
+func (t *typedTable) valueColumns(scope []any, key string, value []byte) ([]string, []any) {
+	data, raw := splitValue(value)
+	var extracted []any
+	if data != nil {
+		extracted = t.extract(value)
+	}
+	if extracted == nil {
+		extracted = make([]any, len(t.columns))
+	}
+
+	columns := make([]string, 0, len(t.keyColumns)+len(t.columns)+2)
+	columns = append(append(append(columns, t.keyColumns...), t.columns...), "data", "value")
+	args := make([]any, 0, len(columns))
+	args = append(append(append(args, scope...), key), extracted...)
+	args = append(args, data, raw)
+	return columns, args
+}
+
+func placeholders(from, n int) string {
+	p := make([]string, n)
+	for i := range p {
+		p[i] = fmt.Sprintf("$%d", from+i)
+	}
+	return strings.Join(p, ", ")
+}
+
+// updateSet returns the assignments of the non-key columns from EXCLUDED
+func (t *typedTable) updateSet(columns []string) string {
+	sets := make([]string, 0, len(columns))
+	for _, column := range columns[len(t.keyColumns):] {
+		sets = append(sets, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+	return strings.Join(sets, ", ")
+}
+
+func (t *typedTable) get(ctx context.Context, db execer, scope []any, key string) ([]byte, int64, error) {
+	query := fmt.Sprintf(`SELECT data, value, version FROM %s WHERE %s`, t.name, t.where(1))
+
+	var data sql.NullString
+	var value []byte
+	var version int64
+	err := db.QueryRowContext(ctx, query, append(scope, key)...).Scan(&data, &value, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, 0, nil
+		}
+		return nil, 0, errors.Annotatef(err, "failed to get value from %s for key=%s", t.name, key)
+	}
+	return joinValue(data, value), version, nil
+}
+
+func (t *typedTable) set(ctx context.Context, db execer, scope []any, key string, value []byte) error {
+	columns, args := t.valueColumns(scope, key, value)
+	query := fmt.Sprintf(`
+		INSERT INTO %s (%s) VALUES (%s)
+		ON CONFLICT (%s)
+		DO UPDATE SET %s, updated_at = CURRENT_TIMESTAMP, version = nextval('workflow_store_version_seq')
+	`, t.name, strings.Join(columns, ", "), placeholders(1, len(columns)),
+		strings.Join(t.keyColumns, ", "), t.updateSet(columns))
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return errors.Annotatef(err, "failed to set value in %s for key=%s", t.name, key)
+}
+
+// insert writes a value with the given version, used to move the key-value rows
+func (t *typedTable) insert(ctx context.Context, db execer, prefix, key string, value []byte, version int64) error {
+	scope, _ := t.scope(prefix)
+	columns, args := t.valueColumns(scope, key, value)
+	columns = append(columns, "version")
+	args = append(args, version)
+	query := fmt.Sprintf(`
+		INSERT INTO %s (%s) VALUES (%s)
+		ON CONFLICT (%s)
+		DO UPDATE SET %s, updated_at = CURRENT_TIMESTAMP
+	`, t.name, strings.Join(columns, ", "), placeholders(1, len(columns)),
+		strings.Join(t.keyColumns, ", "), t.updateSet(columns))
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return errors.Annotatef(err, "failed to insert value in %s for prefix=%s, key=%s", t.name, prefix, key)
+}
+
+func (t *typedTable) compareAndSet(ctx context.Context, db execer, scope []any, key string, value []byte, version int64) (int64, error) {
+	columns, args := t.valueColumns(scope, key, value)
+	var query string
+	if version == 0 {
+		query = fmt.Sprintf(`
+			INSERT INTO %s (%s) VALUES (%s)
+			ON CONFLICT (%s) DO NOTHING
+			RETURNING version
+		`, t.name, strings.Join(columns, ", "), placeholders(1, len(columns)), strings.Join(t.keyColumns, ", "))
+	} else {
+		sets := make([]string, 0, len(columns))
+		for i, column := range columns[len(t.keyColumns):] {
+			sets = append(sets, fmt.Sprintf("%s = $%d", column, len(t.keyColumns)+i+1))
+		}
+		query = fmt.Sprintf(`
+			UPDATE %s SET %s, updated_at = CURRENT_TIMESTAMP, version = nextval('workflow_store_version_seq')
+			WHERE %s AND version = $%d
+			RETURNING version
+		`, t.name, strings.Join(sets, ", "), t.where(1), len(columns)+1)
+		args = append(args, version)
+	}
+
+	var newVersion int64
+	err := db.QueryRowContext(ctx, query, args...).Scan(&newVersion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, store.ErrVersionConflict
+		}
+		return 0, errors.Annotatef(err, "failed to compare and set value in %s for key=%s", t.name, key)
+	}
+	return newVersion, nil
+}
+
+// remove deletes the row, only if its version equals version unless it is 0, it returns false if nothing is removed
+func (t *typedTable) remove(ctx context.Context, db execer, scope []any, key string, version int64) (bool, error) {
+	query := fmt.Sprintf(`DELETE FROM %s WHERE %s`, t.name, t.where(1))
+	args := append(scope, key)
+	if version != 0 {
+		query += fmt.Sprintf(` AND version = $%d`, len(args)+1)
+		args = append(args, version)
+	}
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, errors.Annotatef(err, "failed to remove value from %s for key=%s", t.name, key)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return n > 0, nil
+}
+
+func (t *typedTable) list(ctx context.Context, db queryer, scope []any, iterator func(key string) bool) error {
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE %s ORDER BY %s COLLATE "C"`,
+		t.keyColumn(), t.name, t.scopeWhere(), t.keyColumn())
+
+	rows, err := db.QueryContext(ctx, query, scope...)
+	if err != nil {
+		return errors.Annotatef(err, "failed to list keys of %s", t.name)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return errors.Annotatef(err, "failed to scan key")
+		}
+		if !iterator(key) {
+			break
+		}
+	}
+	return errors.Annotatef(rows.Err(), "error iterating rows")
+}
+
+func (t *typedTable) scan(ctx context.Context, db queryer, scope []any, afterKey string, iterator func(key string, value []byte) bool) error {
+	query := fmt.Sprintf(`SELECT %s, data, value FROM %s WHERE %s AND %s COLLATE "C" > $%d ORDER BY %s COLLATE "C"`,
+		t.keyColumn(), t.name, t.scopeWhere(), t.keyColumn(), len(scope)+1, t.keyColumn())
+
+	rows, err := db.QueryContext(ctx, query, append(scope, afterKey)...)
+	if err != nil {
+		return errors.Annotatef(err, "failed to scan %s", t.name)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var data sql.NullString
+		var value []byte
+		if err := rows.Scan(&key, &data, &value); err != nil {
+			return errors.Annotatef(err, "failed to scan row")
+		}
+		if !iterator(key, joinValue(data, value)) {
+			break
+		}
+	}
+	return errors.Annotatef(rows.Err(), "error iterating rows")
+}
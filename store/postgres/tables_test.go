@@ -0,0 +1,186 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/types"
+)
+
+func TestRouteTable(t *testing.T) {
+	table, scope := routeTable(RequestPrefix)
+	assert.Equal(t, requestTable, table)
+	assert.Nil(t, scope)
+
+	table, scope = routeTable(RecordPrefix + "req-1")
+	assert.Equal(t, recordTable, table)
+	assert.Equal(t, []any{"req-1"}, scope)
+
+	for _, prefix := range []string{"/request/sub/", "/run_context/", "/lease/"} {
+		table, _ = routeTable(prefix)
+		assert.Nil(t, table, prefix)
+	}
+}
+
+func TestSplitValue(t *testing.T) {
+	data, raw := splitValue([]byte(`{"k":"v"}`))
+	assert.Equal(t, `{"k":"v"}`, data)
+	assert.Nil(t, raw)
+
+	for _, value := range [][]byte{{0x00, 'W', 'F', 'E'}, []byte(`{"k":"\u0000"}`)} {
+		data, raw = splitValue(value)
+		assert.Nil(t, data)
+		assert.Equal(t, value, raw)
+	}
+}
+
+func TestExtractRequest(t *testing.T) {
+	now := time.Now()
+	columns := extractRequest([]byte(`{"RequestID":"req-1","DAGName":"dag","Labels":{"k":"v"},"Status":3,"CreateTime":"` +
+		now.Format(time.RFC3339Nano) + `"}`))
+	assert.Equal(t, len(requestTable.columns), len(columns))
+	assert.Equal(t, "dag", columns[0])
+	assert.Equal(t, int64(3), columns[2])
+	assert.Equal(t, `{"k":"v"}`, columns[4])
+	assert.True(t, now.Equal(columns[5].(time.Time)))
+	assert.Nil(t, columns[6])
+
+	assert.Nil(t, extractRequest([]byte(`[]`)))
+}
+
+func TestRequestQuery(t *testing.T) {
+	query, args, err := requestQuery(&types.RequestFilter{}, nil)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, "WHERE data IS NOT NULL"))
+	assert.Empty(t, args)
+
+	query, args, err = requestQuery(&types.RequestFilter{
+		DAGName:       "dag",
+		Statuses:      []types.StatusType{types.Pending, types.Running},
+		Labels:        map[string]string{"k": "v"},
+		CreatedBefore: time.Now(),
+	}, nil)
+	assert.Nil(t, err)
+	assert.Contains(t, query, "dag_name = $1")
+	assert.Contains(t, query, "status = ANY($2)")
+	assert.Contains(t, query, "labels @> $3::jsonb")
+	assert.Contains(t, query, "create_time <= $4")
+	assert.NotContains(t, query, "ORDER BY")
+	assert.Equal(t, 4, len(args))
+
+	// the first page
+	query, args, err = requestQuery(&types.RequestFilter{DAGName: "dag"}, &types.RequestPage{Limit: 11})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, "WHERE data IS NOT NULL AND dag_name = $1 "+
+		"ORDER BY create_time ASC NULLS FIRST, request_id ASC LIMIT 11"))
+	assert.Equal(t, 1, len(args))
+
+	// the next pages
+	after := time.Now()
+	query, args, err = requestQuery(&types.RequestFilter{DAGName: "dag"}, &types.RequestPage{
+		SortBy: types.SortByUpdateTime, Descending: true, AfterTime: after, AfterRequestID: "req-1", Limit: 11,
+	})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, "AND ((update_time, request_id) < ($2, $3) OR update_time IS NULL) "+
+		"ORDER BY update_time DESC NULLS LAST, request_id DESC LIMIT 11"))
+	assert.Equal(t, []any{"dag", after, "req-1"}, args)
+
+	query, args, err = requestQuery(&types.RequestFilter{}, &types.RequestPage{AfterRequestID: "req-1"})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, "AND (create_time IS NOT NULL OR request_id > $1) "+
+		"ORDER BY create_time ASC NULLS FIRST, request_id ASC"))
+	assert.Equal(t, []any{"req-1"}, args)
+
+	query, args, err = requestQuery(&types.RequestFilter{}, &types.RequestPage{SortBy: types.SortByRequestID, AfterRequestID: "req-1", Limit: 2})
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(query, "AND request_id > $1 ORDER BY request_id ASC LIMIT 2"))
+	assert.Equal(t, []any{"req-1"}, args)
+}
+
+func TestPostgresStore_TypedTables(t *testing.T) {
+	s := skipIfNoPostgres(t)
+	if s == nil {
+		return
+	}
+	p := s.(*pgStore)
+	defer p.Close()
+
+	ctx := context.Background()
+	defer s.Remove(ctx, RequestPrefix, "typed-1")
+	defer s.Remove(ctx, RequestPrefix, "typed-2")
+	defer s.Remove(ctx, RecordPrefix+"typed-1", "dag.node1")
+
+	now := time.Now()
+	for i, status := range []types.StatusType{types.Running, types.Finished} {
+		requestID := fmt.Sprintf("typed-%d", i+1)
+		info := fmt.Sprintf(`{"RequestID":%q,"DAGName":"typed","Tenant":"t1","Labels":{"k":"v"},"Status":%d,`+
+			`"CreateTime":%q,"UpdateTime":%q}`, requestID, status, now.Format(time.RFC3339Nano), now.Format(time.RFC3339Nano))
+		assert.Nil(t, s.Set(ctx, RequestPrefix, requestID, []byte(info)))
+	}
+
+	var status int
+	var dagName string
+	query := `SELECT status, dag_name FROM workflow_requests WHERE request_id = $1`
+	assert.Nil(t, p.db.QueryRowContext(ctx, query, "typed-2").Scan(&status, &dagName))
+	assert.Equal(t, int(types.Finished), status)
+	assert.Equal(t, "typed", dagName)
+
+	ids := make([]string, 0)
+	assert.Nil(t, p.QueryRequests(ctx, &types.RequestFilter{
+		DAGName:      "typed",
+		Statuses:     []types.StatusType{types.Running},
+		Labels:       map[string]string{"k": "v"},
+		CreatedAfter: now.Add(-time.Minute),
+	}, nil, func(requestID string, value []byte) bool {
+		ids = append(ids, requestID)
+		return true
+	}))
+	assert.Equal(t, []string{"typed-1"}, ids)
+
+	// paged by the keyset
+	ids = ids[:0]
+	assert.Nil(t, p.QueryRequests(ctx, &types.RequestFilter{DAGName: "typed"}, &types.RequestPage{
+		Descending: true, AfterTime: now.Truncate(time.Microsecond), AfterRequestID: "typed-2", Limit: 1,
+	}, func(requestID string, value []byte) bool {
+		ids = append(ids, requestID)
+		return true
+	}))
+	assert.Equal(t, []string{"typed-1"}, ids)
+
+	keys := make([]string, 0)
+	assert.Nil(t, s.List(ctx, RequestPrefix, func(key string) bool {
+		if strings.HasPrefix(key, "typed-") {
+			keys = append(keys, key)
+		}
+		return true
+	}))
+	assert.Equal(t, []string{"typed-1", "typed-2"}, keys)
+
+	// the records are versioned and batched along with the key-value rows
+	txStore := s.(store.TxStore)
+	version, err := txStore.CompareAndSet(ctx, RecordPrefix+"typed-1", "dag.node1", []byte(`{"Error":""}`), 0)
+	assert.Nil(t, err)
+	_, err = txStore.CompareAndSet(ctx, RecordPrefix+"typed-1", "dag.node1", []byte(`{}`), 0)
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+	err = txStore.Batch(ctx, []store.Op{
+		store.RemoveOp(RequestPrefix, "typed-2"),
+		{Type: store.OpSet, Prefix: RecordPrefix + "typed-1", Key: "dag.node1", Value: []byte(`{}`), Version: version + 1000},
+	})
+	assert.True(t, errors.Is(err, store.ErrVersionConflict))
+	value, err := s.Get(ctx, RequestPrefix, "typed-2")
+	assert.Nil(t, err)
+	assert.NotNil(t, value)
+
+	scanned := make([]string, 0)
+	assert.Nil(t, s.(store.Scanner).Scan(ctx, RecordPrefix+"typed-1", "", func(key string, value []byte) bool {
+		scanned = append(scanned, key)
+		return true
+	}))
+	assert.Equal(t, []string{"dag.node1"}, scanned)
+}
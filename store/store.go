@@ -1,12 +1,17 @@
 package store
 
-import "context"
+import (
+	"context"
+	"sort"
+
+	"github.com/juju/errors"
+)
 
 type Store interface {
 	Get(ctx context.Context, prefix, key string) ([]byte, error)
 	Set(ctx context.Context, prefix, key string, value []byte) error
 	/**
-	 * Remove a prefix and key
+	 * Remove a prefix and key, the values appended to the prefix and key are removed as well.
 	 * remove an unexists prefix + key would NOT return error
 	 */
 	Remove(ctx context.Context, prefix, key string) error
@@ -14,7 +19,156 @@ type Store interface {
 	List(ctx context.Context, prefix string, iterator func(key string) bool) error
 
 	/**
+	 * Append adds the value to the end of the list under prefix and key,
+	 * the list is independent from the value set by Set.
+	 */
 	Append(ctx context.Context, prefix, key string, value []byte) error
+	/**
+	 * ListAppend iterates the appended values in the order of appending.
+	 */
 	ListAppend(ctx context.Context, prefix, key string, iterator func(value []byte) bool) error
-	*/
+}
+
+/**
+ * Scanner is an optional interface of Store, it iterates the keys along with the values
+ * under the prefix in key order, starting after afterKey(empty means from the beginning),
+ * so that the caller need not to Get each key after List.
+ */
+type Scanner interface {
+	Scan(ctx context.Context, prefix, afterKey string, iterator func(key string, value []byte) bool) error
+}
+
+/**
+ * Scan iterates the values under the prefix with Scanner if the store supports,
+ * otherwise it falls back to List and Get.
+ */
+func Scan(ctx context.Context, s Store, prefix, afterKey string, iterator func(key string, value []byte) bool) error {
+	if scanner, ok := s.(Scanner); ok {
+		return scanner.Scan(ctx, prefix, afterKey, iterator)
+	}
+
+	keys := make([]string, 0)
+	err := s.List(ctx, prefix, func(key string) bool {
+		if key > afterKey {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return errors.Trace(err)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := s.Get(ctx, prefix, key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if value == nil {
+			continue
+		}
+		if !iterator(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+const (
+	ErrVersionConflict = errors.ConstError("version conflict")
+)
+
+type OpType int
+
+const (
+	OpSet    OpType = 1
+	OpRemove OpType = 2
+)
+
+/**
+ * Op is an operation of a Batch.
+ * If Version is not 0, the op applies only when the current version of the key equals it.
+ */
+type Op struct {
+	Type    OpType
+	Prefix  string
+	Key     string
+	Value   []byte
+	Version int64
+}
+
+func SetOp(prefix, key string, value []byte) Op {
+	return Op{Type: OpSet, Prefix: prefix, Key: key, Value: value}
+}
+
+func RemoveOp(prefix, key string) Op {
+	return Op{Type: OpRemove, Prefix: prefix, Key: key}
+}
+
+/**
+ * TxStore is an optional interface of Store, it supports the versioned values and atomic batches.
+ * The version of a key changes on every Set, and it is never reused for the key after Remove.
+ */
+type TxStore interface {
+	// GetVersion returns the value along with the version, the version is 0 if the key does not exist.
+	GetVersion(ctx context.Context, prefix, key string) ([]byte, int64, error)
+	/**
+	 * CompareAndSet sets the value only if the current version equals version,
+	 * version 0 means the key is supposed not to exist.
+	 * It returns the new version, or ErrVersionConflict if the version mismatched.
+	 */
+	CompareAndSet(ctx context.Context, prefix, key string, value []byte, version int64) (int64, error)
+	/**
+	 * Batch applies all of the ops or none of them,
+	 * it returns ErrVersionConflict if any version check of the ops failed.
+	 */
+	Batch(ctx context.Context, ops []Op) error
+}
+
+/**
+ * Batch applies the ops atomically with TxStore if the store supports,
+ * otherwise it applies them one by one, which is not atomic, and the version checks are not supported.
+ */
+func Batch(ctx context.Context, s Store, ops []Op) error {
+	if txStore, ok := s.(TxStore); ok {
+		return txStore.Batch(ctx, ops)
+	}
+
+	for _, op := range ops {
+		if op.Version != 0 {
+			return errors.NotSupportedf("version check of %s %s", op.Prefix, op.Key)
+		}
+	}
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case OpSet:
+			err = s.Set(ctx, op.Prefix, op.Key, op.Value)
+		case OpRemove:
+			err = s.Remove(ctx, op.Prefix, op.Key)
+		default:
+			err = errors.NotSupportedf("op type %d", op.Type)
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+/**
+ * Flusher is an optional interface of Store buffering the writes, Flush persists all of the writes buffered.
+ */
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+/**
+ * Flush persists the buffered writes if the store is a Flusher, otherwise it does nothing.
+ */
+func Flush(ctx context.Context, s Store) error {
+	if flusher, ok := s.(Flusher); ok {
+		return errors.Trace(flusher.Flush(ctx))
+	}
+	return nil
 }
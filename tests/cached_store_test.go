@@ -0,0 +1,44 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/runtime"
+	"github.com/warriorguo/workflow/store/cache"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+	"github.com/warriorguo/workflow/utils"
+)
+
+func TestCachedStoreFlushOnPause(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	config := cache.DefaultConfig()
+	config.Mode = cache.WriteBack
+	config.FlushInterval = time.Hour
+	s, err := cache.NewCachedStore(inner, config)
+	assert.Nil(t, err)
+
+	options := types.NewFlowOptions()
+	types.DisableAutoStart()(options)
+	types.DisableTaskRunAsync()(options)
+	flowengine := runtime.NewFlowEngine(s, options)
+	assert.Nil(t, flowengine.RegisterDAG("linear", linearDAG))
+
+	assert.Nil(t, flowengine.RunDAG(ctx, "linear", "req-1", types.Data{}))
+	assert.Nil(t, flowengine.RunOnce())
+	assert.Nil(t, flowengine.PauseRequest(ctx, "req-1"))
+
+	// the paused request is persisted in the underlying store
+	b, err := inner.Get(ctx, runtime.RunContextPath, "req-1")
+	assert.Nil(t, err)
+	assert.NotNil(t, b)
+	b, err = inner.Get(ctx, runtime.RequestInfoPath, "req-1")
+	assert.Nil(t, err)
+	info := &types.RequestInfo{}
+	assert.Nil(t, utils.Unserialize(b, info))
+	assert.Equal(t, types.Paused, info.Status)
+}
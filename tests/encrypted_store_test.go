@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/runtime"
+	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/crypt"
+	"github.com/warriorguo/workflow/store/mem"
+	"github.com/warriorguo/workflow/types"
+)
+
+func newEncryptedEngine(t *testing.T, s store.Store) types.FlowEngine {
+	options := types.NewFlowOptions()
+	types.DisableAutoStart()(options)
+	types.DisableTaskRunAsync()(options)
+	flowengine := runtime.NewFlowEngine(s, options)
+	assert.Nil(t, flowengine.RegisterDAG("linear", linearDAG))
+	return flowengine
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	inner := mem.NewMemStore()
+	oldKey, newKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+
+	provider, err := crypt.NewStaticKeyProvider("old", map[string][]byte{"old": oldKey})
+	assert.Nil(t, err)
+	flowengine := newEncryptedEngine(t, crypt.NewEncryptedStore(inner, provider))
+	assert.Nil(t, flowengine.RunDAG(ctx, "linear", "req-1", types.Data{"account": "123"}))
+	for i := 0; i < 2; i++ {
+		assert.Nil(t, flowengine.RunOnce())
+	}
+
+	rotated, err := crypt.NewStaticKeyProvider("new", map[string][]byte{"old": oldKey, "new": newKey})
+	assert.Nil(t, err)
+	prefixes, err := runtime.StorePrefixes(ctx, inner)
+	assert.Nil(t, err)
+	report, err := crypt.Reencrypt(ctx, inner, rotated, prefixes)
+	assert.Nil(t, err)
+	assert.True(t, report.Reencrypted > 0)
+	_, err = crypt.ReencryptAppended(ctx, inner, rotated, runtime.HistoryPath, "req-1")
+	assert.Nil(t, err)
+
+	// readable without the old key
+	provider, err = crypt.NewStaticKeyProvider("new", map[string][]byte{"new": newKey})
+	assert.Nil(t, err)
+	flowengine = newEncryptedEngine(t, crypt.NewEncryptedStore(inner, provider))
+	result, err := flowengine.GetRequestResult(ctx, "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, result.Status)
+	assert.Equal(t, "123", result.Result["account"])
+	assert.Equal(t, 2, len(result.NodeTraceData))
+
+	history, err := flowengine.GetRequestHistory(ctx, "req-1", 0, 0)
+	assert.Nil(t, err)
+	assert.True(t, len(history.Events) > 0)
+}
@@ -0,0 +1,56 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	workflowengine "github.com/warriorguo/workflow"
+	"github.com/warriorguo/workflow/types"
+)
+
+func linearDAG(dag types.DAG) error {
+	if err := dag.Node("node1", dumbNode); err != nil {
+		return err
+	}
+	if err := dag.Node("node2", dumbNode); err != nil {
+		return err
+	}
+	return dag.Edge("node1", "node2")
+}
+
+func newFileStoreEngine(t *testing.T, dir string) types.FlowEngine {
+	flowengine, err := workflowengine.NewFlowEngine(
+		types.WithFileStoreConfig(&types.FileStoreConfig{Dir: dir}),
+		types.DisableAutoStart(),
+		types.DisableTaskRunAsync(),
+	)
+	assert.Nil(t, err)
+	assert.Nil(t, flowengine.RegisterDAG("linear", linearDAG))
+	return flowengine
+}
+
+func TestFileStoreEngine(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	flowengine := newFileStoreEngine(t, dir)
+	assert.Nil(t, flowengine.RunDAG(ctx, "linear", "req-1", types.Data{"k": "v"}))
+	assert.Nil(t, flowengine.RunOnce())
+	assert.Nil(t, flowengine.Close(ctx))
+
+	// the request goes on after the restart
+	flowengine = newFileStoreEngine(t, dir)
+	defer flowengine.Close(ctx)
+	errs, err := flowengine.ReloadRequests(ctx)
+	assert.Nil(t, err)
+	for _, err := range errs {
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, flowengine.RunOnce())
+
+	status, err := flowengine.GetRequestStatus(ctx, "req-1")
+	assert.Nil(t, err)
+	assert.Equal(t, types.Finished, status.Status)
+	assert.Equal(t, "v", status.Result["k"])
+}
@@ -0,0 +1,16 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/runtime"
+	"github.com/warriorguo/workflow/store/postgres"
+)
+
+// the typed tables of the postgres store are chosen by the prefixes written by the runtime
+func TestPostgresTablePrefixes(t *testing.T) {
+	assert.Equal(t, runtime.RequestInfoPath, postgres.RequestPrefix)
+	assert.Equal(t, runtime.DAGPlanPath, postgres.PlanPrefix)
+	assert.Equal(t, runtime.RecordPath, postgres.RecordPrefix)
+}
@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const (
+	traceparentVersion = "00"
+	flagSampled        = 0x01
+	// the length of a traceparent of version 00
+	traceparentLength = 55
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func NewTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func NewSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// IsValid returns false for the all-zero ID, which is invalid by W3C Trace Context
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+/**
+ * SpanContext identifies a span across the processes,
+ * it is propagated as the W3C traceparent, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+ */
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns the traceparent of the span context, empty if it is invalid
+func (sc SpanContext) Traceparent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	var flags byte
+	if sc.Sampled {
+		flags |= flagSampled
+	}
+	return fmt.Sprintf("%s-%s-%s-%02x", traceparentVersion, sc.TraceID, sc.SpanID, flags)
+}
+
+/**
+ * ParseTraceparent parses the W3C traceparent, the fields appended by the later versions are ignored.
+ * It returns a NotValid error if the traceparent is malformed.
+ */
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	sc := SpanContext{}
+	if len(traceparent) < traceparentLength {
+		return sc, errors.NotValidf("traceparent %q", traceparent)
+	}
+	version := traceparent[:2]
+	if !isLowerHex(version) || version == "ff" ||
+		(version == traceparentVersion && len(traceparent) != traceparentLength) ||
+		(len(traceparent) > traceparentLength && traceparent[traceparentLength] != '-') {
+		return sc, errors.NotValidf("traceparent %q", traceparent)
+	}
+	fields := strings.SplitN(traceparent[:traceparentLength], "-", 4)
+	if len(fields) != 4 || len(fields[1]) != 32 || len(fields[2]) != 16 || len(fields[3]) != 2 {
+		return sc, errors.NotValidf("traceparent %q", traceparent)
+	}
+	for _, field := range fields[1:] {
+		if !isLowerHex(field) {
+			return sc, errors.NotValidf("traceparent %q", traceparent)
+		}
+	}
+	_, _ = hex.Decode(sc.TraceID[:], []byte(fields[1]))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(fields[2]))
+	flags, _ := hex.DecodeString(fields[3])
+	sc.Sampled = flags[0]&flagSampled != 0
+	if !sc.IsValid() {
+		return SpanContext{}, errors.NotValidf("traceparent %q with zero ID", traceparent)
+	}
+	return sc, nil
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type spanContextKey struct{}
+
+/**
+ * ContextWithSpanContext returns the context carrying the span context,
+ * the request run by RunDAG with the context becomes a child of the span.
+ */
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, an invalid one if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(value)
+	assert.Nil(t, err)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.Equal(t, value, sc.Traceparent())
+
+	sc, err = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.Nil(t, err)
+	assert.False(t, sc.Sampled)
+	// the fields of the later versions are ignored
+	sc, err = ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.Nil(t, err)
+	assert.True(t, sc.IsValid())
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(invalid)
+		assert.True(t, errors.Is(err, errors.NotValid), invalid)
+	}
+	assert.Equal(t, "", SpanContext{}.Traceparent())
+
+	ctx := ContextWithSpanContext(context.Background(), sc)
+	assert.Equal(t, sc, SpanContextFromContext(ctx))
+	assert.False(t, SpanContextFromContext(context.Background()).IsValid())
+}
+
+func TestTracer(t *testing.T) {
+	exporter := NewInMemoryExporter()
+	tracer := NewTracer(exporter)
+
+	root := tracer.Start(SpanContext{}, "root", WithAttributes(Attr("k", "v")))
+	child := tracer.Start(root.SpanContext(), "child")
+	child.SetAttributes(Attr("n", 1))
+	child.End(errors.New("broken"))
+	child.End(nil)
+	root.End(nil)
+
+	spans := exporter.Spans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, root.SpanContext().TraceID, spans[0].SpanContext.TraceID)
+	assert.Equal(t, root.SpanContext(), spans[0].Parent)
+	assert.Equal(t, StatusError, spans[0].Status)
+	assert.Equal(t, "broken", spans[0].StatusMessage)
+	assert.Equal(t, 1, spans[0].Attributes["n"])
+	assert.Equal(t, StatusOK, spans[1].Status)
+	assert.Equal(t, "v", spans[1].Attributes["k"])
+	assert.False(t, spans[1].Parent.IsValid())
+	assert.True(t, spans[1].SpanContext.Sampled)
+
+	// a span continued keeps its context and start time
+	continued := tracer.Start(SpanContext{}, "root", WithSpanContext(root.SpanContext()), WithStartTime(spans[1].StartTime))
+	continued.End(nil)
+	assert.Equal(t, root.SpanContext(), exporter.Spans()[2].SpanContext)
+	assert.Equal(t, spans[1].StartTime, exporter.Spans()[2].StartTime)
+
+	// the children of an unsampled parent are not exported
+	exporter.Reset()
+	unsampled := SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID()}
+	tracer.Start(unsampled, "dropped").End(nil)
+	assert.Empty(t, exporter.Spans())
+}
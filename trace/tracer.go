@@ -0,0 +1,209 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+/**
+ * Span is a unit of work of a trace, e.g. a request or a run of a vertex.
+ * A span is ended once, the calls after End are ignored.
+ */
+type Span interface {
+	SpanContext() SpanContext
+	SetAttributes(attrs ...Attribute)
+	// End ends the span with the status error if err is not nil, otherwise OK
+	End(err error)
+}
+
+/**
+ * Tracer starts the spans, it is the extension point to the tracing systems,
+ * e.g. an adapter of OpenTelemetry, see NewTracer for the one exporting to an Exporter.
+ */
+type Tracer interface {
+	// Start starts a span as the child of parent, or the root of a new trace if parent is invalid
+	Start(parent SpanContext, name string, opts ...StartOption) Span
+}
+
+type StartConfig struct {
+	StartTime time.Time
+	/**
+	 * SpanContext continues the span started before with the context instead of a new one,
+	 * e.g. the span of a request reloaded by another process.
+	 */
+	SpanContext SpanContext
+	Attributes  []Attribute
+}
+
+type StartOption func(config *StartConfig)
+
+func NewStartConfig(opts ...StartOption) *StartConfig {
+	config := &StartConfig{}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.StartTime.IsZero() {
+		config.StartTime = time.Now()
+	}
+	return config
+}
+
+func WithStartTime(startTime time.Time) StartOption {
+	return func(config *StartConfig) {
+		config.StartTime = startTime
+	}
+}
+
+func WithSpanContext(sc SpanContext) StartOption {
+	return func(config *StartConfig) {
+		config.SpanContext = sc
+	}
+}
+
+func WithAttributes(attrs ...Attribute) StartOption {
+	return func(config *StartConfig) {
+		config.Attributes = append(config.Attributes, attrs...)
+	}
+}
+
+/**
+ * SpanData is the span ended, which is given to the Exporter
+ */
+type SpanData struct {
+	Name          string
+	SpanContext   SpanContext
+	Parent        SpanContext
+	StartTime     time.Time
+	EndTime       time.Time
+	Attributes    map[string]any
+	Status        StatusCode
+	StatusMessage string
+}
+
+type Exporter interface {
+	// ExportSpan is invoked once the span is ended, it must not block
+	ExportSpan(span *SpanData)
+}
+
+/**
+ * NewTracer returns the tracer exporting the sampled spans to the exporter once they are ended,
+ * the root spans are always sampled, and the children follow the sampling decisions of their parents.
+ */
+func NewTracer(exporter Exporter) Tracer {
+	return &tracer{exporter: exporter}
+}
+
+type tracer struct {
+	exporter Exporter
+}
+
+func (t *tracer) Start(parent SpanContext, name string, opts ...StartOption) Span {
+	config := NewStartConfig(opts...)
+	sc := config.SpanContext
+	if !sc.IsValid() {
+		sc = SpanContext{TraceID: parent.TraceID, SpanID: NewSpanID(), Sampled: parent.Sampled}
+		if !parent.IsValid() {
+			sc.TraceID, sc.Sampled = NewTraceID(), true
+		}
+	}
+
+	s := &span{exporter: t.exporter}
+	s.data = &SpanData{
+		Name:        name,
+		SpanContext: sc,
+		Parent:      parent,
+		StartTime:   config.StartTime,
+		Attributes:  make(map[string]any, len(config.Attributes)),
+	}
+	s.SetAttributes(config.Attributes...)
+	return s
+}
+
+type span struct {
+	mu       sync.Mutex
+	exporter Exporter
+	data     *SpanData
+	ended    bool
+}
+
+func (s *span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+func (s *span) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *span) End(err error) {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.EndTime = time.Now()
+	s.data.Status = StatusOK
+	if err != nil {
+		s.data.Status, s.data.StatusMessage = StatusError, err.Error()
+	}
+	s.mu.Unlock()
+
+	if s.exporter != nil && s.data.SpanContext.Sampled {
+		s.exporter.ExportSpan(s.data)
+	}
+}
+
+/**
+ * InMemoryExporter keeps the spans exported in memory, which is for the tests
+ */
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*SpanData
+}
+
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+func (e *InMemoryExporter) ExportSpan(span *SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+}
+
+// Spans returns the spans exported in the order of ending
+func (e *InMemoryExporter) Spans() []*SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
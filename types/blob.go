@@ -0,0 +1,90 @@
+package types
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/juju/errors"
+)
+
+// blobRefKey is the key of the object standing for a BlobRef, e.g. {"$blob":{"Key":"...","Size":1048576}}
+const blobRefKey = "$blob"
+
+/**
+ * BlobRef stands for a large value of the Data offloaded to the blob store of the options,
+ * it is resolved by the getters of Data the first time, so the nodes not reading the value never load it.
+ */
+type BlobRef struct {
+	RequestID string
+	Key       string
+	// Size is the length of the value serialized
+	Size int
+
+	mu       sync.Mutex
+	resolve  func(ref *BlobRef) (any, error)
+	resolved bool
+	value    any
+}
+
+type blobRefJSON struct {
+	RequestID string
+	Key       string
+	Size      int
+}
+
+/**
+ * NewBlobRef returns the reference resolved by resolve, which is called once it succeeds
+ */
+func NewBlobRef(requestID, key string, size int, resolve func(ref *BlobRef) (any, error)) *BlobRef {
+	return &BlobRef{RequestID: requestID, Key: key, Size: size, resolve: resolve}
+}
+
+/**
+ * Value loads the value from the blob store
+ */
+func (r *BlobRef) Value() (any, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resolved {
+		return r.value, nil
+	}
+	if r.resolve == nil {
+		return nil, errors.NotSupportedf("blob %s of %s without blob store", r.Key, r.RequestID)
+	}
+	value, err := r.resolve(r)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	r.value, r.resolved = value, true
+	return value, nil
+}
+
+func (r *BlobRef) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]blobRefJSON{
+		blobRefKey: {RequestID: r.RequestID, Key: r.Key, Size: r.Size},
+	})
+}
+
+/**
+ * ParseBlobRef returns the reference if the value is the one decoded from the JSON of a BlobRef,
+ * the reference is resolved by resolve.
+ */
+func ParseBlobRef(value any, resolve func(ref *BlobRef) (any, error)) (*BlobRef, bool) {
+	m, ok := value.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	inner, ok := m[blobRefKey].(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	b, err := json.Marshal(inner)
+	if err != nil {
+		return nil, false
+	}
+	ref := blobRefJSON{}
+	if err := json.Unmarshal(b, &ref); err != nil || ref.Key == "" {
+		return nil, false
+	}
+	return NewBlobRef(ref.RequestID, ref.Key, ref.Size, resolve), true
+}
@@ -0,0 +1,58 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobRef(t *testing.T) {
+	loaded := 0
+	resolve := func(ref *BlobRef) (any, error) {
+		loaded++
+		if ref.Key == "missing" {
+			return nil, errors.NotFoundf("blob %s", ref.Key)
+		}
+		return map[string]any{"Name": "report"}, nil
+	}
+
+	d := Data{"report": NewBlobRef("req-1", "k1", 100, resolve), "n": 1}
+	b, err := json.Marshal(d)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"report":{"$blob":{"RequestID":"req-1","Key":"k1","Size":100}},"n":1}`, string(b))
+	assert.Equal(t, 0, loaded)
+
+	reloaded := Data{}
+	assert.Nil(t, json.Unmarshal(b, &reloaded))
+	_, ok := ParseBlobRef(reloaded["n"], resolve)
+	assert.False(t, ok)
+	ref, ok := ParseBlobRef(reloaded["report"], resolve)
+	assert.True(t, ok)
+	assert.Equal(t, "k1", ref.Key)
+	assert.Equal(t, 100, ref.Size)
+	reloaded["report"] = ref
+
+	// resolved by the getters once
+	v, exists := reloaded.Get("report")
+	assert.True(t, exists)
+	assert.Equal(t, map[string]any{"Name": "report"}, v)
+	s := struct{ Name string }{}
+	assert.Nil(t, reloaded.GetStruct("report", &s))
+	assert.Equal(t, "report", s.Name)
+	assert.Equal(t, 1, loaded)
+
+	missing := NewBlobRef("req-1", "missing", 1, resolve)
+	d = Data{"report": missing}
+	v, exists = d.Get("report")
+	assert.False(t, exists)
+	assert.Nil(t, v)
+	_, exists, err = d.Resolve("report")
+	assert.True(t, exists)
+	assert.True(t, errors.IsNotFound(err))
+	assert.True(t, errors.IsNotFound(d.GetStruct("report", &s)))
+
+	_, err = NewBlobRef("req-1", "k1", 1, nil).Value()
+	assert.True(t, errors.Is(err, errors.NotSupported))
+}
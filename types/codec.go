@@ -0,0 +1,385 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+/**
+ * DataCodec converts the Data to the form kept by JSON before it is persisted, and back after it is loaded,
+ * e.g. the run context, the trace records and the result of a request.
+ * Decode must accept the Data persisted before the codec was used, which is the plain JSON.
+ */
+type DataCodec interface {
+	Encode(d Data) (Data, error)
+	Decode(d Data) (Data, error)
+}
+
+/**
+ * jsonCodec keeps the Data as it is, so the values come back the way encoding/json decodes them,
+ * e.g. the numbers as float64 and the structs as map[string]any.
+ */
+type jsonCodec struct{}
+
+// NewJSONCodec returns the default codec, which keeps the Data as plain JSON
+func NewJSONCodec() DataCodec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) Encode(d Data) (Data, error) {
+	return d, nil
+}
+
+func (jsonCodec) Decode(d Data) (Data, error) {
+	return d, nil
+}
+
+const (
+	// the keys of the object standing for a tagged value, e.g. {"$type":"int64","$value":"42"}
+	tagTypeKey  = "$type"
+	tagValueKey = "$value"
+
+	tagInt      = "int"
+	tagInt8     = "int8"
+	tagInt16    = "int16"
+	tagInt32    = "int32"
+	tagInt64    = "int64"
+	tagUint     = "uint"
+	tagUint8    = "uint8"
+	tagUint16   = "uint16"
+	tagUint32   = "uint32"
+	tagUint64   = "uint64"
+	tagFloat32  = "float32"
+	tagTime     = "time"
+	tagDuration = "duration"
+	tagBytes    = "bytes"
+	tagData     = "Data"
+	// tagMap escapes a map having the tag keys itself
+	tagMap = "map"
+	// tagPointer prefixes the name of a registered type for the pointers to it
+	tagPointer = "*"
+)
+
+var builtinTags = map[string]bool{
+	tagInt: true, tagInt8: true, tagInt16: true, tagInt32: true, tagInt64: true,
+	tagUint: true, tagUint8: true, tagUint16: true, tagUint32: true, tagUint64: true,
+	tagFloat32: true, tagTime: true, tagDuration: true, tagBytes: true, tagData: true, tagMap: true,
+}
+
+/**
+ * TaggedCodec keeps the Go types of the values through JSON by tagging them,
+ * the integers of any size, float32, time.Time, time.Duration, []byte, the nested Data and the registered structs
+ * come back as they were. The float64, string, bool, []any and map[string]any values are kept as plain JSON,
+ * so are the other types, which come back the way encoding/json decodes them.
+ * A tagged value of a struct type not registered comes back as the plain JSON value.
+ */
+type TaggedCodec struct {
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+	names map[reflect.Type]string
+}
+
+func NewTaggedCodec() *TaggedCodec {
+	return &TaggedCodec{
+		types: make(map[string]reflect.Type),
+		names: make(map[reflect.Type]string),
+	}
+}
+
+/**
+ * Register makes the values of the struct type of value, and the pointers to them, come back as the type,
+ * the name is kept along with the values, so it has to stay the same across the versions of the program.
+ */
+func (c *TaggedCodec) Register(name string, value any) error {
+	t := reflect.TypeOf(value)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return errors.NotValidf("type %T, only structs can be registered", value)
+	}
+	if name == "" || builtinTags[name] || strings.HasPrefix(name, tagPointer) {
+		return errors.NotValidf("type name %q", name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if registered, exists := c.types[name]; exists && registered != t {
+		return errors.AlreadyExistsf("type name %q of %v", name, registered)
+	}
+	if registered, exists := c.names[t]; exists && registered != name {
+		return errors.AlreadyExistsf("type %v named %q", t, registered)
+	}
+	c.types[name] = t
+	c.names[t] = name
+	return nil
+}
+
+func tagged(name string, value any) map[string]any {
+	return map[string]any{tagTypeKey: name, tagValueKey: value}
+}
+
+func (c *TaggedCodec) Encode(d Data) (Data, error) {
+	if d == nil {
+		return nil, nil
+	}
+	encoded, err := c.encodeMap(d)
+	return Data(encoded), errors.Trace(err)
+}
+
+func (c *TaggedCodec) encodeMap(m map[string]any) (map[string]any, error) {
+	encoded := make(map[string]any, len(m))
+	for key, value := range m {
+		v, err := c.encodeValue(value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "key %s", key)
+		}
+		encoded[key] = v
+	}
+	return encoded, nil
+}
+
+func (c *TaggedCodec) encodeValue(value any) (any, error) {
+	switch v := value.(type) {
+	case nil, bool, string, float64, json.Number:
+		return v, nil
+	case int:
+		return tagged(tagInt, strconv.FormatInt(int64(v), 10)), nil
+	case int8:
+		return tagged(tagInt8, strconv.FormatInt(int64(v), 10)), nil
+	case int16:
+		return tagged(tagInt16, strconv.FormatInt(int64(v), 10)), nil
+	case int32:
+		return tagged(tagInt32, strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		return tagged(tagInt64, strconv.FormatInt(v, 10)), nil
+	case uint:
+		return tagged(tagUint, strconv.FormatUint(uint64(v), 10)), nil
+	case uint8:
+		return tagged(tagUint8, strconv.FormatUint(uint64(v), 10)), nil
+	case uint16:
+		return tagged(tagUint16, strconv.FormatUint(uint64(v), 10)), nil
+	case uint32:
+		return tagged(tagUint32, strconv.FormatUint(uint64(v), 10)), nil
+	case uint64:
+		return tagged(tagUint64, strconv.FormatUint(v, 10)), nil
+	case float32:
+		return tagged(tagFloat32, float64(v)), nil
+	case time.Time:
+		return tagged(tagTime, v.Format(time.RFC3339Nano)), nil
+	case time.Duration:
+		return tagged(tagDuration, strconv.FormatInt(int64(v), 10)), nil
+	case []byte:
+		return tagged(tagBytes, base64.StdEncoding.EncodeToString(v)), nil
+	case Data:
+		encoded, err := c.encodeMap(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		return tagged(tagData, encoded), nil
+	case map[string]any:
+		encoded, err := c.encodeMap(v)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if _, ok := v[tagTypeKey]; ok {
+			return tagged(tagMap, encoded), nil
+		}
+		return encoded, nil
+	case []any:
+		encoded := make([]any, len(v))
+		for i, item := range v {
+			e, err := c.encodeValue(item)
+			if err != nil {
+				return nil, errors.Annotatef(err, "index %d", i)
+			}
+			encoded[i] = e
+		}
+		return encoded, nil
+	}
+	return c.encodeStruct(value)
+}
+
+// encodeStruct tags the registered structs, the other values are left to encoding/json
+func (c *TaggedCodec) encodeStruct(value any) (any, error) {
+	t := reflect.TypeOf(value)
+	prefix := ""
+	if t.Kind() == reflect.Pointer {
+		if reflect.ValueOf(value).IsNil() {
+			return nil, nil
+		}
+		t = t.Elem()
+		prefix = tagPointer
+	}
+
+	c.mu.RLock()
+	name, registered := c.names[t]
+	c.mu.RUnlock()
+	if !registered {
+		return value, nil
+	}
+
+	// the fields are restored by their types, so the struct is kept as plain JSON
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Annotatef(err, "type %s", name)
+	}
+	var plain any
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return nil, errors.Annotatef(err, "type %s", name)
+	}
+	return tagged(prefix+name, plain), nil
+}
+
+func (c *TaggedCodec) Decode(d Data) (Data, error) {
+	if d == nil {
+		return nil, nil
+	}
+	decoded, err := c.decodeMap(d)
+	return Data(decoded), errors.Trace(err)
+}
+
+func (c *TaggedCodec) decodeMap(m map[string]any) (map[string]any, error) {
+	decoded := make(map[string]any, len(m))
+	for key, value := range m {
+		v, err := c.decodeValue(value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "key %s", key)
+		}
+		decoded[key] = v
+	}
+	return decoded, nil
+}
+
+func (c *TaggedCodec) decodeValue(value any) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if name, ok := v[tagTypeKey].(string); ok && len(v) == 2 {
+			if tagValue, ok := v[tagValueKey]; ok {
+				return c.decodeTagged(name, tagValue)
+			}
+		}
+		return c.decodeMap(v)
+	case Data:
+		return c.decodeValue(map[string]any(v))
+	case []any:
+		decoded := make([]any, len(v))
+		for i, item := range v {
+			d, err := c.decodeValue(item)
+			if err != nil {
+				return nil, errors.Annotatef(err, "index %d", i)
+			}
+			decoded[i] = d
+		}
+		return decoded, nil
+	}
+	return value, nil
+}
+
+func (c *TaggedCodec) decodeTagged(name string, value any) (any, error) {
+	s, _ := value.(string)
+	switch name {
+	case tagInt, tagInt8, tagInt16, tagInt32, tagInt64:
+		bits := map[string]int{tagInt: strconv.IntSize, tagInt8: 8, tagInt16: 16, tagInt32: 32, tagInt64: 64}[name]
+		n, err := strconv.ParseInt(s, 10, bits)
+		if err != nil {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		switch name {
+		case tagInt:
+			return int(n), nil
+		case tagInt8:
+			return int8(n), nil
+		case tagInt16:
+			return int16(n), nil
+		case tagInt32:
+			return int32(n), nil
+		}
+		return n, nil
+	case tagUint, tagUint8, tagUint16, tagUint32, tagUint64:
+		bits := map[string]int{tagUint: strconv.IntSize, tagUint8: 8, tagUint16: 16, tagUint32: 32, tagUint64: 64}[name]
+		n, err := strconv.ParseUint(s, 10, bits)
+		if err != nil {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		switch name {
+		case tagUint:
+			return uint(n), nil
+		case tagUint8:
+			return uint8(n), nil
+		case tagUint16:
+			return uint16(n), nil
+		case tagUint32:
+			return uint32(n), nil
+		}
+		return n, nil
+	case tagFloat32:
+		f, ok := value.(float64)
+		if !ok {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		return float32(f), nil
+	case tagTime:
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		return t, nil
+	case tagDuration:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		return time.Duration(n), nil
+	case tagBytes:
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		return b, nil
+	case tagData, tagMap:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, errors.NotValidf("%s value %v", name, value)
+		}
+		decoded, err := c.decodeMap(m)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if name == tagData {
+			return Data(decoded), nil
+		}
+		return decoded, nil
+	}
+	return c.decodeStruct(name, value)
+}
+
+func (c *TaggedCodec) decodeStruct(name string, value any) (any, error) {
+	typeName := strings.TrimPrefix(name, tagPointer)
+	c.mu.RLock()
+	t, registered := c.types[typeName]
+	c.mu.RUnlock()
+	if !registered {
+		return c.decodeValue(value)
+	}
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Annotatef(err, "type %s", name)
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(b, ptr.Interface()); err != nil {
+		return nil, errors.Annotatef(err, "type %s", name)
+	}
+	if typeName != name {
+		return ptr.Interface(), nil
+	}
+	return ptr.Elem().Interface(), nil
+}
@@ -0,0 +1,108 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type codecUser struct {
+	Name    string
+	Age     int
+	Created time.Time
+}
+
+// roundTrip encodes the data, passes it through JSON and decodes it, the same as persisting and reloading it
+func roundTrip(t *testing.T, codec DataCodec, d Data) Data {
+	encoded, err := codec.Encode(d)
+	assert.Nil(t, err)
+	b, err := json.Marshal(encoded)
+	assert.Nil(t, err)
+	reloaded := Data{}
+	assert.Nil(t, json.Unmarshal(b, &reloaded))
+	decoded, err := codec.Decode(reloaded)
+	assert.Nil(t, err)
+	return decoded
+}
+
+func TestTaggedCodec(t *testing.T) {
+	codec := NewTaggedCodec()
+	assert.Nil(t, codec.Register("user", codecUser{}))
+
+	now := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	d := Data{
+		"int":      42,
+		"int64":    int64(1 << 62),
+		"int8":     int8(-3),
+		"uint64":   uint64(1<<64 - 1),
+		"uint8":    uint8(255),
+		"float32":  float32(1.5),
+		"float64":  2.25,
+		"string":   "s",
+		"bool":     true,
+		"nil":      nil,
+		"time":     now,
+		"duration": 3 * time.Second,
+		"bytes":    []byte{0, 1, 2},
+		"user":     codecUser{Name: "bob", Age: 3, Created: now},
+		"userPtr":  &codecUser{Name: "alice"},
+		"list":     []any{int64(1), "a", map[string]any{"n": int32(2)}},
+		"nested":   Data{"n": uint16(7)},
+		"map":      map[string]any{"n": 1.0},
+		"tagLike":  map[string]any{"$type": "int64", "$value": "1"},
+	}
+	decoded := roundTrip(t, codec, d)
+	assert.Equal(t, d, decoded)
+	assert.Nil(t, d["nil"])
+
+	// the original is not changed
+	assert.Equal(t, 42, d["int"])
+}
+
+func TestTaggedCodec_Compatible(t *testing.T) {
+	codec := NewTaggedCodec()
+	assert.Nil(t, codec.Register("user", codecUser{}))
+
+	// persisted as plain JSON before the codec is used
+	plain := Data{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"n":1,"s":"a","m":{"x":[1,"b"]},"t":{"$type":"x"}}`), &plain))
+	decoded, err := codec.Decode(plain)
+	assert.Nil(t, err)
+	assert.Equal(t, plain, decoded)
+
+	// the struct types not registered are kept as plain JSON
+	other := NewTaggedCodec()
+	decoded = roundTrip(t, other, Data{"user": codecUser{Name: "bob"}})
+	assert.Equal(t, "bob", decoded["user"].(map[string]any)["Name"])
+
+	// registered by another engine only
+	encoded, err := codec.Encode(Data{"user": codecUser{Name: "bob"}})
+	assert.Nil(t, err)
+	decoded, err = other.Decode(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", decoded["user"].(map[string]any)["Name"])
+
+	_, err = codec.Decode(Data{"n": map[string]any{"$type": "int64", "$value": "x"}})
+	assert.True(t, errors.Is(err, errors.NotValid))
+}
+
+func TestTaggedCodec_Register(t *testing.T) {
+	codec := NewTaggedCodec()
+	assert.Nil(t, codec.Register("user", &codecUser{}))
+	assert.Nil(t, codec.Register("user", codecUser{}))
+
+	assert.True(t, errors.Is(codec.Register("other", codecUser{}), errors.AlreadyExists))
+	assert.True(t, errors.Is(codec.Register("user", struct{ A int }{}), errors.AlreadyExists))
+	assert.True(t, errors.Is(codec.Register("int64", struct{ A int }{}), errors.NotValid))
+	assert.True(t, errors.Is(codec.Register("", struct{ A int }{}), errors.NotValid))
+	assert.True(t, errors.Is(codec.Register("n", 1), errors.NotValid))
+	assert.True(t, errors.Is(codec.Register("n", nil), errors.NotValid))
+}
+
+func TestJSONCodec(t *testing.T) {
+	decoded := roundTrip(t, NewJSONCodec(), Data{"n": int64(1), "time": time.Unix(0, 0).UTC()})
+	assert.Equal(t, Data{"n": float64(1), "time": "1970-01-01T00:00:00Z"}, decoded)
+}
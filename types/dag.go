@@ -1,11 +1,27 @@
 package types
 
+import "time"
+
+/**
+ * DAGStatus is the terminal summary of a request, it is persisted once
+ * the request is Finished, Failed or Fatal.
+ */
 type DAGStatus struct {
-	Status        StatusType
+	RequestID string
+	DAGName   string
+
+	Status StatusType
+	// CurrentVertex is the last vertex the request ran on
 	CurrentVertex string
 	Result        Data
 	Error         string
-	NodeTraceData map[string]*NodeTraceRecord
+
+	CreateTime time.Time
+	EndTime    time.Time
+
+	LastVertexRecord *NodeTraceRecord `json:",omitempty"`
+	// NodeTraceData is only filled by GetRequestResult, keyed by the joined vertex path
+	NodeTraceData map[string]*NodeTraceRecord `json:",omitempty"`
 }
 
 type DAG interface {
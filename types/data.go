@@ -9,11 +9,33 @@ import (
 
 type Data map[string]any
 
+/**
+ * Get returns the value of the key, the offloaded value is loaded from the blob store,
+ * it returns (nil, false) if the loading fails, use Resolve to get the error.
+ */
 func (d *Data) Get(key string) (any, bool) {
-	v, exists := (*d)[key]
+	v, exists, err := d.Resolve(key)
+	if err != nil {
+		return nil, false
+	}
 	return v, exists
 }
 
+/**
+ * Resolve returns the value of the key the same as Get, along with the error loading the offloaded value
+ */
+func (d *Data) Resolve(key string) (any, bool, error) {
+	v, exists := (*d)[key]
+	if ref, ok := v.(*BlobRef); ok {
+		resolved, err := ref.Value()
+		if err != nil {
+			return nil, exists, errors.Trace(err)
+		}
+		return resolved, exists, nil
+	}
+	return v, exists, nil
+}
+
 func (d *Data) GetString(key string) (string, bool) {
 	v, exists := d.Get(key)
 	return cast.ToString(v), exists
@@ -50,10 +72,13 @@ func (d *Data) GetFloat64(key string) (float64, bool) {
 }
 
 func (d *Data) GetStruct(key string, s any) error {
-	v, exists := d.Get(key)
+	v, exists, err := d.Resolve(key)
 	if !exists {
 		return errors.NotFound
 	}
+	if err != nil {
+		return errors.Trace(err)
+	}
 	b, err := json.Marshal(v)
 	if err != nil {
 		return errors.Wrap(err, errors.New("marshal failed"))
@@ -9,6 +9,12 @@ import (
 var (
 	_ error = &RetryError{}
 	_ error = &FatalError{}
+	_ error = &PauseError{}
+)
+
+const (
+	ErrIdempotencyConflict = errors.ConstError("idempotency conflict")
+	ErrLeaseHeld           = errors.ConstError("lease held by another instance")
 )
 
 func NewRetryError(otherErr error, backoff time.Duration) error {
@@ -27,6 +33,14 @@ func NewFatalErrorf(format string, args ...interface{}) error {
 	return NewFatalError(errors.Errorf(format, args...))
 }
 
+func NewPauseError(otherErr error) error {
+	return &PauseError{baseError: newBaseErr(otherErr)}
+}
+
+func NewPauseErrorf(format string, args ...interface{}) error {
+	return NewPauseError(errors.Errorf(format, args...))
+}
+
 func newBaseErr(otherErr error) *baseError {
 	return &baseError{unwrapErr(otherErr)}
 }
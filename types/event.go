@@ -0,0 +1,66 @@
+package types
+
+import "time"
+
+type LifecycleEventType string
+
+const (
+	// LifecycleSubmitted is emitted once the request is accepted by SubmitDAG
+	LifecycleSubmitted LifecycleEventType = "Submitted"
+	// LifecycleStarted is emitted before the first vertex of the request runs on the engine, again after reloaded
+	LifecycleStarted        LifecycleEventType = "Started"
+	LifecycleVertexStarted  LifecycleEventType = "VertexStarted"
+	LifecycleVertexFinished LifecycleEventType = "VertexFinished"
+	LifecycleVertexFailed   LifecycleEventType = "VertexFailed"
+	LifecycleRetryScheduled LifecycleEventType = "RetryScheduled"
+	LifecyclePaused         LifecycleEventType = "Paused"
+	LifecycleResumed        LifecycleEventType = "Resumed"
+	LifecycleFinished       LifecycleEventType = "Finished"
+	// LifecycleTerminated is emitted once the request is Failed or Fatal
+	LifecycleTerminated LifecycleEventType = "Terminated"
+)
+
+/**
+ * LifecycleEvent tells the progress of a request to the listeners, see WithEventListener
+ */
+type LifecycleEvent struct {
+	Type      LifecycleEventType
+	Time      time.Time
+	RequestID string
+	DAGName   string
+	Tenant    string
+	// Status of the request after the event
+	Status StatusType
+	// Path is the vertex path of the vertex events, e.g. [dag sub node]
+	Path []string
+	// StartTime and EndTime are the ones of the vertex for the vertex events, or of the request for the terminal ones
+	StartTime time.Time
+	EndTime   time.Time
+	// Err is the error of the vertex or the request
+	Err error
+	// RetryAt is when the vertex runs again for LifecycleRetryScheduled
+	RetryAt time.Time
+	// Operator is the one who paused or resumed the request, see WithOperator
+	Operator string
+}
+
+// Duration returns how long the vertex or the request ran, zero if it has not ended
+func (e *LifecycleEvent) Duration() time.Duration {
+	if e.StartTime.IsZero() || e.EndTime.IsZero() {
+		return 0
+	}
+	return e.EndTime.Sub(e.StartTime)
+}
+
+/**
+ * EventListener receives the lifecycle events, it must not change the event.
+ * A synchronous listener is called on the goroutine running the request, so it should return quickly.
+ */
+type EventListener func(event *LifecycleEvent)
+
+type EventListenerConfig struct {
+	Listener EventListener
+	// Async calls the listener on a goroutine of its own, the events are dropped once BufferSize of them are waiting
+	Async      bool
+	BufferSize int
+}
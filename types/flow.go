@@ -1,6 +1,10 @@
 package types
 
-import "context"
+import (
+	"context"
+	"net/http"
+	"time"
+)
 
 type FlowEngine interface {
 	RegisterDAG(name string, handler DAGHandler) error
@@ -14,14 +18,75 @@ type FlowEngine interface {
 
 	ListDAGNames() ([]string, error)
 
-	RunDAG(ctx context.Context, dagName string, requestID string, params Data) error
+	/**
+	 * RunDAG returns AlreadyExists if the request has been submitted within the idempotency retention.
+	 */
+	RunDAG(ctx context.Context, dagName string, requestID string, params Data, opts ...RunOption) error
+	/**
+	 * SubmitDAG is the same as RunDAG, but a duplicate submit returns the existing request
+	 * with Duplicated set instead of an error.
+	 * If the parameters differ from the existing ones, SubmitResult.Conflict is set and
+	 * the error is ErrIdempotencyConflict.
+	 */
+	SubmitDAG(ctx context.Context, dagName string, requestID string, params Data, opts ...RunOption) (*SubmitResult, error)
 
+	/**
+	 * GetRequestStatus returns the status of an ongoing request,
+	 * or the terminal summary once the request left the memory.
+	 */
 	GetRequestStatus(ctx context.Context, requestID string) (*RequestStatus, error)
+	/**
+	 * GetRequestResult returns the terminal summary along with the trace records of the request,
+	 * it returns NotYetAvailable if the request is not terminated yet.
+	 */
+	GetRequestResult(ctx context.Context, requestID string) (*DAGStatus, error)
+	/**
+	 * ListRequests returns the requests matching the filter page by page,
+	 * pass RequestList.NextCursor as RequestFilter.Cursor to get the next page.
+	 */
+	ListRequests(ctx context.Context, filter *RequestFilter) (*RequestList, error)
 	RenderRequestStatus(ctx context.Context, requestID string) (string, error)
+	/**
+	 * GetRequestHistory returns at most limit events of the request starting from offset,
+	 * in the order of happening.
+	 */
+	GetRequestHistory(ctx context.Context, requestID string, offset, limit int) (*RequestHistory, error)
 
 	PauseRequest(ctx context.Context, requestID string) error
 	ResumeRequest(ctx context.Context, requestID string) error
 	TerminateRequest(ctx context.Context, requestID string) error
+	/**
+	 * PauseRequests, ResumeRequests and TerminateRequests operate all of the requests matching the filter,
+	 * terminated requests are skipped unless the filter selects them by Statuses.
+	 * Cursor and sorting of the filter are ignored, Limit caps the amount of the requests if it is set.
+	 */
+	PauseRequests(ctx context.Context, filter *RequestFilter, opts ...BulkOption) (*BulkResult, error)
+	ResumeRequests(ctx context.Context, filter *RequestFilter, opts ...BulkOption) (*BulkResult, error)
+	TerminateRequests(ctx context.Context, filter *RequestFilter, opts ...BulkOption) (*BulkResult, error)
+	/**
+	 * RestartRequestFrom reruns a paused or terminated request from the vertex path, e.g. `dag.subdag.node1`,
+	 * the recorded input of the vertex is used if data is nil.
+	 */
+	RestartRequestFrom(ctx context.Context, requestID, vertexPath string, data *Data) error
+	/**
+	 * GetRequestData returns the data which would be the input of the next vertex of the request.
+	 */
+	GetRequestData(ctx context.Context, requestID string) (Data, error)
+	/**
+	 * PatchRequestData applies the JSON merge patch (RFC 7386) on the data of a paused request,
+	 * a null value in the patch removes the key.
+	 */
+	PatchRequestData(ctx context.Context, requestID string, patch Data) error
+	/**
+	 * SkipVertex completes the current node of a paused, retrying or failed request with the output
+	 * instead of running its handler, then the request goes on.
+	 */
+	SkipVertex(ctx context.Context, requestID string, output Data) error
+	/**
+	 * ForceBranch makes the current condition of a paused, retrying or failed request
+	 * take the given branch instead of running its handler, then the request goes on.
+	 */
+	ForceBranch(ctx context.Context, requestID string, branch bool) error
 	/**
 	 * close the flowengine, and left all ongoing requests Paused status
 	 */
@@ -35,11 +100,159 @@ type FlowEngine interface {
 	 * Notice: if the request ID has been loaded(checked by whether request ID be found in loaded ones)
 	 */
 	ReloadRequests(ctx context.Context) (map[string]error, error)
+	/**
+	 * PurgeRequest deletes all of the data of a terminated request from store.
+	 */
+	PurgeRequest(ctx context.Context, requestID string) error
+	/**
+	 * RunGC purges the requests expired by the retention policies right now,
+	 * GetGCReport returns the report of the running or the last garbage collection.
+	 */
+	RunGC(ctx context.Context) (*GCReport, error)
+	GetGCReport() *GCReport
+
+	/**
+	 * GetSchedulingStats returns the usage of each fair-share scheduling group.
+	 */
+	GetSchedulingStats() ([]*GroupStats, error)
+	/**
+	 * MetricsHandler serves the engine-wide metrics per DAG and vertex in the Prometheus text format,
+	 * e.g. http.Handle("/metrics", engine.MetricsHandler())
+	 */
+	MetricsHandler() http.Handler
 }
 
 type RequestStatus struct {
 	Status    StatusType
 	LastError string
+	// output of the request, only available when it is Finished
+	Result Data
 
 	LastVertexRecord *NodeTraceRecord
 }
+
+type GroupStats struct {
+	Group string
+	Quota GroupQuota
+
+	// nodes of the group running now
+	RunningNodes int
+	// requests of the group held by the engine
+	InflightRequests int
+	// requests of the group waiting for a node slot on the last round
+	RunnableRequests int
+
+	DispatchedNodes int64
+	// times of the group skipped because it reached MaxConcurrentNodes
+	ThrottledTimes int64
+	// times of RunDAG rejected because the group reached MaxInflightRequests
+	RejectedRequests int64
+}
+
+type SubmitResult struct {
+	RequestID string
+	// Duplicated indicates the request has been submitted before, RequestID is the existing one.
+	Duplicated bool
+	// Conflict indicates the duplicated request was submitted with different parameters.
+	Conflict bool
+
+	Status *RequestStatus
+}
+
+/**
+ * RequestInfo is the index entry of a request, it is updated whenever
+ * the request saves its context or changes the status.
+ */
+type RequestInfo struct {
+	RequestID     string
+	DAGName       string
+	Tenant        string            `json:",omitempty"`
+	Labels        map[string]string `json:",omitempty"`
+	Status        StatusType
+	CurrentVertex string `json:",omitempty"`
+	CreateTime    time.Time
+	UpdateTime    time.Time
+	// the key the request is submitted with, its record is removed along with the request
+	IdempotencyKey string `json:",omitempty"`
+}
+
+type RequestSortField int
+
+const (
+	SortByCreateTime RequestSortField = 0
+	SortByUpdateTime RequestSortField = 1
+	SortByRequestID  RequestSortField = 2
+)
+
+/**
+ * RequestFilter selects requests for ListRequests, zero value fields are ignored.
+ */
+type RequestFilter struct {
+	DAGName string
+	Tenant  string
+	// match any of the statuses
+	Statuses []StatusType
+	// the joined vertex path, e.g. `dag.node1`
+	CurrentVertex string
+	// match all of the labels
+	Labels map[string]string
+
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+
+	SortBy     RequestSortField
+	Descending bool
+	// Cursor is the NextCursor returned by the previous page
+	Cursor string
+	// default: 100
+	Limit int
+}
+
+/**
+ * RequestPage is the page of ListRequests for the stores selecting the requests themselves,
+ * the requests are ordered by SortBy then the request ID, the times are compared in microseconds.
+ */
+type RequestPage struct {
+	SortBy     RequestSortField
+	Descending bool
+	// the last request of the previous page, the request ID is empty on the first page
+	AfterTime      time.Time
+	AfterRequestID string
+	// the requests returned at most
+	Limit int
+}
+
+type RequestList struct {
+	Requests []*RequestInfo
+	// empty if there are no more requests
+	NextCursor string
+}
+
+type BulkItemResult struct {
+	RequestID string
+	// empty if the operation succeeded
+	Error string `json:",omitempty"`
+}
+
+type BulkResult struct {
+	Results   []*BulkItemResult
+	Succeeded int
+	Failed    int
+}
+
+type GCReport struct {
+	StartTime time.Time
+	// zero if the garbage collection is running
+	EndTime time.Time
+	// terminated requests checked
+	Scanned int
+	Expired int
+	Purged  int
+	Failed  int
+	// the store keys deleted
+	DeletedKeys int
+	// the last error occurred
+	Error string `json:",omitempty"`
+}
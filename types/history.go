@@ -0,0 +1,42 @@
+package types
+
+import "time"
+
+type HistoryEventType string
+
+const (
+	EventRequestStarted    HistoryEventType = "RequestStarted"
+	EventRequestReloaded   HistoryEventType = "RequestReloaded"
+	EventVertexStarted     HistoryEventType = "VertexStarted"
+	EventVertexFinished    HistoryEventType = "VertexFinished"
+	EventVertexFailed      HistoryEventType = "VertexFailed"
+	EventRetryScheduled    HistoryEventType = "RetryScheduled"
+	EventStatusChanged     HistoryEventType = "StatusChanged"
+	EventRequestTerminated HistoryEventType = "RequestTerminated"
+	EventRequestRestarted  HistoryEventType = "RequestRestarted"
+	EventDataPatched       HistoryEventType = "DataPatched"
+	EventVertexOverridden  HistoryEventType = "VertexOverridden"
+)
+
+/**
+ * HistoryEvent is an entry of the append-only execution history of a request.
+ */
+type HistoryEvent struct {
+	Time time.Time
+	Type HistoryEventType
+	// the joined vertex path, e.g. `dag.node1`
+	Vertex string     `json:",omitempty"`
+	Status StatusType `json:",omitempty"`
+	// Operator is the one who changed the request, see WithOperator
+	Operator string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+	Message  string `json:",omitempty"`
+	// Patch is the merge patch applied on the data of the request
+	Patch Data `json:",omitempty"`
+}
+
+type RequestHistory struct {
+	Events []*HistoryEvent
+	// offset of the next page, it is -1 if there are no more events
+	NextOffset int
+}
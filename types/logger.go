@@ -0,0 +1,56 @@
+package types
+
+import "github.com/sirupsen/logrus"
+
+// the fields attached by the engine to the logs of the requests
+const (
+	LogFieldRequestID = "request_id"
+	LogFieldDAG       = "dag"
+	LogFieldTenant    = "tenant"
+	LogFieldVertex    = "vertex"
+)
+
+type LogFields map[string]any
+
+/**
+ * Logger is the structured logger of the engine, see WithLogger.
+ * WithFields returns a logger attaching the fields to each entry, the logger itself is not changed.
+ */
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+	WithFields(fields LogFields) Logger
+}
+
+/**
+ * NewLogrusLogger adapts the logrus logger, e.g. logrus.StandardLogger() which is the default of the engine
+ */
+func NewLogrusLogger(logger logrus.FieldLogger) Logger {
+	return &logrusLogger{FieldLogger: logger}
+}
+
+type logrusLogger struct {
+	logrus.FieldLogger
+}
+
+func (l *logrusLogger) WithFields(fields LogFields) Logger {
+	return &logrusLogger{FieldLogger: l.FieldLogger.WithFields(logrus.Fields(fields))}
+}
+
+// NewNopLogger returns the logger discarding everything, e.g. to silence the engine in tests
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...any) {}
+func (nopLogger) Infof(format string, args ...any)  {}
+func (nopLogger) Warnf(format string, args ...any)  {}
+func (nopLogger) Errorf(format string, args ...any) {}
+
+func (l nopLogger) WithFields(fields LogFields) Logger {
+	return l
+}
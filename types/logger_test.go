@@ -0,0 +1,34 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogrusLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := logrus.New()
+	l.SetOutput(buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	logger := NewLogrusLogger(l)
+
+	logger.WithFields(LogFields{LogFieldRequestID: "req-1"}).WithFields(LogFields{LogFieldVertex: "test.node1"}).Warnf("retry %d", 2)
+	entry := map[string]any{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "retry 2", entry["msg"])
+	assert.Equal(t, "warning", entry["level"])
+	assert.Equal(t, "req-1", entry[LogFieldRequestID])
+	assert.Equal(t, "test.node1", entry[LogFieldVertex])
+
+	// the logger itself is not changed
+	buf.Reset()
+	logger.Errorf("plain")
+	assert.NotContains(t, buf.String(), LogFieldRequestID)
+
+	nop := NewNopLogger()
+	nop.WithFields(LogFields{"k": "v"}).Errorf("discarded")
+}
@@ -11,6 +11,30 @@ type NodeTraceRecord struct {
 	Error     string
 	Input     Data
 	Output    Data
+	// Override is set if the vertex is completed by the operator instead of its handler
+	Override *VertexOverride `json:",omitempty"`
+}
+
+type VertexOverrideType string
+
+const (
+	// OverrideSkip treats the node as succeeded with the given output
+	OverrideSkip VertexOverrideType = "Skip"
+	// OverrideForceBranch takes the given branch of the condition
+	OverrideForceBranch VertexOverrideType = "ForceBranch"
+)
+
+/**
+ * VertexOverride is the decision made by the operator for the current vertex of a stuck request,
+ * see FlowEngine.SkipVertex and FlowEngine.ForceBranch.
+ */
+type VertexOverride struct {
+	Type VertexOverrideType
+	// the joined vertex path which the override applies to
+	Vertex   string
+	Output   Data   `json:",omitempty"`
+	Branch   bool   `json:",omitempty"`
+	Operator string `json:",omitempty"`
 }
 
 type NodeRuntimeData struct {
@@ -18,8 +42,7 @@ type NodeRuntimeData struct {
 	CurrentRunning int32
 	SuccessTimes   int64
 	FailedTimes    int64
-	// leave the performance data to promethues
-	// since for it's hard to record the histogram data
+	// the engine-wide metrics with the histograms are served by FlowEngine.MetricsHandler
 }
 
 type NodeHandler func(ctx Context, input Data) (Data, error)
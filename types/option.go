@@ -2,8 +2,12 @@ package types
 
 import (
 	"context"
+	"time"
 
 	"github.com/mcuadros/go-defaults"
+	"github.com/warriorguo/workflow/blob"
+	"github.com/warriorguo/workflow/notify"
+	"github.com/warriorguo/workflow/trace"
 )
 
 type ExecutionOptions struct {
@@ -11,6 +15,134 @@ type ExecutionOptions struct {
 }
 type ExecutionOption func(*ExecutionOptions)
 
+/**
+ * RunOptions carries the per request options given to FlowEngine.RunDAG.
+ */
+type RunOptions struct {
+	/**
+	 * Tenant is an optional label of the request, it is used by the
+	 * fair-share scheduler when SchedulingGroupBy involves tenants.
+	 */
+	Tenant string
+	/**
+	 * IdempotencyKey identifies duplicate submits of a request, default to the request ID.
+	 */
+	IdempotencyKey string
+	/**
+	 * Labels are the custom tags of the request, which can be used to select requests, see RequestFilter.
+	 */
+	Labels map[string]string
+}
+type RunOption func(*RunOptions)
+
+func NewRunOptions(opts ...RunOption) *RunOptions {
+	runOpts := &RunOptions{}
+	for _, opt := range opts {
+		opt(runOpts)
+	}
+	return runOpts
+}
+
+func WithTenant(tenant string) RunOption {
+	return func(opts *RunOptions) {
+		opts.Tenant = tenant
+	}
+}
+
+func WithIdempotencyKey(key string) RunOption {
+	return func(opts *RunOptions) {
+		opts.IdempotencyKey = key
+	}
+}
+
+func WithLabel(key, value string) RunOption {
+	return func(opts *RunOptions) {
+		if opts.Labels == nil {
+			opts.Labels = make(map[string]string)
+		}
+		opts.Labels[key] = value
+	}
+}
+
+/**
+ * BulkOptions carries the options of the bulk operations, e.g. FlowEngine.ResumeRequests.
+ */
+type BulkOptions struct {
+	/**
+	 * RatePerSecond limits how many requests are operated per second, 0 means no limit.
+	 */
+	RatePerSecond float64
+}
+type BulkOption func(*BulkOptions)
+
+func NewBulkOptions(opts ...BulkOption) *BulkOptions {
+	bulkOpts := &BulkOptions{}
+	for _, opt := range opts {
+		opt(bulkOpts)
+	}
+	return bulkOpts
+}
+
+func WithRateLimit(perSecond float64) BulkOption {
+	return func(opts *BulkOptions) {
+		opts.RatePerSecond = perSecond
+	}
+}
+
+type GroupByType int
+
+const (
+	GroupByDAG          GroupByType = 0
+	GroupByTenant       GroupByType = 1
+	GroupByDAGAndTenant GroupByType = 2
+)
+
+/**
+ * GroupQuota configures how the fair-share scheduler treats a group.
+ * Zero value of the caps means unlimited.
+ */
+type GroupQuota struct {
+	/**
+	 * Weight is the share of the group compares to the others,
+	 * a group with weight 2 gets twice the node slots of a group with weight 1.
+	 * default: 1
+	 */
+	Weight int
+	/**
+	 * MaxConcurrentNodes limits the nodes of the group running at the same time.
+	 */
+	MaxConcurrentNodes int
+	/**
+	 * MaxInflightRequests limits the requests of the group held by the engine,
+	 * RunDAG returns QuotaLimitExceeded once it is reached.
+	 */
+	MaxInflightRequests int
+}
+
+/**
+ * RetentionPolicy configures how long the data of a terminated request is kept since it terminated,
+ * zero value means keeping forever.
+ */
+type RetentionPolicy struct {
+	Finished time.Duration
+	Failed   time.Duration
+	Fatal    time.Duration
+}
+
+// Of returns the retention of the status, false if the status is not terminal or kept forever
+func (p RetentionPolicy) Of(status StatusType) (time.Duration, bool) {
+	var retention time.Duration
+	switch status {
+	case Finished:
+		retention = p.Finished
+	case Failed:
+		retention = p.Failed
+	case Fatal:
+		retention = p.Fatal
+	}
+	return retention, retention > 0
+}
+
 func NewFlowOptions() *FlowOptions {
 	opts := &FlowOptions{Ctx: context.Background()}
 	defaults.SetDefaults(opts)
@@ -46,6 +178,122 @@ type FlowOptions struct {
 	// PostgreSQL store configuration
 	// If both MemStore and PostgresConfig are set, PostgresConfig takes precedence
 	PostgresConfig *PostgresConfig
+	// File store configuration, it takes precedence over MemStore but not PostgresConfig
+	FileStoreConfig *FileStoreConfig
+
+	/**
+	 * default: GroupByDAG
+	 * SchedulingGroupBy decides how requests are grouped by the fair-share scheduler,
+	 * node slots of MaxNodeConcurrency are shared between groups by their weights.
+	 */
+	SchedulingGroupBy GroupByType
+	/**
+	 * GroupQuotas configures the groups by group key, the key is the DAG name,
+	 * the tenant or `<DAG name>/<tenant>` according to SchedulingGroupBy.
+	 * DefaultGroupQuota applies to the groups not listed.
+	 */
+	GroupQuotas       map[string]GroupQuota
+	DefaultGroupQuota GroupQuota
+
+	/**
+	 * default: 24h
+	 * IdempotencyRetention is how long a submitted request is remembered by its idempotency key,
+	 * a duplicate submit within the window returns the existing request instead of running again.
+	 */
+	IdempotencyRetention time.Duration `default:"24h"`
+
+	/**
+	 * Retention applies to the requests of the DAGs not listed in DAGRetentions,
+	 * the garbage collection purges the plan, the trace records, the history and the index
+	 * of the requests terminated longer than the retention.
+	 */
+	Retention     RetentionPolicy
+	DAGRetentions map[string]RetentionPolicy
+	/**
+	 * default: 10m
+	 * GCInterval is the interval of the background garbage collection,
+	 * it only works with AutoStart and any retention configured.
+	 */
+	GCInterval time.Duration `default:"10m"`
+	/**
+	 * default: 100
+	 * GCBatchSize is the amount of requests purged in one batch.
+	 */
+	GCBatchSize int `default:"100"`
+
+	/**
+	 * default: false
+	 * EnableLease makes the engines sharing a store claim requests through leases,
+	 * an engine only runs the requests it holds the lease of, and takes over the expired ones.
+	 */
+	EnableLease bool `default:"false"`
+	/**
+	 * InstanceID identifies the engine as the lease owner, default to `<hostname>-<pid>-<random>`.
+	 */
+	InstanceID string
+	/**
+	 * default: 30s
+	 * LeaseTTL is how long a lease lasts without renewal.
+	 */
+	LeaseTTL time.Duration `default:"30s"`
+	/**
+	 * default: 10s
+	 * LeaseRenewInterval is the interval to renew the leases and take over the expired ones.
+	 */
+	LeaseRenewInterval time.Duration `default:"10s"`
+
+	/**
+	 * Notifier connects the engines sharing a store, so that the control operations, e.g. PauseRequest,
+	 * called on an engine reach the engine running the request, and the requests released by a closing engine
+	 * are taken over by the others right away. The lease owner is the target if EnableLease, otherwise all of the engines.
+	 */
+	Notifier notify.Notifier
+	/**
+	 * default: 5s
+	 * NotifyTimeout is how long a control operation waits for the reply of the engine running the request.
+	 */
+	NotifyTimeout time.Duration `default:"5s"`
+
+	/**
+	 * DataCodec converts the Data of the requests persisted to the store, e.g. a TaggedCodec keeps the Go types
+	 * of the values through reloading. The default keeps the Data as plain JSON.
+	 */
+	DataCodec DataCodec
+
+	/**
+	 * BlobStore keeps the values of the Data larger than BlobThreshold, which are replaced by BlobRefs in the Data,
+	 * so that they are not copied into every trace record and run context saved. The blobs are removed along with the request.
+	 */
+	BlobStore blob.Store
+	/**
+	 * default: 1048576
+	 * BlobThreshold is the serialized size in bytes above which a top-level value of the Data is offloaded.
+	 */
+	BlobThreshold int `default:"1048576"`
+
+	/**
+	 * Redaction masks or hashes the sensitive values of the trace records before they are persisted and rendered.
+	 * RestartRequestFrom a vertex takes the redacted input of the record unless the data is given.
+	 */
+	Redaction *RedactionPolicy
+
+	/**
+	 * EventListeners receive the lifecycle events of the requests run by the engine
+	 */
+	EventListeners []EventListenerConfig
+
+	/**
+	 * Tracer traces each request as a span with the runs of the vertices and the sub DAGs as the children,
+	 * the span carried by the context of RunDAG is the parent, see trace.ContextWithSpanContext.
+	 * The spans open are persisted along with the run context, so that they continue after reloaded.
+	 */
+	Tracer trace.Tracer
+
+	/**
+	 * Logger is where the engine logs, the logs of a request carry its request ID, DAG and vertex as the fields.
+	 * The default is the standard logger of logrus.
+	 */
+	Logger Logger
 }
 
 // PostgresConfig holds PostgreSQL connection configuration
@@ -57,6 +305,15 @@ type PostgresConfig struct {
 	Database string
 	SSLMode  string // disable, require, verify-ca, verify-full
 }
+
+// FileStoreConfig holds the embedded file store configuration, the zero fields take the defaults
+type FileStoreConfig struct {
+	Dir              string
+	SyncPolicy       string // always, interval, never
+	SyncInterval     time.Duration
+	CompactThreshold int64
+	SnapshotInterval time.Duration
+}
 type FlowOption func(*FlowOptions)
 
 func WithContext(ctx context.Context) FlowOption {
@@ -95,3 +352,156 @@ func WithPostgresConfig(config *PostgresConfig) FlowOption {
 		opts.PostgresConfig = config
 	}
 }
+
+// WithFileStoreConfig configures the flow engine to use the embedded file store
+func WithFileStoreConfig(config *FileStoreConfig) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.FileStoreConfig = config
+	}
+}
+
+func WithSchedulingGroupBy(groupBy GroupByType) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.SchedulingGroupBy = groupBy
+	}
+}
+
+// WithGroupQuota sets the quota of a scheduling group
+func WithGroupQuota(group string, quota GroupQuota) FlowOption {
+	return func(opts *FlowOptions) {
+		if opts.GroupQuotas == nil {
+			opts.GroupQuotas = make(map[string]GroupQuota)
+		}
+		opts.GroupQuotas[group] = quota
+	}
+}
+
+// WithDefaultGroupQuota sets the quota of the groups without a specified one
+func WithDefaultGroupQuota(quota GroupQuota) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.DefaultGroupQuota = quota
+	}
+}
+
+func WithIdempotencyRetention(retention time.Duration) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.IdempotencyRetention = retention
+	}
+}
+
+// WithRetention sets the default retention policy of the terminated requests
+func WithRetention(policy RetentionPolicy) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.Retention = policy
+	}
+}
+
+// WithDAGRetention sets the retention policy of the terminated requests of a DAG
+func WithDAGRetention(dagName string, policy RetentionPolicy) FlowOption {
+	return func(opts *FlowOptions) {
+		if opts.DAGRetentions == nil {
+			opts.DAGRetentions = make(map[string]RetentionPolicy)
+		}
+		opts.DAGRetentions[dagName] = policy
+	}
+}
+
+func WithGCInterval(interval time.Duration) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.GCInterval = interval
+	}
+}
+
+// EnableLease makes the engine claim the requests through leases with the instance ID
+func EnableLease(instanceID string) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.EnableLease = true
+		opts.InstanceID = instanceID
+	}
+}
+
+func WithLeaseTTL(ttl, renewInterval time.Duration) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.LeaseTTL = ttl
+		opts.LeaseRenewInterval = renewInterval
+	}
+}
+
+// WithNotifier routes the control operations to the engine running the request through the notifier
+func WithNotifier(notifier notify.Notifier) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.Notifier = notifier
+	}
+}
+
+func WithNotifyTimeout(timeout time.Duration) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.NotifyTimeout = timeout
+	}
+}
+
+// WithDataCodec sets the codec converting the Data persisted, see NewTaggedCodec
+func WithDataCodec(codec DataCodec) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.DataCodec = codec
+	}
+}
+
+// WithBlobStore offloads the values of the Data larger than threshold bytes to the blob store, zero keeps the default threshold
+func WithBlobStore(store blob.Store, threshold int) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.BlobStore = store
+		if threshold > 0 {
+			opts.BlobThreshold = threshold
+		}
+	}
+}
+
+// WithRedactRules adds the rules to the redaction policy of the trace records
+func WithRedactRules(rules ...RedactRule) FlowOption {
+	return func(opts *FlowOptions) {
+		if opts.Redaction == nil {
+			opts.Redaction = &RedactionPolicy{}
+		}
+		opts.Redaction.Rules = append(opts.Redaction.Rules, rules...)
+	}
+}
+
+// WithRedactHashKey makes the hashes of the redacted values HMACs with the key
+func WithRedactHashKey(key []byte) FlowOption {
+	return func(opts *FlowOptions) {
+		if opts.Redaction == nil {
+			opts.Redaction = &RedactionPolicy{}
+		}
+		opts.Redaction.HashKey = key
+	}
+}
+
+// WithEventListener adds a listener called synchronously, see EventListener
+func WithEventListener(listener EventListener) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.EventListeners = append(opts.EventListeners, EventListenerConfig{Listener: listener})
+	}
+}
+
+// WithAsyncEventListener adds a listener called on a goroutine of its own with at most bufferSize events waiting,
+// the default size 1024 is taken if bufferSize is not positive
+func WithAsyncEventListener(listener EventListener, bufferSize int) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.EventListeners = append(opts.EventListeners, EventListenerConfig{Listener: listener, Async: true, BufferSize: bufferSize})
+	}
+}
+
+// WithTracer traces the requests with the tracer, e.g. trace.NewTracer(exporter)
+func WithTracer(tracer trace.Tracer) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.Tracer = tracer
+	}
+}
+
+// WithLogger makes the engine log to the logger, e.g. NewNopLogger() to silence it
+func WithLogger(logger Logger) FlowOption {
+	return func(opts *FlowOptions) {
+		opts.Logger = logger
+	}
+}
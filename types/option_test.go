@@ -2,8 +2,10 @@ package types
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/warriorguo/workflow/notify"
 )
 
 func TestWithPostgresConfig(t *testing.T) {
@@ -70,3 +72,36 @@ func TestMultipleOptions(t *testing.T) {
 	assert.Equal(t, 50, opts.MaxNodeConcurrency)
 	assert.False(t, opts.AutoStart)
 }
+
+func TestWithFileStoreConfig(t *testing.T) {
+	opts := NewFlowOptions()
+	WithFileStoreConfig(&FileStoreConfig{Dir: "data", SyncPolicy: "interval"})(opts)
+
+	assert.NotNil(t, opts.FileStoreConfig)
+	assert.Equal(t, "data", opts.FileStoreConfig.Dir)
+	assert.Equal(t, "interval", opts.FileStoreConfig.SyncPolicy)
+}
+
+func TestWithNotifier(t *testing.T) {
+	opts := NewFlowOptions()
+	assert.Nil(t, opts.Notifier)
+	assert.Equal(t, 5*time.Second, opts.NotifyTimeout)
+
+	notifier := notify.NewMemNotifier()
+	WithNotifier(notifier)(opts)
+	WithNotifyTimeout(time.Second)(opts)
+	assert.Equal(t, notifier, opts.Notifier)
+	assert.Equal(t, time.Second, opts.NotifyTimeout)
+}
+
+func TestWithEventListener(t *testing.T) {
+	opts := NewFlowOptions()
+	listener := func(event *LifecycleEvent) {}
+	WithEventListener(listener)(opts)
+	WithAsyncEventListener(listener, 16)(opts)
+
+	assert.Len(t, opts.EventListeners, 2)
+	assert.False(t, opts.EventListeners[0].Async)
+	assert.True(t, opts.EventListeners[1].Async)
+	assert.Equal(t, 16, opts.EventListeners[1].BufferSize)
+}
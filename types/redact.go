@@ -0,0 +1,277 @@
+package types
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"reflect"
+	"strings"
+)
+
+type RedactAction string
+
+const (
+	// RedactMask replaces the value with RedactedMask
+	RedactMask RedactAction = "mask"
+	// RedactHash replaces the value with the hash of its JSON, so that the values can be compared without exposing them
+	RedactHash RedactAction = "hash"
+)
+
+const (
+	// RedactedMask is the value kept instead of a masked one
+	RedactedMask = "[REDACTED]"
+	// RedactedHashPrefix prefixes the hex hash kept instead of a hashed one
+	RedactedHashPrefix = "sha256:"
+)
+
+/**
+ * RedactRule selects the keys of the Data to redact in the trace records.
+ * The patterns are matched by path.Match with "." as the separator, so "*" matches one segment.
+ */
+type RedactRule struct {
+	// DAG is the name of the DAG run by the request, empty for all of the DAGs
+	DAG string
+	// Node is the pattern of the vertex path under the DAG, e.g. "charge" or "payment.*", empty for all of the nodes
+	Node string
+	// Keys are the patterns of the key paths in the Data, e.g. "card.number",
+	// a pattern without "." matches the key at any depth, e.g. "password"
+	Keys []string
+	// Action is RedactMask if empty
+	Action RedactAction
+}
+
+/**
+ * RedactionPolicy redacts the Input and Output of the trace records before they are persisted and rendered,
+ * as well as the result of the terminal summary and the patches in the history, see RedactData.
+ * The run context keeps the values, since the next nodes need them.
+ */
+type RedactionPolicy struct {
+	Rules []RedactRule
+	// HashKey makes RedactHash an HMAC, so that the low entropy values can not be found by hashing the guesses
+	HashKey []byte
+}
+
+func matchPattern(pattern, name string) bool {
+	matched, _ := path.Match(strings.ReplaceAll(pattern, ".", "/"), strings.ReplaceAll(name, ".", "/"))
+	return matched
+}
+
+func (r *RedactRule) matchVertex(dagName, node string) bool {
+	if r.DAG != "" && r.DAG != dagName {
+		return false
+	}
+	return r.Node == "" || matchPattern(r.Node, node)
+}
+
+func (r *RedactRule) matchKey(keyPath, key string) bool {
+	for _, pattern := range r.Keys {
+		if matchPattern(pattern, keyPath) {
+			return true
+		}
+		if !strings.Contains(pattern, ".") && matchPattern(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RedactionPolicy) hash(value any) string {
+	b, _ := json.Marshal(value)
+	var sum []byte
+	if len(p.HashKey) > 0 {
+		mac := hmac.New(sha256.New, p.HashKey)
+		mac.Write(b)
+		sum = mac.Sum(nil)
+	} else {
+		digest := sha256.Sum256(b)
+		sum = digest[:]
+	}
+	return RedactedHashPrefix + hex.EncodeToString(sum)
+}
+
+func isRedacted(s string) bool {
+	return s == RedactedMask || (strings.HasPrefix(s, RedactedHashPrefix) && len(s) == len(RedactedHashPrefix)+2*sha256.Size)
+}
+
+/**
+ * redactMap returns a copy of m with the keys matched by the rules redacted, or m itself and false if none matched
+ */
+func (p *RedactionPolicy) redactMap(rules []*RedactRule, m map[string]any, prefix string) (map[string]any, bool) {
+	var redacted map[string]any
+	set := func(key string, value any) {
+		if redacted == nil {
+			redacted = make(map[string]any, len(m))
+			for k, v := range m {
+				redacted[k] = v
+			}
+		}
+		redacted[key] = value
+	}
+
+	for key, value := range m {
+		keyPath := prefix + key
+		action := RedactAction("")
+		for _, rule := range rules {
+			if !rule.matchKey(keyPath, key) {
+				continue
+			}
+			if rule.Action != RedactHash {
+				// masking wins over hashing
+				action = RedactMask
+				break
+			}
+			action = RedactHash
+		}
+
+		if s, ok := value.(string); ok && action != "" && isRedacted(s) {
+			// redacted before persisted
+			continue
+		}
+		switch action {
+		case RedactMask:
+			set(key, RedactedMask)
+		case RedactHash:
+			set(key, p.hash(value))
+		default:
+			if r, changed := p.redactValue(rules, value, keyPath); changed {
+				set(key, r)
+			}
+		}
+	}
+	if redacted == nil {
+		return m, false
+	}
+	return redacted, true
+}
+
+/**
+ * redactValue redacts the keys under the value at keyPath, the items of a slice are matched by the path of the slice.
+ * The other values holding keys, e.g. the registered structs, are redacted in their JSON form,
+ * and the offloaded values are loaded to redact, a value failed to load is masked so that nothing leaks.
+ * It returns the value itself and false if none matched.
+ */
+func (p *RedactionPolicy) redactValue(rules []*RedactRule, value any, keyPath string) (any, bool) {
+	switch v := value.(type) {
+	case nil, string, bool, float64, float32, int, int64, int32, uint, uint64, uint32, json.Number:
+		return value, false
+	case map[string]any:
+		return p.redactMap(rules, v, keyPath+".")
+	case Data:
+		r, changed := p.redactMap(rules, v, keyPath+".")
+		return Data(r), changed
+	case []any:
+		var redacted []any
+		for i, item := range v {
+			r, changed := p.redactValue(rules, item, keyPath)
+			if !changed {
+				continue
+			}
+			if redacted == nil {
+				redacted = append([]any(nil), v...)
+			}
+			redacted[i] = r
+		}
+		if redacted == nil {
+			return value, false
+		}
+		return redacted, true
+	case *BlobRef:
+		resolved, err := v.Value()
+		if err != nil {
+			return RedactedMask, true
+		}
+		return p.redactValue(rules, resolved, keyPath)
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(value)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return value, false
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return value, false
+	}
+	var generic any
+	if err := json.Unmarshal(b, &generic); err != nil {
+		return value, false
+	}
+	if _, ok := generic.(string); ok {
+		// e.g. time.Time
+		return value, false
+	}
+	if r, changed := p.redactValue(rules, generic, keyPath); changed {
+		return r, true
+	}
+	return value, false
+}
+
+/**
+ * RedactData returns a copy of the data of a request running the DAG with the keys redacted by the rules of the DAG,
+ * no matter which nodes they select, or the data itself if nothing is redacted.
+ * It is applied on the data persisted out of the trace records, i.e. the result of the summary and the patches of the history.
+ */
+func (p *RedactionPolicy) RedactData(dagName string, d Data) Data {
+	if p == nil || len(d) == 0 {
+		return d
+	}
+	rules := make([]*RedactRule, 0, len(p.Rules))
+	for i := range p.Rules {
+		if p.Rules[i].DAG == "" || p.Rules[i].DAG == dagName {
+			rules = append(rules, &p.Rules[i])
+		}
+	}
+	if len(rules) == 0 {
+		return d
+	}
+	redacted, _ := p.redactMap(rules, d, "")
+	return redacted
+}
+
+/**
+ * Redact returns a copy of the record with the Input, Output and override Output redacted by the rules
+ * matching its vertex, or the record itself if nothing is redacted.
+ */
+func (p *RedactionPolicy) Redact(record *NodeTraceRecord) *NodeTraceRecord {
+	if p == nil || record == nil || len(p.Rules) == 0 {
+		return record
+	}
+	vertex := record.Vertex
+	if len(vertex) == 0 {
+		vertex = record.Path
+	}
+	if len(vertex) == 0 {
+		return record
+	}
+	dagName, node := vertex[0], strings.Join(vertex[1:], ".")
+
+	rules := make([]*RedactRule, 0, len(p.Rules))
+	for i := range p.Rules {
+		if p.Rules[i].matchVertex(dagName, node) {
+			rules = append(rules, &p.Rules[i])
+		}
+	}
+	if len(rules) == 0 {
+		return record
+	}
+
+	redacted := *record
+	input, inputChanged := p.redactMap(rules, record.Input, "")
+	output, outputChanged := p.redactMap(rules, record.Output, "")
+	redacted.Input, redacted.Output = input, output
+	overrideChanged := false
+	if record.Override != nil {
+		var overrideOutput map[string]any
+		if overrideOutput, overrideChanged = p.redactMap(rules, record.Override.Output, ""); overrideChanged {
+			override := *record.Override
+			override.Output = overrideOutput
+			redacted.Override = &override
+		}
+	}
+	if !inputChanged && !outputChanged && !overrideChanged {
+		return record
+	}
+	return &redacted
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactionPolicy(t *testing.T) {
+	policy := &RedactionPolicy{Rules: []RedactRule{
+		{Keys: []string{"password"}},
+		{DAG: "pay", Node: "charge", Keys: []string{"card.number"}, Action: RedactHash},
+		{DAG: "pay", Node: "sub.*", Keys: []string{"token"}},
+		{DAG: "other", Keys: []string{"*"}},
+	}}
+
+	input := Data{
+		"user":     map[string]any{"name": "bob", "password": "p1"},
+		"password": "p0",
+		"card":     Data{"number": "4111", "cvc": "123"},
+		"token":    "t",
+	}
+	record := &NodeTraceRecord{Vertex: []string{"pay", "charge"}, Input: input, Output: Data{"ok": true}}
+	redacted := policy.Redact(record)
+	assert.Equal(t, RedactedMask, redacted.Input["password"])
+	assert.Equal(t, map[string]any{"name": "bob", "password": RedactedMask}, redacted.Input["user"])
+	card := redacted.Input["card"].(Data)
+	assert.True(t, strings.HasPrefix(card["number"].(string), RedactedHashPrefix))
+	assert.Equal(t, "123", card["cvc"])
+	assert.Equal(t, "t", redacted.Input["token"])
+	// nothing redacted
+	assert.Equal(t, record.Output, redacted.Output)
+
+	// the record is not changed
+	assert.Equal(t, "p0", input["password"])
+	assert.Equal(t, "4111", input["card"].(Data)["number"])
+
+	// the same values get the same hashes
+	again := policy.Redact(&NodeTraceRecord{Vertex: []string{"pay", "charge"}, Input: Data{"card": map[string]any{"number": "4111"}}})
+	assert.Equal(t, card["number"], again.Input["card"].(map[string]any)["number"])
+	// redacting the redacted record again changes nothing
+	assert.Same(t, redacted, policy.Redact(redacted))
+	keyed := &RedactionPolicy{Rules: policy.Rules, HashKey: []byte("secret")}
+	keyedRecord := keyed.Redact(record)
+	assert.NotEqual(t, card["number"], keyedRecord.Input["card"].(Data)["number"])
+
+	redacted = policy.Redact(&NodeTraceRecord{Vertex: []string{"pay", "sub", "refund"}, Output: Data{"token": "t"}})
+	assert.Equal(t, RedactedMask, redacted.Output["token"])
+	redacted = policy.Redact(&NodeTraceRecord{Vertex: []string{"other", "n"}, Input: Data{"a": 1, "b": Data{"c": 2}}})
+	assert.Equal(t, Data{"a": RedactedMask, "b": RedactedMask}, redacted.Input)
+
+	override := &NodeTraceRecord{Vertex: []string{"pay", "n"}, Override: &VertexOverride{Output: Data{"password": "p"}}}
+	redacted = policy.Redact(override)
+	assert.Equal(t, RedactedMask, redacted.Override.Output["password"])
+	assert.Equal(t, "p", override.Override.Output["password"])
+
+	unmatched := &NodeTraceRecord{Vertex: []string{"x", "n"}, Input: Data{"token": "t"}}
+	assert.Same(t, unmatched, policy.Redact(unmatched))
+	var none *RedactionPolicy
+	assert.Same(t, unmatched, none.Redact(unmatched))
+}
+
+type redactCard struct {
+	Number string `json:"number"`
+	Holder string `json:"holder"`
+}
+
+func TestRedactionPolicy_Nested(t *testing.T) {
+	policy := &RedactionPolicy{Rules: []RedactRule{
+		{Keys: []string{"number", "password"}},
+	}}
+
+	resolve := func(ref *BlobRef) (any, error) {
+		if ref.Key == "missing" {
+			return nil, errors.NotFoundf("blob")
+		}
+		return map[string]any{"password": "p", "size": float64(1)}, nil
+	}
+	input := Data{
+		"cards":   []any{map[string]any{"number": "4111", "holder": "bob"}, "plain"},
+		"card":    redactCard{Number: "4111", Holder: "bob"},
+		"at":      time.Unix(0, 0).UTC(),
+		"report":  NewBlobRef("req-1", "k1", 100, resolve),
+		"missing": NewBlobRef("req-1", "missing", 100, resolve),
+		"tags":    []string{"a"},
+	}
+	redacted := policy.Redact(&NodeTraceRecord{Vertex: []string{"pay", "charge"}, Input: input})
+	assert.Equal(t, []any{map[string]any{"number": RedactedMask, "holder": "bob"}, "plain"}, redacted.Input["cards"])
+	assert.Equal(t, map[string]any{"number": RedactedMask, "holder": "bob"}, redacted.Input["card"])
+	assert.Equal(t, map[string]any{"password": RedactedMask, "size": float64(1)}, redacted.Input["report"])
+	assert.Equal(t, RedactedMask, redacted.Input["missing"])
+	// nothing to redact in the values
+	assert.Equal(t, input["at"], redacted.Input["at"])
+	assert.Equal(t, input["tags"], redacted.Input["tags"])
+	// the input is not changed
+	assert.Equal(t, "4111", input["cards"].([]any)[0].(map[string]any)["number"])
+	assert.Equal(t, redactCard{Number: "4111", Holder: "bob"}, input["card"])
+
+	data := Data{"password": "p", "n": 1}
+	assert.Equal(t, Data{"password": RedactedMask, "n": 1}, policy.RedactData("pay", data))
+	assert.Equal(t, "p", data["password"])
+	scoped := &RedactionPolicy{Rules: []RedactRule{{DAG: "other", Node: "n", Keys: []string{"password"}}}}
+	assert.Equal(t, data, scoped.RedactData("pay", data))
+	assert.Equal(t, RedactedMask, scoped.RedactData("other", data)["password"])
+	var none *RedactionPolicy
+	assert.Equal(t, data, none.RedactData("pay", data))
+}
@@ -17,9 +17,33 @@ const (
 	Finished StatusType = 10
 )
 
+// IsTerminal returns true if the request would never run again by itself
+func (s StatusType) IsTerminal() bool {
+	return s == Failed || s == Fatal || s == Finished
+}
+
 type Version string
 type Context interface {
 	context.Context
 
 	GetRequestID() string
+	/**
+	 * Logger returns the logger of the request with the request ID, DAG and vertex fields attached
+	 */
+	Logger() Logger
+}
+
+type operatorKey struct{}
+
+/**
+ * WithOperator attaches the operator name to the context given to the control APIs,
+ * e.g. PauseRequest, it is recorded in the history of the request.
+ */
+func WithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+func OperatorFromContext(ctx context.Context) string {
+	operator, _ := ctx.Value(operatorKey{}).(string)
+	return operator
 }
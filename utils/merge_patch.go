@@ -0,0 +1,30 @@
+package utils
+
+/**
+ * MergePatch applies the patch to the target in the way of JSON merge patch (RFC 7386),
+ * both of them are supposed to be the values decoded from JSON.
+ * A nil value in the patch removes the key, objects are merged recursively,
+ * any other value replaces the original one. The target is never modified.
+ */
+func MergePatch(target, patch any) any {
+	patchMap, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetMap, ok := target.(map[string]any)
+	result := make(map[string]any, len(targetMap)+len(patchMap))
+	if ok {
+		for k, v := range targetMap {
+			result[k] = v
+		}
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = MergePatch(result[k], v)
+	}
+	return result
+}
@@ -1,5 +1,7 @@
 package utils
 
+import "strings"
+
 func NewPath(s ...string) Path {
 	p := Path{}
 	p = append(p, s...)
@@ -8,14 +10,21 @@ func NewPath(s ...string) Path {
 
 type Path []string
 
+// AddString returns a new path, p is never modified by it
 func (p *Path) AddString(s ...string) Path {
-	return append(*p, s...)
+	np := make(Path, 0, len(*p)+len(s))
+	np = append(np, *p...)
+	return append(np, s...)
 }
 
 func (p *Path) Export() []string {
 	return *p
 }
 
+func (p Path) String() string {
+	return strings.Join(p, ".")
+}
+
 func (p Path) First() (string, bool) {
 	if len(p) == 0 {
 		return "", false
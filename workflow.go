@@ -1,9 +1,13 @@
 package workflow
 
 import (
+	"context"
+	"io"
+
 	"github.com/juju/errors"
 	"github.com/warriorguo/workflow/runtime"
 	"github.com/warriorguo/workflow/store"
+	"github.com/warriorguo/workflow/store/file"
 	"github.com/warriorguo/workflow/store/mem"
 	"github.com/warriorguo/workflow/store/postgres"
 	"github.com/warriorguo/workflow/types"
@@ -19,7 +23,7 @@ func NewFlowEngine(opts ...types.FlowOption) (types.FlowEngine, error) {
 	var s store.Store
 	var err error
 
-	// PostgresConfig takes precedence over MemStore
+	// PostgresConfig takes precedence over FileStoreConfig, and both over MemStore
 	if options.PostgresConfig != nil {
 		pgConfig := &postgres.Config{
 			Host:     options.PostgresConfig.Host,
@@ -34,6 +38,11 @@ func NewFlowEngine(opts ...types.FlowOption) (types.FlowEngine, error) {
 		if err != nil {
 			return nil, errors.Annotatef(err, "failed to create PostgreSQL store")
 		}
+	} else if options.FileStoreConfig != nil {
+		s, err = file.NewFileStore(fileConfig(options.FileStoreConfig))
+		if err != nil {
+			return nil, errors.Annotatef(err, "failed to create file store")
+		}
 	} else if options.MemStore {
 		s = mem.NewMemStore()
 	} else {
@@ -41,5 +50,42 @@ func NewFlowEngine(opts ...types.FlowOption) (types.FlowEngine, error) {
 		s = mem.NewMemStore()
 	}
 
-	return runtime.NewFlowEngine(s, options), nil
+	engine := runtime.NewFlowEngine(s, options)
+	if closer, ok := s.(io.Closer); ok {
+		return &storeOwnerEngine{FlowEngine: engine, store: closer}, nil
+	}
+	return engine, nil
+}
+
+// fileConfig converts the options into file.Config, the zero fields keep the defaults
+func fileConfig(options *types.FileStoreConfig) *file.Config {
+	config := file.DefaultConfig()
+	config.Dir = options.Dir
+	if options.SyncPolicy != "" {
+		config.SyncPolicy = file.SyncPolicy(options.SyncPolicy)
+	}
+	if options.SyncInterval > 0 {
+		config.SyncInterval = options.SyncInterval
+	}
+	if options.CompactThreshold > 0 {
+		config.CompactThreshold = options.CompactThreshold
+	}
+	if options.SnapshotInterval > 0 {
+		config.SnapshotInterval = options.SnapshotInterval
+	}
+	return config
+}
+
+// storeOwnerEngine closes the store created along with the engine
+type storeOwnerEngine struct {
+	types.FlowEngine
+	store io.Closer
+}
+
+func (e *storeOwnerEngine) Close(ctx context.Context) error {
+	err := e.FlowEngine.Close(ctx)
+	if cerr := e.store.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Trace(err)
 }